@@ -3,43 +3,82 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/snowflake"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
 
 	"github.com/dynamicgo/slf4go"
 	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/auth"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
 
 	config "github.com/dynamicgo/go-config"
+	extend "github.com/dynamicgo/go-config-extend"
 	"github.com/gomeshnetwork/gomesh"
 )
 
+const apierrScope = "tcc.agent"
+
+// errors
+var (
+	ErrTimeout  = apierr.WithScope(-1, "resource handler timeout", apierrScope)
+	ErrPanic    = apierr.WithScope(-2, "resource handler panic", apierrScope)
+	ErrResource = apierr.WithScope(-3, "invalid resource registration", apierrScope)
+	ErrDraining = apierr.WithScope(-4, "agent draining", apierrScope)
+)
+
 type agentImpl struct {
-	sync.RWMutex                                 // mixin mutex
-	slf4go.Logger                                // mixin logger
-	id            string                         // agent id
-	engine        tcc.EngineClient               // engine client
-	resources     map[string]*gomesh.TccResource // register local resources
-	snode         *snowflake.Node                // snode
-	backoff       time.Duration                  // attach backoff time
+	sync.RWMutex                         // mixin mutex
+	slf4go.Logger                        // mixin logger
+	id            string                 // agent id
+	conn          *grpc.ClientConn       // engine endpoints connection
+	engine        tcc.EngineClient       // engine client
+	resources     map[string]Participant // register local resources
+	snode         *snowflake.Node        // snode
+	backoff       *backoff               // attach backoff
+	stateMutex    sync.Mutex             // serialize state updates and listener calls
+	state         State                  // engine connection state
+	listeners     []func(state State)    // state listeners
+	journal       *journal               // durable journal, nil if disabled
+	pools         map[string]*workerPool // command worker pools by resource
+	poolDefault   poolConfig             // worker pool config of resources not in poolConfigs
+	poolConfigs   map[string]poolConfig  // worker pool config by resource
+	timeout       time.Duration          // resource handler timeout, 0 disabled
+	deliveries    *deliveries            // locks and delivery attempts of the pending commands
+	tries         map[string]*tryMethod  // Try methods of the struct resources
+	messageLocks  map[string]bool        // streaming methods locking the resource per received message
+	stopMutex     sync.Mutex             // guard draining and stopAttach
+	draining      bool                   // Stop called, don't attach again
+	stopAttach    context.CancelFunc     // cancel the current command stream
+	running       sync.WaitGroup         // received commands not finished
+	inflight      map[string]int         // dispatched commands not finished by commandKey
+	embedded      EmbeddedEngine         // in-process engine, nil if remote
+	inspector     inspector              // command tracking of Inspect
+	debug         net.Listener           // debug http listener, nil if disabled
 }
 
 // New create new agent which implement gomesh.TccServer interface
-func New() gomesh.TccServer {
+func New() Agent {
 
 	snode, _ := snowflake.NewNode(0)
 
 	return &agentImpl{
-		Logger:    slf4go.Get("tcc-agent"),
-		resources: make(map[string]*gomesh.TccResource),
-		snode:     snode,
-		backoff:   config.Get("gomesh", "tcc", "backoff").Duration(time.Second * 10),
+		Logger:     slf4go.Get("tcc-agent"),
+		resources:  make(map[string]Participant),
+		snode:      snode,
+		deliveries: newDeliveries(),
 	}
 }
 
@@ -47,6 +86,23 @@ func (agent *agentImpl) Start(config config.Config) error {
 
 	id := config.Get("gomesh", "tcc", "id").String("")
 
+	tlsConfig := tlsconfig.Load(config, "gomesh", "tcc", "tls")
+
+	// the engine verifies the agent id against the client certificate
+	if tlsConfig.Cert != "" {
+		name, err := tlsConfig.CommonName()
+
+		if err != nil {
+			return err
+		}
+
+		if id != "" && id != name {
+			return xerrors.New(fmt.Sprintf("gomesh.tcc.id %s mismatch the certificate common name %s", id, name))
+		}
+
+		id = name
+	}
+
 	if id == "" {
 		return xerrors.New("expect config gomesh.tcc.id")
 	}
@@ -59,31 +115,133 @@ func (agent *agentImpl) Start(config config.Config) error {
 		return xerrors.New("config gomesh.tcc.remote must be set")
 	}
 
-	conn, err := grpc.Dial(remote, grpc.WithInsecure())
+	// the in-process engine connection is not encrypted
+	secure := tlsConfig.Enabled() && remote != EmbeddedRemote
 
-	if err != nil {
-		return xerrors.Wrapf(err, "grpc connect to %s error", remote)
+	credential := grpc.WithInsecure()
+
+	if secure {
+		conf, err := tlsConfig.Client()
+
+		if err != nil {
+			return err
+		}
+
+		credential = grpc.WithTransportCredentials(credentials.NewTLS(conf))
+	}
+
+	agent.backoff = &backoff{
+		base: config.Get("gomesh", "tcc", "backoff_base").Duration(time.Millisecond * 100),
+		max:  config.Get("gomesh", "tcc", "backoff").Duration(time.Second * 10),
 	}
 
+	options := []grpc.DialOption{credential}
+
+	if token := config.Get("gomesh", "tcc", "token").String(""); token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(auth.NewTokenCredentials(token, secure)))
+	}
+
+	var conn *grpc.ClientConn
+	var err error
+
+	if remote == EmbeddedRemote {
+		embeddedConfig, err := extend.SubConfig(config, "gomesh", "tcc", "embedded")
+
+		if err != nil {
+			return xerrors.Wrapf(err, "load config gomesh.tcc.embedded error")
+		}
+
+		conn, err = agent.startEmbedded(embeddedConfig, options...)
+
+		if err != nil {
+			return err
+		}
+	} else {
+		conn, err = dial(remote, options...)
+
+		if err != nil {
+			return xerrors.Wrapf(err, "grpc connect to %s error", remote)
+		}
+	}
+
+	agent.deliveries.ttl = config.Get("gomesh", "tcc", "lock_ttl").Duration(time.Hour * 24)
+
+	if path := config.Get("gomesh", "tcc", "journal").String(""); path != "" {
+		if agent.journal, err = openJournal(path, agent.deliveries.ttl); err != nil {
+			agent.closeEngine(conn)
+			return err
+		}
+
+		agent.deliveries.restore(agent.journal.locked())
+	}
+
+	agent.poolDefault = poolConfig{
+		Workers: config.Get("gomesh", "tcc", "workers").Int(4),
+		Queue:   config.Get("gomesh", "tcc", "queue").Int(64),
+	}
+
+	agent.poolConfigs = make(map[string]poolConfig)
+
+	if err := config.Get("gomesh", "tcc", "pools").Scan(&agent.poolConfigs); err != nil {
+		agent.closeEngine(conn)
+		return xerrors.Wrapf(err, "parse config gomesh.tcc.pools error")
+	}
+
+	for resource, conf := range agent.poolConfigs {
+		if conf.Workers == 0 {
+			conf.Workers = agent.poolDefault.Workers
+		}
+
+		if conf.Queue == 0 {
+			conf.Queue = agent.poolDefault.Queue
+		}
+
+		agent.poolConfigs[resource] = conf
+	}
+
+	agent.messageLocks = make(map[string]bool)
+
+	for _, method := range config.Get("gomesh", "tcc", "message_locks").StringSlice(nil) {
+		agent.messageLocks[method] = true
+	}
+
+	agent.pools = make(map[string]*workerPool)
+	agent.timeout = config.Get("gomesh", "tcc", "handler_timeout").Duration(time.Second * 30)
+
+	if laddr := config.Get("gomesh", "tcc", "debug").String(""); laddr != "" {
+		if agent.debug, err = net.Listen("tcp", laddr); err != nil {
+			agent.closeEngine(conn)
+			return xerrors.Wrapf(err, "create debug listener %s error", laddr)
+		}
+
+		go http.Serve(agent.debug, agent.DebugHandler())
+	}
+
+	agent.conn = conn
 	agent.engine = tcc.NewEngineClient(conn)
 
+	go agent.watchConn()
 	go agent.attach()
 
 	return nil
 }
 
 func (agent *agentImpl) Register(tccResource gomesh.TccResource) error {
+	return agent.RegisterParticipant(tccResource.GrpcRequireFullMethod, FromTccResource(tccResource))
+}
+
+func (agent *agentImpl) RegisterParticipant(resource string, participant Participant) error {
 
 	agent.Lock()
 	defer agent.Unlock()
 
-	_, ok := agent.resources[tccResource.GrpcRequireFullMethod]
+	_, ok := agent.resources[resource]
 
 	if ok {
-		return xerrors.New(fmt.Sprintf("resource exits: %s", tccResource.GrpcRequireFullMethod))
+		return xerrors.New(fmt.Sprintf("resource exits: %s", resource))
 	}
 
-	agent.resources[tccResource.GrpcRequireFullMethod] = &tccResource
+	agent.resources[resource] = participant
 
 	return nil
 }
@@ -181,6 +339,7 @@ func (agent *agentImpl) BeforeRequire(ctx context.Context, grpcRequireFullMethod
 	}
 
 	ctx = gomesh.NewTccResourceIncomingContext(ctx, rid, !ok)
+	ctx = context.WithValue(ctx, payloadKey{}, &payloadHolder{})
 
 	_, err := agent.engine.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
 		Txid:     txid,
@@ -215,6 +374,20 @@ func (agent *agentImpl) AfterRequire(ctx context.Context, grpcRequireFullMethod
 
 	agent.DebugF("[local(%v)] after tcc resource %s require with rid %s", localTx, grpcRequireFullMethod, rid)
 
+	payload := payloadFromContext(ctx)
+
+	lock := &journalEntry{
+		Type: entryLocked, Txid: txid, Rid: rid, Resource: grpcRequireFullMethod, LocalTx: localTx, Payload: payload,
+	}
+
+	if agent.journal != nil {
+		if err := agent.journal.append(lock); err != nil {
+			return err
+		}
+
+		testHookStep(entryLocked)
+	}
+
 	_, err := agent.engine.EndLockResource(ctx, &tcc.EndLockResourceRequest{
 		Txid:     txid,
 		Agent:    agent.id,
@@ -227,12 +400,111 @@ func (agent *agentImpl) AfterRequire(ctx context.Context, grpcRequireFullMethod
 		return err
 	}
 
+	agent.deliveries.locked(txid, grpcRequireFullMethod, &lockRecord{rid: rid, payload: payload})
+
 	if localTx {
 		agent.DebugF("[local(%v)] after tcc resource %s require with rid %s -- completed,commit", localTx, grpcRequireFullMethod, rid)
-		return agent.Commit(ctx, txid)
+
+		if err := agent.Commit(ctx, txid); err != nil {
+			return err
+		}
+
+		return agent.journalStep(lock, entryEnded)
 	}
 
 	agent.DebugF("[local(%v)] after tcc resource %s require with rid %s -- completed", localTx, grpcRequireFullMethod, rid)
 
+	return agent.journalStep(lock, entryEnded)
+}
+
+// FailRequire report the failed require of the resource, the engine cancels the resource and the agent skips
+// the participant for it, the local transaction created by BeforeRequire is canceled
+func (agent *agentImpl) FailRequire(ctx context.Context, grpcRequireFullMethod string, cause error) error {
+
+	if !agent.isTccResource(grpcRequireFullMethod) {
+		agent.DebugF("[FailRequire] %s is not register resource api", grpcRequireFullMethod)
+		return nil
+	}
+
+	txid, _ := gomesh.TccTxid(ctx)
+
+	rid, _ := gomesh.TccRid(ctx)
+
+	localTx := gomesh.TccLocalTx(ctx)
+
+	agent.DebugF("[local(%v)] tcc resource %s require with rid %s failed: %s", localTx, grpcRequireFullMethod, rid, cause)
+
+	reason := "require failed"
+
+	if cause != nil {
+		reason = cause.Error()
+	}
+
+	lock := &journalEntry{
+		Type: entryLocked, Txid: txid, Rid: rid, Resource: grpcRequireFullMethod, LocalTx: localTx, Failed: reason,
+	}
+
+	if agent.journal != nil {
+		if err := agent.journal.append(lock); err != nil {
+			return err
+		}
+
+		testHookStep(entryLocked)
+	}
+
+	agent.deliveries.locked(txid, grpcRequireFullMethod, &lockRecord{rid: rid, failed: true})
+
+	if err := agent.failLock(ctx, lock); err != nil {
+		agent.ErrorF("fail tcc resource %s lock error: %s", grpcRequireFullMethod, err)
+		return err
+	}
+
+	return agent.journalStep(lock, entryEnded)
+}
+
+// failLock report the failed lock, cancel the local transaction of it
+func (agent *agentImpl) failLock(ctx context.Context, lock *journalEntry) error {
+	_, err := agent.engine.FailLockResource(ctx, &tcc.FailLockResourceRequest{
+		Txid:     lock.Txid,
+		Agent:    agent.id,
+		Resource: lock.Resource,
+		Rid:      lock.Rid,
+		Reason:   lock.Failed,
+	})
+
+	if err != nil || !lock.LocalTx {
+		return err
+	}
+
+	_, err = agent.engine.Cancel(ctx, &tcc.CancelTxRequest{Txid: lock.Txid})
+
+	if status.Code(err) == codes.FailedPrecondition {
+		return nil
+	}
+
+	return err
+}
+
+// LocalCall call f as the require of resource in the tcc transaction of ctx, or a local transaction if ctx has
+// none, the failure of f is reported by FailRequire
+func (agent *agentImpl) LocalCall(ctx context.Context, resource string, f func(ctx context.Context) error) error {
+	ctx, err := agent.BeforeRequire(ctx, resource)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "tcc resource %s before lock err", resource)
+	}
+
+	if err := f(ctx); err != nil {
+		if failErr := agent.FailRequire(ctx, resource, err); failErr != nil {
+			agent.ErrorF("%s", xerrors.Wrapf(failErr, "tcc resource %s fail lock err", resource))
+		}
+
+		return xerrors.Wrapf(err, "tcc resource %s lock err", resource)
+	}
+
+	if err := agent.AfterRequire(ctx, resource); err != nil {
+		return xerrors.Wrapf(err, "tcc resource %s after lock err", resource)
+	}
+
 	return nil
 }
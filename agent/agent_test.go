@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"github.com/gomeshnetwork/tcc/tlsconfig/tlstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+type mockEngine struct {
+	tcc.EngineServer
+	sync.Mutex
+	addr     string
+	server   *grpc.Server
+	newTxs   int
+	attached chan string
+}
+
+func (engine *mockEngine) NewTx(ctx context.Context, request *tcc.NewTxRequest) (*tcc.NewTxResponse, error) {
+	engine.Lock()
+	defer engine.Unlock()
+
+	engine.newTxs++
+
+	return &tcc.NewTxResponse{Txid: engine.addr}, nil
+}
+
+func (engine *mockEngine) AttachAgent(request *tcc.AttachAgentRequest, server tcc.Engine_AttachAgentServer) error {
+	if identity, ok := tlsconfig.Identity(server.Context()); ok && identity != request.Agent {
+		return status.Errorf(codes.PermissionDenied, "agent %s with certificate of %s", request.Agent, identity)
+	}
+
+	engine.attached <- engine.addr
+	<-server.Context().Done()
+	return nil
+}
+
+func newMockEngine(t *testing.T, attached chan string, opts ...grpc.ServerOption) *mockEngine {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &mockEngine{
+		addr:     listener.Addr().String(),
+		server:   grpc.NewServer(opts...),
+		attached: attached,
+	}
+
+	tcc.RegisterEngineServer(engine.server, engine)
+
+	go engine.server.Serve(listener)
+
+	return engine
+}
+
+func newTestConfig(t *testing.T, data string) config.Config {
+	conf := config.NewConfig()
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func waitAttached(t *testing.T, attached chan string) string {
+	select {
+	case addr := <-attached:
+		return addr
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait agent attach timeout")
+		return ""
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	backoff := &backoff{base: 100 * time.Millisecond, max: time.Second}
+
+	for attempt, expect := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		expect *= time.Millisecond
+
+		for i := 0; i < 10; i++ {
+			if d := backoff.delay(attempt); d < expect/2 || d > expect {
+				t.Fatalf("expect attempt %d delay in [%s,%s], got %s", attempt, expect/2, expect, d)
+			}
+		}
+	}
+
+	if d := backoff.delay(100); d > time.Second {
+		t.Fatalf("expect delay capped to max, got %s", d)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	attached := make(chan string, 10)
+
+	engines := map[string]*mockEngine{}
+
+	for i := 0; i < 2; i++ {
+		engine := newMockEngine(t, attached)
+		defer engine.server.Stop()
+		engines[engine.addr] = engine
+	}
+
+	var remotes []string
+
+	for addr := range engines {
+		remotes = append(remotes, addr)
+	}
+
+	agent := New().(*agentImpl)
+
+	states := make(chan State, 100)
+
+	agent.OnStateChange(func(state State) {
+		states <- state
+	})
+
+	conf := newTestConfig(t, fmt.Sprintf(
+		`{"gomesh":{"tcc":{"id":"agent","remote":"%s,%s","backoff_base":"10ms","backoff":"100ms"}}}`, remotes[0], remotes[1]))
+
+	if err := agent.Start(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	first := waitAttached(t, attached)
+
+	// wait for both endpoints connected then the unary calls are balanced
+	balanced := false
+
+	for i := 0; i < 100 && !balanced; i++ {
+		if _, err := agent.NewTx(context.Background(), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		balanced = true
+
+		for _, engine := range engines {
+			engine.Lock()
+			balanced = balanced && engine.newTxs > 0
+			engine.Unlock()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !balanced {
+		t.Fatalf("expect NewTx balanced on both engines")
+	}
+
+	engines[first].server.Stop()
+
+	if second := waitAttached(t, attached); second == first {
+		t.Fatalf("expect re-attached to the other engine, got %s", second)
+	}
+
+	var detached, reattached bool
+
+	for !reattached {
+		select {
+		case state := <-states:
+			detached = detached || (!state.Attached && state.Err != nil)
+			reattached = detached && state.Attached && state.Remote != first
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expect detached and re-attached state changes")
+		}
+	}
+}
+
+func TestTLSIdentity(t *testing.T) {
+	certs := tlstest.New(t)
+
+	cert, key := certs.Server("engine")
+
+	serverConf, err := (&tlsconfig.Config{Cert: cert, Key: key, CA: certs.CA, ClientAuth: true}).Server()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attached := make(chan string, 10)
+
+	engine := newMockEngine(t, attached, grpc.Creds(credentials.NewTLS(serverConf)))
+	defer engine.server.Stop()
+
+	clientCert, clientKey := certs.Client("agent-a")
+
+	data := fmt.Sprintf(`{"gomesh":{"tcc":{"id":%%q,"remote":%%q,"tls":{"cert":%q,"key":%q,"ca":%q,"server_name":"localhost"}}}}`,
+		clientCert, clientKey, certs.CA)
+
+	if err := New().Start(newTestConfig(t, fmt.Sprintf(data, "agent-b", engine.addr))); err == nil {
+		t.Fatalf("expect agent id mismatch the certificate rejected")
+	}
+
+	agent := New().(*agentImpl)
+
+	if err := agent.Start(newTestConfig(t, fmt.Sprintf(data, "", engine.addr))); err != nil {
+		t.Fatal(err)
+	}
+
+	if agent.id != "agent-a" {
+		t.Fatalf("expect agent id from the certificate, got %s", agent.id)
+	}
+
+	waitAttached(t, attached)
+
+	if _, err := agent.NewTx(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff exponential backoff with jitter
+type backoff struct {
+	base time.Duration // the first delay
+	max  time.Duration // max delay
+}
+
+// delay return the delay before the attempt, keep half of the exponential delay and randomize the other
+// half so the agents don't reconnect at the same time
+func (backoff *backoff) delay(attempt int) time.Duration {
+	d := backoff.max
+
+	if attempt < 32 && backoff.base<<uint(attempt) < backoff.max {
+		d = backoff.base << uint(attempt)
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
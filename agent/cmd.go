@@ -6,83 +6,208 @@ import (
 
 	"github.com/dynamicgo/xerrors"
 	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc/peer"
 )
 
-func (agent *agentImpl) cmdLoop(client tcc.Engine_AttachAgentClient) {
+// cmdLoop handle the commands until the stream broken
+func (agent *agentImpl) cmdLoop(client tcc.Engine_AttachAgentClient) error {
 	for {
 		cmd, err := client.Recv()
 
 		if err != nil {
-			agent.ErrorF("%s", xerrors.Wrapf(err, "agent recv cmd error"))
-			time.Sleep(time.Second * 10)
-			go agent.attach()
-			return
+			return xerrors.Wrapf(err, "agent recv cmd error")
 		}
 
 		agent.handleCmd(cmd)
 	}
 }
 
+func newCommandEntry(request *tcc.AgentCommandRequest) *journalEntry {
+	return &journalEntry{
+		Type:     entryCommand,
+		Txid:     request.Txid,
+		Resource: request.Resource,
+		Command:  request.Command,
+	}
+}
+
 func (agent *agentImpl) handleCmd(request *tcc.AgentCommandRequest) {
-	agent.RLock()
-	defer agent.RUnlock()
+	entry := newCommandEntry(request)
 
-	resource, ok := agent.resources[request.Resource]
+	agent.inspector.received(entry)
 
-	if !ok {
-		agent.WarnF("agent %s resource %s not found ", agent.id, request.Resource)
-		return
+	if !agent.dispatch(entry) {
+		// received while the stream detaching, tell the engine to deliver it again
+		agent.reportFailure(entry, xerrors.Wrapf(ErrDraining, "agent %s draining", agent.id), false)
 	}
+}
+
+// runCommand call the resource handler unless it succeeded before, then report the resource status, each step
+// is journaled if enabled
+func (agent *agentImpl) runCommand(entry *journalEntry) {
+	handled, called, reported := false, false, false
 
 	var err error
-	var status tcc.TxStatus
 
-	if request.Command == tcc.AgentCommand_COMMMIT {
-		err = resource.Commit(request.Txid)
+	agent.inspector.started(entry)
+
+	defer func() {
+		agent.inspector.finished(entry, called, reported, err)
+	}()
+
+	if agent.journal != nil {
+		if handled, err = agent.journal.received(entry); err != nil {
+			agent.ErrorF("%s", err)
+			return
+		}
+
+		testHookStep(entryCommand)
+	}
+
+	status := tcc.TxStatus_Canceled
+
+	if entry.Command == tcc.AgentCommand_COMMMIT {
 		status = tcc.TxStatus_Confirmed
-	} else {
-		err = resource.Cancel(request.Txid)
-		status = tcc.TxStatus_Canceled
 	}
 
-	if err != nil {
-		agent.ErrorF("%s", xerrors.Wrapf(err, "agent %s commit resource %s error", agent.id, request.Resource))
-		return
+	if !handled {
+		agent.RLock()
+		participant, ok := agent.resources[entry.Resource]
+		agent.RUnlock()
+
+		if !ok {
+			err = xerrors.Wrapf(ErrResource, "agent %s resource %s not found", agent.id, entry.Resource)
+			agent.WarnF("%s", err)
+			return
+		}
+
+		if err = agent.deliverCommand(participant, entry); err != nil {
+			err = xerrors.Wrapf(err, "agent %s %s resource %s error", agent.id, entry.Command, entry.Resource)
+			agent.ErrorF("%s", err)
+
+			// the engine stops delivering the permanently failed command, forget it but the failure
+			if permanent := IsPermanent(err); agent.reportFailure(entry, err, permanent) && permanent {
+				agent.deliveries.reported(entry, false)
+				agent.journalStep(entry, entryReported)
+			}
+
+			return
+		}
+
+		called = true
+
+		if err = agent.journalStep(entry, entryHandled); err != nil {
+			return
+		}
 	}
 
 	_, err = agent.engine.ResourceStatusChanged(context.Background(), &tcc.ResourceStatusChangedRequest{
-		Txid:     request.Txid,
-		Resource: request.Resource,
+		Txid:     entry.Txid,
+		Resource: entry.Resource,
 		Status:   status,
 		Agent:    agent.id,
 	})
 
 	if err != nil {
-		agent.ErrorF("%s",
-			xerrors.Wrapf(err, "agent %s notify resource %s status changed %s error", agent.id, request.Resource, status))
+		err = xerrors.Wrapf(err, "agent %s notify resource %s status changed %s error", agent.id, entry.Resource, status)
+		agent.ErrorF("%s", err)
 		return
 	}
 
+	reported = true
+
+	agent.deliveries.reported(entry, true)
+
+	agent.journalStep(entry, entryReported)
 }
 
+// reportFailure report the handler error, timeout or panic to the engine, the engine delivers the command again
+// unless the failure is permanent, return false if the report failed
+func (agent *agentImpl) reportFailure(entry *journalEntry, cause error, permanent bool) bool {
+	_, err := agent.engine.ResourceCommandFailed(context.Background(), &tcc.ResourceCommandFailedRequest{
+		Txid:      entry.Txid,
+		Resource:  entry.Resource,
+		Command:   entry.Command,
+		Agent:     agent.id,
+		Error:     cause.Error(),
+		Permanent: permanent,
+	})
+
+	if err != nil {
+		agent.ErrorF("%s", xerrors.Wrapf(err, "agent %s report resource %s %s failure error", agent.id, entry.Resource, entry.Command))
+		return false
+	}
+
+	return true
+}
+
+// attach the command stream to one of the engine endpoints, re-attach with backoff if broken
 func (agent *agentImpl) attach() {
+	attempt := 0
 
 	for {
-		cmd, err := agent.engine.AttachAgent(context.Background(), &tcc.AttachAgentRequest{
+		ctx, ok := agent.attachContext()
+
+		if !ok {
+			return
+		}
+
+		client, err := agent.engine.AttachAgent(ctx, &tcc.AttachAgentRequest{
 			Agent: agent.id,
 		})
 
 		if err != nil {
 			err = xerrors.Wrapf(err, "attach agent error")
 			agent.ErrorF("%s", err)
-			time.Sleep(agent.backoff)
+			time.Sleep(agent.backoff.delay(attempt))
+			attempt++
 			continue
 		}
 
-		agent.DebugF("attach tcc agent -- success")
+		remote := ""
+
+		if p, ok := peer.FromContext(client.Context()); ok {
+			remote = p.Addr.String()
+		}
+
+		agent.DebugF("attach tcc agent to %s -- success", remote)
 
-		go agent.cmdLoop(cmd)
+		agent.updateState(func(state *State) {
+			state.Attached, state.Remote, state.Err = true, remote, nil
+		})
+
+		attached := time.Now()
+
+		agent.inspector.attached()
+
+		if agent.journal != nil {
+			agent.replay()
+		}
+
+		err = agent.cmdLoop(client)
+
+		if agent.isDraining() {
+			agent.InfoF("command stream from %s detached for draining", remote)
+
+			agent.updateState(func(state *State) {
+				state.Attached, state.Remote, state.Err = false, "", nil
+			})
+
+			return
+		}
+
+		agent.ErrorF("%s", xerrors.Wrapf(err, "command stream from %s broken", remote))
+
+		agent.updateState(func(state *State) {
+			state.Attached, state.Remote, state.Err = false, "", err
+		})
+
+		// the stream lived long enough, the failure isn't caused by the last attach
+		if time.Since(attached) > agent.backoff.max {
+			attempt = 0
+		}
 
-		break
+		time.Sleep(agent.backoff.delay(attempt))
+		attempt++
 	}
 }
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/dynamicgo/xerrors"
+)
+
+// attachContext the context of the next command stream, false if the agent is draining
+func (agent *agentImpl) attachContext() (context.Context, bool) {
+	agent.stopMutex.Lock()
+	defer agent.stopMutex.Unlock()
+
+	if agent.draining {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	agent.stopAttach = cancel
+
+	return ctx, true
+}
+
+func (agent *agentImpl) isDraining() bool {
+	agent.stopMutex.Lock()
+	defer agent.stopMutex.Unlock()
+
+	return agent.draining
+}
+
+// Stop detach the command stream so the engine routes no more commands to the agent, wait the received
+// commands handled and reported until ctx done, then close the journal and the engine connection. If ctx is
+// done first they are closed once the running commands finished, the commands not handled are delivered
+// again by the engine
+func (agent *agentImpl) Stop(ctx context.Context) error {
+	agent.stopMutex.Lock()
+
+	if agent.draining {
+		agent.stopMutex.Unlock()
+		return nil
+	}
+
+	agent.draining = true
+
+	if agent.stopAttach != nil {
+		agent.stopAttach()
+	}
+
+	agent.stopMutex.Unlock()
+
+	agent.InfoF("agent %s draining", agent.id)
+
+	drained := make(chan struct{})
+
+	go func() {
+		agent.running.Wait()
+		close(drained)
+	}()
+
+	if agent.debug != nil {
+		agent.debug.Close()
+	}
+
+	select {
+	case <-drained:
+		agent.InfoF("agent %s drained", agent.id)
+		return agent.closeDrained()
+	case <-ctx.Done():
+	}
+
+	// the running commands still journal and report their steps
+	go func() {
+		<-drained
+		agent.closeDrained()
+	}()
+
+	return xerrors.Wrapf(ctx.Err(), "agent %s drain commands error", agent.id)
+}
+
+// closeDrained close the journal and the engine connection after the running commands finished
+func (agent *agentImpl) closeDrained() error {
+	var err error
+
+	if agent.journal != nil {
+		err = agent.journal.close()
+	}
+
+	if agent.conn != nil {
+		if closeErr := agent.closeEngine(agent.conn); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+)
+
+func TestStopDrain(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{Workers: 1, Queue: 1}, 0)
+
+	release := make(chan struct{})
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	stream, ok := agent.attachContext()
+
+	if !ok {
+		t.Fatal("attach context refused")
+	}
+
+	agent.handleCmd(commandFor("1", "/test/Lock"))
+
+	stopped := make(chan error, 1)
+
+	go func() {
+		stopped <- agent.Stop(context.Background())
+	}()
+
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("command stream not detached")
+	}
+
+	if _, ok := agent.attachContext(); ok {
+		t.Fatal("draining agent attached again")
+	}
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("stop returned before the handler finished: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stop not returned after drained")
+	}
+
+	if engine.String() != "[status 1 Confirmed]" {
+		t.Fatalf("unexpect engine calls %s", engine)
+	}
+
+	// received before the stream detached, the engine delivers it again
+	agent.handleCmd(commandFor("2", "/test/Lock"))
+
+	if engine.String() != "[status 1 Confirmed failed 2 COMMMIT]" {
+		t.Fatalf("expect the command received while draining refused, got %s", engine)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{Workers: 1, Queue: 1}, 0)
+
+	journal, err := openJournal(newJournalPath(t), 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent.journal = journal
+
+	release := make(chan struct{})
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	agent.handleCmd(commandFor("1", "/test/Lock"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := agent.Stop(ctx); !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+
+	// the journal is kept open for the running handler
+	close(release)
+
+	agent.running.Wait()
+
+	if engine.String() != "[status 1 Confirmed]" {
+		t.Fatalf("expect the running command journaled and reported after the timeout, got %s", engine)
+	}
+}
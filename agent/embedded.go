@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"sync"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/xerrors"
+	"google.golang.org/grpc"
+)
+
+// EmbeddedRemote config gomesh.tcc.remote value selecting the in-process engine
+const EmbeddedRemote = "embedded"
+
+// EmbeddedEngine the in-process engine started by the agent
+type EmbeddedEngine interface {
+	// Dial create the in-memory grpc connection to the engine
+	Dial(options ...grpc.DialOption) (*grpc.ClientConn, error)
+	// Stop the engine
+	Stop()
+}
+
+// EmbeddedFactory create the in-process engine with the gomesh.tcc.embedded config
+type EmbeddedFactory func(config config.Config) (EmbeddedEngine, error)
+
+var embedded struct {
+	sync.Mutex
+	factory EmbeddedFactory
+}
+
+// RegisterEmbedded register the in-process engine factory, import package
+// github.com/gomeshnetwork/tcc/engine/embedded to register the default one
+func RegisterEmbedded(factory EmbeddedFactory) {
+	embedded.Lock()
+	defer embedded.Unlock()
+
+	embedded.factory = factory
+}
+
+// startEmbedded start the registered in-process engine and dial it
+func (agent *agentImpl) startEmbedded(config config.Config, options ...grpc.DialOption) (*grpc.ClientConn, error) {
+	embedded.Lock()
+	factory := embedded.factory
+	embedded.Unlock()
+
+	if factory == nil {
+		return nil, xerrors.New("embedded engine not registered, import github.com/gomeshnetwork/tcc/engine/embedded")
+	}
+
+	engine, err := factory(config)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "start embedded engine error")
+	}
+
+	conn, err := engine.Dial(options...)
+
+	if err != nil {
+		engine.Stop()
+		return nil, xerrors.Wrapf(err, "dial embedded engine error")
+	}
+
+	agent.embedded = engine
+
+	return conn, nil
+}
+
+// closeEngine close the engine connection and stop the in-process engine if started
+func (agent *agentImpl) closeEngine(conn *grpc.ClientConn) error {
+	err := conn.Close()
+
+	if agent.embedded != nil {
+		agent.embedded.Stop()
+	}
+
+	return err
+}
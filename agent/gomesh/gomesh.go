@@ -5,6 +5,9 @@ import (
 	"github.com/gomeshnetwork/tcc/agent"
 )
 
+// Default the agent registered as gomesh tcc server
+var Default = agent.New()
+
 func init() {
-	gomesh.RegisterTccServer(agent.New())
+	gomesh.RegisterTccServer(Default)
 }
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gomeshnetwork/tcc"
+)
+
+// Command a command received from the engine
+type Command struct {
+	Txid     string    `json:"txid"`
+	Resource string    `json:"resource"`
+	Command  string    `json:"command"`
+	Received time.Time `json:"received"`
+}
+
+// Handler a running or failed resource handler call
+type Handler struct {
+	Txid     string    `json:"txid"`
+	Resource string    `json:"resource"`
+	Command  string    `json:"command"`
+	Started  time.Time `json:"started"`         // handler started time
+	Err      string    `json:"error,omitempty"` // error of the failed handler
+}
+
+// Counters the commands of one resource
+type Counters struct {
+	Received  uint64 `json:"received"`  // commands received from the engine
+	Confirmed uint64 `json:"confirmed"` // confirm handlers succeeded
+	Canceled  uint64 `json:"canceled"`  // cancel handlers succeeded
+	Failed    uint64 `json:"failed"`    // handler or status report failures
+	Reported  uint64 `json:"reported"`  // resource status reported to the engine
+}
+
+// Inspection the agent snapshot returned by Inspect
+type Inspection struct {
+	ID          string               `json:"id"`                     // agent id
+	Resources   []string             `json:"resources"`              // registered resources in name order
+	Conn        string               `json:"conn"`                   // engine connection state
+	Attached    bool                 `json:"attached"`               // whether the command stream attached
+	Remote      string               `json:"remote,omitempty"`       // engine address of the command stream
+	AttachedAt  time.Time            `json:"attached_at,omitempty"`  // last attach time
+	Err         string               `json:"error,omitempty"`        // the error detached the command stream
+	LastCommand *Command             `json:"last_command,omitempty"` // last command received
+	InFlight    []Handler            `json:"in_flight"`              // running handlers in start order
+	Failed      []Handler            `json:"failed"`                 // handlers failed since the last success
+	Counters    map[string]*Counters `json:"counters"`               // counters by resource
+}
+
+type handlerKey struct {
+	txid     string
+	resource string
+}
+
+// inspector track the commands for Inspect, the zero value is ready to use
+type inspector struct {
+	sync.Mutex
+	attachedAt  time.Time               // last attach time
+	lastCommand *Command                // last command received
+	inFlight    map[handlerKey]*Handler // running handlers
+	failed      map[handlerKey]*Handler // failed handlers
+	counters    map[string]*Counters    // counters by resource
+}
+
+// counter get the counters of resource, must be called with lock
+func (inspector *inspector) counter(resource string) *Counters {
+	if inspector.counters == nil {
+		inspector.counters = make(map[string]*Counters)
+	}
+
+	counters, ok := inspector.counters[resource]
+
+	if !ok {
+		counters = &Counters{}
+		inspector.counters[resource] = counters
+	}
+
+	return counters
+}
+
+func (inspector *inspector) attached() {
+	inspector.Lock()
+	defer inspector.Unlock()
+
+	inspector.attachedAt = time.Now()
+}
+
+func (inspector *inspector) received(entry *journalEntry) {
+	inspector.Lock()
+	defer inspector.Unlock()
+
+	inspector.lastCommand = &Command{
+		Txid:     entry.Txid,
+		Resource: entry.Resource,
+		Command:  entry.Command.String(),
+		Received: time.Now(),
+	}
+
+	inspector.counter(entry.Resource).Received++
+}
+
+func (inspector *inspector) started(entry *journalEntry) {
+	inspector.Lock()
+	defer inspector.Unlock()
+
+	if inspector.inFlight == nil {
+		inspector.inFlight = make(map[handlerKey]*Handler)
+	}
+
+	inspector.inFlight[handlerKey{entry.Txid, entry.Resource}] = &Handler{
+		Txid:     entry.Txid,
+		Resource: entry.Resource,
+		Command:  entry.Command.String(),
+		Started:  time.Now(),
+	}
+}
+
+// finished remove the running handler, count the succeeded command or record the failure
+func (inspector *inspector) finished(entry *journalEntry, handled, reported bool, err error) {
+	inspector.Lock()
+	defer inspector.Unlock()
+
+	key := handlerKey{entry.Txid, entry.Resource}
+
+	handler, ok := inspector.inFlight[key]
+
+	if !ok {
+		return
+	}
+
+	delete(inspector.inFlight, key)
+
+	counters := inspector.counter(entry.Resource)
+
+	if handled {
+		if entry.Command == tcc.AgentCommand_COMMMIT {
+			counters.Confirmed++
+		} else {
+			counters.Canceled++
+		}
+	}
+
+	if reported {
+		counters.Reported++
+	}
+
+	if err == nil {
+		delete(inspector.failed, key)
+		return
+	}
+
+	counters.Failed++
+
+	if inspector.failed == nil {
+		inspector.failed = make(map[handlerKey]*Handler)
+	}
+
+	handler.Err = err.Error()
+	inspector.failed[key] = handler
+}
+
+func sortHandlers(handlers map[handlerKey]*Handler) []Handler {
+	result := make([]Handler, 0, len(handlers))
+
+	for _, handler := range handlers {
+		result = append(result, *handler)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+
+	return result
+}
+
+// Inspect the registered resources, engine connection and the pending commands of the agent
+func (agent *agentImpl) Inspect() *Inspection {
+	inspection := &Inspection{
+		ID:       agent.id,
+		Counters: make(map[string]*Counters),
+	}
+
+	agent.RLock()
+	for resource := range agent.resources {
+		inspection.Resources = append(inspection.Resources, resource)
+	}
+	agent.RUnlock()
+
+	sort.Strings(inspection.Resources)
+
+	agent.stateMutex.Lock()
+	state := agent.state
+	agent.stateMutex.Unlock()
+
+	inspection.Conn = state.Conn.String()
+	inspection.Attached = state.Attached
+	inspection.Remote = state.Remote
+
+	if state.Err != nil {
+		inspection.Err = state.Err.Error()
+	}
+
+	agent.inspector.Lock()
+	defer agent.inspector.Unlock()
+
+	inspection.AttachedAt = agent.inspector.attachedAt
+
+	if agent.inspector.lastCommand != nil {
+		last := *agent.inspector.lastCommand
+		inspection.LastCommand = &last
+	}
+
+	inspection.InFlight = sortHandlers(agent.inspector.inFlight)
+	inspection.Failed = sortHandlers(agent.inspector.failed)
+
+	for resource, counters := range agent.inspector.counters {
+		copied := *counters
+		inspection.Counters[resource] = &copied
+	}
+
+	return inspection
+}
+
+// DebugHandler the http handler serving Inspect as json
+func (agent *agentImpl) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(agent.Inspect()); err != nil {
+			agent.ErrorF("encode agent inspection error: %s", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+)
+
+func waitInspection(t *testing.T, agent *agentImpl, f func(inspection *Inspection) bool) *Inspection {
+	for i := 0; i < 100; i++ {
+		inspection := agent.Inspect()
+
+		if f(inspection) {
+			return inspection
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("unexpect inspection %+v", agent.Inspect())
+
+	return nil
+}
+
+func TestInspect(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{Workers: 1, Queue: 4}, 0)
+
+	release := make(chan struct{})
+	fail := true
+
+	registerHandler(agent, "/test/Slow", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	registerHandler(agent, "/test/Fail", func(txid string) error {
+		if fail {
+			return xerrors.New("out of stock")
+		}
+
+		return nil
+	})
+
+	agent.handleCmd(commandFor("1", "/test/Slow"))
+
+	inspection := waitInspection(t, agent, func(inspection *Inspection) bool {
+		return len(inspection.InFlight) == 1
+	})
+
+	if inspection.InFlight[0].Txid != "1" || inspection.InFlight[0].Resource != "/test/Slow" {
+		t.Fatalf("unexpect in flight %+v", inspection.InFlight)
+	}
+
+	if len(inspection.Resources) != 2 || inspection.Resources[0] != "/test/Fail" {
+		t.Fatalf("unexpect resources %v", inspection.Resources)
+	}
+
+	close(release)
+
+	agent.handleCmd(commandFor("2", "/test/Fail"))
+
+	inspection = waitInspection(t, agent, func(inspection *Inspection) bool {
+		return len(inspection.InFlight) == 0 && len(inspection.Failed) == 1
+	})
+
+	if inspection.LastCommand == nil || inspection.LastCommand.Txid != "2" {
+		t.Fatalf("unexpect last command %+v", inspection.LastCommand)
+	}
+
+	if inspection.Failed[0].Txid != "2" || inspection.Failed[0].Err == "" {
+		t.Fatalf("unexpect failed %+v", inspection.Failed)
+	}
+
+	if counters := inspection.Counters["/test/Slow"]; counters.Received != 1 || counters.Confirmed != 1 || counters.Reported != 1 {
+		t.Fatalf("unexpect counters %+v", counters)
+	}
+
+	if counters := inspection.Counters["/test/Fail"]; counters.Received != 1 || counters.Failed != 1 || counters.Reported != 0 {
+		t.Fatalf("unexpect counters %+v", counters)
+	}
+
+	// the redelivered command succeeded
+	fail = false
+
+	agent.handleCmd(commandFor("2", "/test/Fail"))
+
+	waitInspection(t, agent, func(inspection *Inspection) bool {
+		return len(inspection.Failed) == 0 && inspection.Counters["/test/Fail"].Reported == 1
+	})
+}
+
+func TestDebugHandler(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{Workers: 1, Queue: 4}, 0)
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+
+	agent.DebugHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	var inspection Inspection
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &inspection); err != nil {
+		t.Fatal(err)
+	}
+
+	if inspection.ID != "agent" || len(inspection.Resources) != 1 || inspection.Attached {
+		t.Fatalf("unexpect inspection %s", recorder.Body)
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor lock the tcc resources around the require calls, the failed require calls are
+// reported by FailRequire instead of AfterRequire
+func (agent *agentImpl) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := agent.BeforeRequire(ctx, info.FullMethod)
+
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+
+		if err != nil {
+			if failErr := agent.FailRequire(ctx, info.FullMethod, err); failErr != nil {
+				agent.ErrorF("tcc resource %s fail lock err %s", info.FullMethod, failErr)
+			}
+
+			return nil, err
+		}
+
+		if err := agent.AfterRequire(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor lock the tcc resources of the streaming methods, the lock is opened when the stream
+// starts and ended when the handler returns, or failed if the handler returns error. The methods configured
+// by gomesh.tcc.message_locks open one lock per received message instead, ended when the handler receives
+// the next message or returns
+func (agent *agentImpl) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !agent.isTccResource(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		stream := &lockStream{
+			ServerStream: ss,
+			agent:        agent,
+			method:       info.FullMethod,
+			ctx:          ss.Context(),
+			perMessage:   agent.messageLocks[info.FullMethod],
+		}
+
+		if !stream.perMessage {
+			ctx, err := agent.BeforeRequire(ss.Context(), info.FullMethod)
+
+			if err != nil {
+				return err
+			}
+
+			stream.ctx, stream.locked = ctx, true
+		}
+
+		if err := handler(srv, stream); err != nil {
+			if stream.locked {
+				if failErr := agent.FailRequire(stream.ctx, info.FullMethod, err); failErr != nil {
+					agent.ErrorF("tcc resource %s fail lock err %s", info.FullMethod, failErr)
+				}
+			}
+
+			return err
+		}
+
+		return stream.end()
+	}
+}
+
+// lockStream the server stream with the context of the open resource lock
+type lockStream struct {
+	grpc.ServerStream
+	agent      *agentImpl
+	method     string
+	ctx        context.Context
+	perMessage bool // one lock per received message
+	locked     bool // the lock of ctx is open
+}
+
+func (stream *lockStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *lockStream) RecvMsg(m interface{}) error {
+	if !stream.perMessage {
+		return stream.ServerStream.RecvMsg(m)
+	}
+
+	// the handler is done with the previous message
+	if err := stream.end(); err != nil {
+		return err
+	}
+
+	if err := stream.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	ctx, err := stream.agent.BeforeRequire(stream.ServerStream.Context(), stream.method)
+
+	if err != nil {
+		return err
+	}
+
+	stream.ctx, stream.locked = ctx, true
+
+	return nil
+}
+
+// end the open lock
+func (stream *lockStream) end() error {
+	if !stream.locked {
+		return nil
+	}
+
+	stream.locked = false
+
+	return stream.agent.AfterRequire(stream.ctx, stream.method)
+}
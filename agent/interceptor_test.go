@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testStreamServer interface{}
+
+// streamRid reply the rid of the stream context
+func streamRid(stream grpc.ServerStream) *tcc.NewTxResponse {
+	rid, _ := gomesh.TccRid(stream.Context())
+	return &tcc.NewTxResponse{Txid: rid}
+}
+
+func failed(request *tcc.NewTxRequest) error {
+	if request.Txid == "fail" {
+		return status.Errorf(codes.FailedPrecondition, "out of stock")
+	}
+
+	return nil
+}
+
+// upload client streaming, reply the rid once all received
+func upload(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		request := &tcc.NewTxRequest{}
+
+		if err := stream.RecvMsg(request); err == io.EOF {
+			return stream.SendMsg(streamRid(stream))
+		} else if err != nil {
+			return err
+		}
+
+		if err := failed(request); err != nil {
+			return err
+		}
+	}
+}
+
+// download server streaming, reply the rid twice
+func download(srv interface{}, stream grpc.ServerStream) error {
+	request := &tcc.NewTxRequest{}
+
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := stream.SendMsg(streamRid(stream)); err != nil {
+			return err
+		}
+	}
+
+	return failed(request)
+}
+
+// chat bidi streaming, reply the rid of each message
+func chat(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		request := &tcc.NewTxRequest{}
+
+		if err := stream.RecvMsg(request); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := failed(request); err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(streamRid(stream)); err != nil {
+			return err
+		}
+	}
+}
+
+var streamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Stream",
+	HandlerType: (*testStreamServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Upload", Handler: upload, ClientStreams: true},
+		{StreamName: "Download", Handler: download, ServerStreams: true},
+		{StreamName: "Chat", Handler: chat, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+func serveStream(t *testing.T, agent *agentImpl) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer(grpc.StreamInterceptor(agent.StreamServerInterceptor()))
+	server.RegisterService(&streamServiceDesc, struct{}{})
+
+	go server.Serve(listener)
+
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return listener.Dial()
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// callStream send the requests, return the replied rids and the stream error
+func callStream(t *testing.T, conn *grpc.ClientConn, index int, requests ...string) ([]string, error) {
+	desc := &streamServiceDesc.Streams[index]
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", "1"))
+
+	stream, err := conn.NewStream(ctx, desc, "/test.Stream/"+desc.StreamName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rids []string
+
+	for _, request := range requests {
+		if err := stream.SendMsg(&tcc.NewTxRequest{Txid: request}); err != nil {
+			break
+		}
+
+		// bidi replies each message
+		if desc.ClientStreams && desc.ServerStreams {
+			reply := &tcc.NewTxResponse{}
+
+			if err := stream.RecvMsg(reply); err != nil {
+				return rids, err
+			}
+
+			rids = append(rids, reply.Txid)
+		}
+	}
+
+	stream.CloseSend()
+
+	for {
+		reply := &tcc.NewTxResponse{}
+
+		if err := stream.RecvMsg(reply); err == io.EOF {
+			return rids, nil
+		} else if err != nil {
+			return rids, err
+		}
+
+		rids = append(rids, reply.Txid)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, 0)
+	agent.snode, _ = snowflake.NewNode(0)
+	agent.messageLocks = map[string]bool{"/test.Stream/Chat": true}
+
+	for _, desc := range streamServiceDesc.Streams {
+		registerHandler(agent, "/test.Stream/"+desc.StreamName, func(txid string) error { return nil })
+	}
+
+	conn := serveStream(t, agent)
+	defer conn.Close()
+
+	cases := []struct {
+		name     string
+		index    int
+		requests []string
+		fail     bool
+		expect   string // engine calls, R0 and R1 the replied rids
+	}{
+		{"client stream", 0, []string{"a", "b"}, false, "[begin 1 R0 end 1 R0]"},
+		{"client stream fail", 0, []string{"a", "fail"}, true, "[begin 1 R? fail 1 R?]"},
+		{"server stream", 1, []string{"a"}, false, "[begin 1 R0 end 1 R0]"},
+		{"server stream fail", 1, []string{"fail"}, true, "[begin 1 R0 fail 1 R0]"},
+		{"bidi per message", 2, []string{"a", "b"}, false, "[begin 1 R0 end 1 R0 begin 1 R1 end 1 R1]"},
+		{"bidi per message fail", 2, []string{"a", "fail"}, true, "[begin 1 R0 end 1 R0 begin 1 R? fail 1 R?]"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine.Lock()
+			engine.calls = nil
+			engine.Unlock()
+
+			rids, err := callStream(t, conn, c.index, c.requests...)
+
+			if (err != nil) != c.fail {
+				t.Fatalf("expect stream failed %v, got %v", c.fail, err)
+			}
+
+			calls := engine.String()
+
+			for i, rid := range rids {
+				calls = strings.Replace(calls, rid, fmt.Sprintf("R%d", i), -1)
+			}
+
+			// the rid not replied
+			for _, field := range strings.Fields(strings.Trim(calls, "[]")) {
+				if strings.HasPrefix(field, "R_") {
+					calls = strings.Replace(calls, field, "R?", -1)
+				}
+			}
+
+			if calls != c.expect {
+				t.Fatalf("expect engine calls %s, got %s", c.expect, calls)
+			}
+		})
+	}
+}
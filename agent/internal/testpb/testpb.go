@@ -0,0 +1,15 @@
+// Package testpb the compiled fixture of the tcc.resource option tests
+package testpb
+
+//go:generate protoc -I ../../../../../.. -I . --go_out=plugins=grpc,paths=source_relative:. stock.proto
+
+// the service descs of stock.proto, the generated ones are unexported
+var (
+	Stock              = &_Stock_serviceDesc
+	StockNone          = &_StockNone_serviceDesc
+	StockMissingCancel = &_StockMissingCancel_serviceDesc
+	StockUnknown       = &_StockUnknown_serviceDesc
+	StockSignature     = &_StockSignature_serviceDesc
+	StockSwapped       = &_StockSwapped_serviceDesc
+	StockStream        = &_StockStream_serviceDesc
+)
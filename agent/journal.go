@@ -0,0 +1,402 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// journal entry types
+const (
+	entryCommand  = "command"  // engine command received
+	entryHandled  = "handled"  // command handler succeeded, status report pending
+	entryReported = "reported" // resource status or permanent failure reported
+	entryLocked   = "locked"   // resource require finished, EndLockResource or FailLockResource pending
+	entryEnded    = "ended"    // EndLockResource or FailLockResource reported
+)
+
+// compactThreshold rewrite the journal when the finished entries exceed it
+const compactThreshold = 1024
+
+// journalEntry one journal line
+type journalEntry struct {
+	Type     string           `json:"type"`
+	Txid     string           `json:"txid"`
+	Rid      string           `json:"rid,omitempty"`
+	Resource string           `json:"resource"`
+	Command  tcc.AgentCommand `json:"command"`
+	LocalTx  bool             `json:"local_tx,omitempty"`
+	Failed   string           `json:"failed,omitempty"`  // the require error, FailLockResource pending
+	Payload  []byte           `json:"payload,omitempty"` // the payload set by the require call
+	Time     time.Time        `json:"time"`
+}
+
+func (entry *journalEntry) commandKey() string {
+	return entry.Txid + "\x00" + entry.Resource + "\x00" + entry.Command.String()
+}
+
+func (entry *journalEntry) resourceKey() string {
+	return resourceKey(entry.Txid, entry.Resource)
+}
+
+func (entry *journalEntry) lockKey() string {
+	return entry.Txid + "\x00" + entry.Rid + "\x00" + entry.Resource
+}
+
+// pendingCommand the command not reported yet
+type pendingCommand struct {
+	entry   *journalEntry
+	handled bool
+}
+
+// journal append only file of the received commands and the unsent reports, each entry is synced to disk
+// before the step it records is taken
+type journal struct {
+	sync.Mutex
+	path     string
+	file     *os.File
+	commands map[string]*pendingCommand // pending commands by commandKey
+	locks    map[string]*journalEntry   // pending EndLockResource by lockKey
+	ended    map[string][]*journalEntry // ended locks by resourceKey, kept for the rid and payload until reported
+	ttl      time.Duration              // keep duration of the ended locks, 0 keeps forever
+	finished int                        // finished entries since last compaction
+}
+
+// openJournal load the journal file and compact it to the pending entries and the ended locks not expired
+func openJournal(path string, ttl time.Duration) (*journal, error) {
+	journal := &journal{
+		path:     path,
+		commands: make(map[string]*pendingCommand),
+		locks:    make(map[string]*journalEntry),
+		ended:    make(map[string][]*journalEntry),
+		ttl:      ttl,
+	}
+
+	if err := journal.load(); err != nil {
+		return nil, err
+	}
+
+	if err := journal.compact(); err != nil {
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+func (journal *journal) load() error {
+	file, err := os.Open(journal.path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return xerrors.Wrapf(err, "open journal %s error", journal.path)
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if err == io.EOF {
+			// the torn last line of a crash is dropped, its step wasn't taken
+			return nil
+		}
+
+		if err != nil {
+			return xerrors.Wrapf(err, "read journal %s error", journal.path)
+		}
+
+		entry := &journalEntry{}
+
+		if err := json.Unmarshal(line, entry); err != nil {
+			return xerrors.Wrapf(err, "decode journal %s entry %s error", journal.path, line)
+		}
+
+		journal.apply(entry)
+	}
+}
+
+// apply entry to the pending state
+func (journal *journal) apply(entry *journalEntry) {
+	switch entry.Type {
+	case entryCommand:
+		if _, ok := journal.commands[entry.commandKey()]; !ok {
+			journal.commands[entry.commandKey()] = &pendingCommand{entry: entry}
+		}
+	case entryHandled:
+		if pending, ok := journal.commands[entry.commandKey()]; ok {
+			pending.handled = true
+		}
+	case entryReported:
+		delete(journal.commands, entry.commandKey())
+		delete(journal.ended, entry.resourceKey())
+		journal.finished++
+	case entryLocked:
+		journal.locks[entry.lockKey()] = entry
+	case entryEnded:
+		delete(journal.locks, entry.lockKey())
+		journal.ended[entry.resourceKey()] = append(journal.ended[entry.resourceKey()], entry)
+		journal.finished++
+	}
+}
+
+// compact rewrite the journal with the pending entries only
+func (journal *journal) compact() error {
+	tmp := journal.path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "create journal %s error", tmp)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, pending := range journal.commands {
+		encoder.Encode(pending.entry)
+
+		if pending.handled {
+			handled := *pending.entry
+			handled.Type = entryHandled
+			encoder.Encode(&handled)
+		}
+	}
+
+	for _, entry := range journal.locks {
+		encoder.Encode(entry)
+	}
+
+	now := time.Now()
+
+	for key, entries := range journal.ended {
+		var kept []*journalEntry
+
+		for _, entry := range entries {
+			if journal.ttl <= 0 || now.Sub(entry.Time) < journal.ttl {
+				encoder.Encode(entry)
+				kept = append(kept, entry)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(journal.ended, key)
+		} else {
+			journal.ended[key] = kept
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return xerrors.Wrapf(err, "write journal %s error", tmp)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return xerrors.Wrapf(err, "sync journal %s error", tmp)
+	}
+
+	file.Close()
+
+	if err := os.Rename(tmp, journal.path); err != nil {
+		return xerrors.Wrapf(err, "rename journal %s error", tmp)
+	}
+
+	if journal.file != nil {
+		journal.file.Close()
+	}
+
+	journal.file, err = os.OpenFile(journal.path, os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "open journal %s error", journal.path)
+	}
+
+	journal.finished = 0
+
+	return nil
+}
+
+// append write and sync the entry
+func (journal *journal) append(entry *journalEntry) error {
+	journal.Lock()
+	defer journal.Unlock()
+
+	entry.Time = time.Now()
+
+	buff, err := json.Marshal(entry)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "encode journal entry error")
+	}
+
+	if _, err := journal.file.Write(append(buff, '\n')); err != nil {
+		return xerrors.Wrapf(err, "write journal %s error", journal.path)
+	}
+
+	if err := journal.file.Sync(); err != nil {
+		return xerrors.Wrapf(err, "sync journal %s error", journal.path)
+	}
+
+	journal.apply(entry)
+
+	if journal.finished > compactThreshold {
+		return journal.compact()
+	}
+
+	return nil
+}
+
+// pending return copies of the pending commands and EndLockResource entries
+func (journal *journal) pending() ([]*journalEntry, []*journalEntry) {
+	journal.Lock()
+	defer journal.Unlock()
+
+	var commands, locks []*journalEntry
+
+	for _, pending := range journal.commands {
+		entry := *pending.entry
+		commands = append(commands, &entry)
+	}
+
+	for _, lock := range journal.locks {
+		entry := *lock
+		locks = append(locks, &entry)
+	}
+
+	return commands, locks
+}
+
+// locked return copies of the pending and ended locks of the commands not reported, in lock order
+func (journal *journal) locked() []*journalEntry {
+	journal.Lock()
+	defer journal.Unlock()
+
+	var locks []*journalEntry
+
+	for _, entries := range journal.ended {
+		for _, ended := range entries {
+			entry := *ended
+			locks = append(locks, &entry)
+		}
+	}
+
+	for _, lock := range journal.locks {
+		entry := *lock
+		locks = append(locks, &entry)
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Time.Before(locks[j].Time)
+	})
+
+	return locks
+}
+
+func (journal *journal) close() error {
+	journal.Lock()
+	defer journal.Unlock()
+
+	return journal.file.Close()
+}
+
+// received journal the received command if not pending, return true if the command handler already succeeded
+func (journal *journal) received(entry *journalEntry) (bool, error) {
+	journal.Lock()
+	pending, ok := journal.commands[entry.commandKey()]
+	handled := ok && pending.handled
+	journal.Unlock()
+
+	if ok {
+		return handled, nil
+	}
+
+	return false, journal.append(entry)
+}
+
+// testHookStep called after each journaled step, the crash recovery tests stop the agent there
+var testHookStep = func(step string) {}
+
+// journalStep journal the step of entry if enabled
+func (agent *agentImpl) journalStep(entry *journalEntry, step string) error {
+	if agent.journal == nil {
+		return nil
+	}
+
+	record := *entry
+	record.Type = step
+
+	if err := agent.journal.append(&record); err != nil {
+		agent.ErrorF("%s", err)
+		return err
+	}
+
+	testHookStep(step)
+
+	return nil
+}
+
+// replay the pending reports and commands of the journal, called after attached, the commands are dispatched
+// to the worker pools, those still running since the last attach are skipped
+func (agent *agentImpl) replay() {
+	commands, locks := agent.journal.pending()
+
+	if len(commands) != 0 || len(locks) != 0 {
+		agent.InfoF("replay journal %d commands %d locks", len(commands), len(locks))
+	}
+
+	for _, entry := range locks {
+		agent.replayLock(entry)
+	}
+
+	for _, entry := range commands {
+		if !agent.dispatchPending(entry) {
+			agent.DebugF("replay command %s of tx %s resource %s -- skipped, still running or draining",
+				entry.Command, entry.Txid, entry.Resource)
+		}
+	}
+}
+
+// replayLock report the unsent EndLockResource or FailLockResource, the require call already returned the
+// report error, so the local transaction is canceled instead
+func (agent *agentImpl) replayLock(entry *journalEntry) {
+	var err error
+
+	if entry.Failed != "" {
+		err = agent.failLock(context.Background(), entry)
+	} else if entry.LocalTx {
+		_, err = agent.engine.Cancel(context.Background(), &tcc.CancelTxRequest{Txid: entry.Txid})
+
+		if status.Code(err) == codes.FailedPrecondition {
+			err = nil
+		}
+	} else {
+		_, err = agent.engine.EndLockResource(context.Background(), &tcc.EndLockResourceRequest{
+			Txid:     entry.Txid,
+			Agent:    agent.id,
+			Resource: entry.Resource,
+			Rid:      entry.Rid,
+		})
+	}
+
+	if err != nil {
+		agent.ErrorF("%s", xerrors.Wrapf(err, "replay resource %s lock of tx %s error", entry.Resource, entry.Txid))
+		return
+	}
+
+	agent.journalStep(entry, entryEnded)
+}
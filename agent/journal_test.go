@@ -0,0 +1,411 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recordEngine engine client recording the reports
+type recordEngine struct {
+	tcc.EngineClient
+	sync.Mutex
+	calls []string
+	fail  bool
+}
+
+func (engine *recordEngine) record(call string) error {
+	engine.Lock()
+	defer engine.Unlock()
+
+	if engine.fail {
+		return status.Errorf(codes.Unavailable, "engine unavailable")
+	}
+
+	engine.calls = append(engine.calls, call)
+
+	return nil
+}
+
+func (engine *recordEngine) ResourceStatusChanged(ctx context.Context, in *tcc.ResourceStatusChangedRequest, opts ...grpc.CallOption) (*tcc.ResourceStatusChangedRespose, error) {
+	return &tcc.ResourceStatusChangedRespose{}, engine.record(fmt.Sprintf("status %s %s", in.Txid, in.Status))
+}
+
+func (engine *recordEngine) ResourceCommandFailed(ctx context.Context, in *tcc.ResourceCommandFailedRequest, opts ...grpc.CallOption) (*tcc.ResourceCommandFailedResponse, error) {
+	call := fmt.Sprintf("failed %s %s", in.Txid, in.Command)
+
+	if in.Permanent {
+		call += " permanent"
+	}
+
+	return &tcc.ResourceCommandFailedResponse{}, engine.record(call)
+}
+
+func (engine *recordEngine) BeginLockResource(ctx context.Context, in *tcc.BeginLockResourceRequest, opts ...grpc.CallOption) (*tcc.BeginLockResourceRespose, error) {
+	return &tcc.BeginLockResourceRespose{}, engine.record(fmt.Sprintf("begin %s %s", in.Txid, in.Rid))
+}
+
+func (engine *recordEngine) EndLockResource(ctx context.Context, in *tcc.EndLockResourceRequest, opts ...grpc.CallOption) (*tcc.EndLockResourceRespose, error) {
+	return &tcc.EndLockResourceRespose{}, engine.record(fmt.Sprintf("end %s %s", in.Txid, in.Rid))
+}
+
+func (engine *recordEngine) FailLockResource(ctx context.Context, in *tcc.FailLockResourceRequest, opts ...grpc.CallOption) (*tcc.FailLockResourceRespose, error) {
+	return &tcc.FailLockResourceRespose{}, engine.record(fmt.Sprintf("fail %s %s", in.Txid, in.Rid))
+}
+
+func (engine *recordEngine) Commit(ctx context.Context, in *tcc.CommitTxRequest, opts ...grpc.CallOption) (*tcc.CommitTxResponse, error) {
+	return &tcc.CommitTxResponse{}, engine.record("commit " + in.Txid)
+}
+
+func (engine *recordEngine) Cancel(ctx context.Context, in *tcc.CancelTxRequest, opts ...grpc.CallOption) (*tcc.CancelTxResponse, error) {
+	return &tcc.CancelTxResponse{}, engine.record("cancel " + in.Txid)
+}
+
+func (engine *recordEngine) String() string {
+	engine.Lock()
+	defer engine.Unlock()
+
+	return fmt.Sprint(engine.calls)
+}
+
+// testProcess one agent process of the crash recovery tests sharing the journal file and handler counters
+type testProcess struct {
+	*agentImpl
+	engine  *recordEngine
+	commits *int
+}
+
+func startProcess(t *testing.T, path string, engine *recordEngine, commits *int) *testProcess {
+	journal, err := openJournal(path, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &agentImpl{
+		Logger:     slf4go.Get("tcc-agent"),
+		id:         "agent",
+		engine:     engine,
+		resources:  make(map[string]Participant),
+		deliveries: newDeliveries(),
+		journal:    journal,
+	}
+
+	agent.deliveries.restore(journal.locked())
+
+	agent.Register(gomesh.TccResource{
+		GrpcRequireFullMethod: "/test/Lock",
+		Commit: func(txid string) error {
+			*commits++
+			return nil
+		},
+		Cancel: func(txid string) error {
+			return nil
+		},
+	})
+
+	return &testProcess{agentImpl: agent, engine: engine, commits: commits}
+}
+
+type crash struct{}
+
+// crashAt run f, stop the process right after the step journaled
+func (process *testProcess) crashAt(t *testing.T, step string, f func()) {
+	testHookStep = func(current string) {
+		if current == step {
+			panic(crash{})
+		}
+	}
+
+	defer func() {
+		testHookStep = func(step string) {}
+
+		if r := recover(); r != nil {
+			if _, ok := r.(crash); !ok {
+				panic(r)
+			}
+
+			process.journal.close()
+			return
+		}
+
+		t.Fatalf("expect crashed at %s", step)
+	}()
+
+	f()
+}
+
+func newJournalPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tcc-journal")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "agent.journal")
+}
+
+var commitCommand = &tcc.AgentCommandRequest{Txid: "1", Resource: "/test/Lock", Command: tcc.AgentCommand_COMMMIT}
+
+func TestJournalCommandRecovery(t *testing.T) {
+	for _, step := range []string{entryCommand, entryHandled, entryReported} {
+		t.Run(step, func(t *testing.T) {
+			path := newJournalPath(t)
+			engine := &recordEngine{}
+			commits := 0
+
+			process := startProcess(t, path, engine, &commits)
+
+			process.crashAt(t, step, func() {
+				process.handleCmd(commitCommand)
+			})
+
+			process = startProcess(t, path, engine, &commits)
+
+			process.replay()
+
+			if commits != 1 {
+				t.Fatalf("expect commit handler called once, got %d", commits)
+			}
+
+			if calls := engine.String(); calls != "[status 1 Confirmed]" {
+				t.Fatalf("expect status reported once, got %s", calls)
+			}
+
+			if commands, locks := process.journal.pending(); len(commands) != 0 || len(locks) != 0 {
+				t.Fatalf("expect journal drained, got %v %v", commands, locks)
+			}
+		})
+	}
+}
+
+func TestJournalRedeliverDedupe(t *testing.T) {
+	path := newJournalPath(t)
+	engine := &recordEngine{fail: true}
+	commits := 0
+
+	process := startProcess(t, path, engine, &commits)
+
+	// the report fails, the engine redelivers the command
+	process.handleCmd(commitCommand)
+
+	engine.fail = false
+
+	process.handleCmd(commitCommand)
+
+	if commits != 1 {
+		t.Fatalf("expect handler not called for redelivered command, got %d", commits)
+	}
+
+	if calls := engine.String(); calls != "[status 1 Confirmed]" {
+		t.Fatalf("expect status reported by the redelivery, got %s", calls)
+	}
+
+	process.journal.close()
+
+	process = startProcess(t, path, engine, &commits)
+
+	process.replay()
+
+	if calls := engine.String(); calls != "[status 1 Confirmed]" {
+		t.Fatalf("expect nothing replayed, got %s", calls)
+	}
+}
+
+func requireContext(txid, rid string, localTx bool) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", txid))
+
+	return gomesh.NewTccResourceIncomingContext(ctx, rid, localTx)
+}
+
+func TestJournalLockRecovery(t *testing.T) {
+	for _, localTx := range []bool{false, true} {
+		t.Run(fmt.Sprintf("local-%v", localTx), func(t *testing.T) {
+			path := newJournalPath(t)
+			engine := &recordEngine{}
+			commits := 0
+
+			process := startProcess(t, path, engine, &commits)
+
+			process.crashAt(t, entryLocked, func() {
+				process.AfterRequire(requireContext("1", "R_1", localTx), "/test/Lock")
+			})
+
+			process = startProcess(t, path, engine, &commits)
+
+			process.replay()
+
+			expect := "[end 1 R_1]"
+
+			if localTx {
+				expect = "[cancel 1]"
+			}
+
+			if calls := engine.String(); calls != expect {
+				t.Fatalf("expect %s replayed, got %s", expect, calls)
+			}
+
+			if _, locks := process.journal.pending(); len(locks) != 0 {
+				t.Fatalf("expect journal drained, got %v", locks)
+			}
+		})
+	}
+}
+
+func TestJournalUnsentEndLock(t *testing.T) {
+	path := newJournalPath(t)
+	engine := &recordEngine{fail: true}
+	commits := 0
+
+	process := startProcess(t, path, engine, &commits)
+
+	if err := process.AfterRequire(requireContext("1", "R_1", false), "/test/Lock"); err == nil {
+		t.Fatalf("expect AfterRequire error with engine unavailable")
+	}
+
+	engine.fail = false
+
+	process.replay()
+
+	if calls := engine.String(); calls != "[end 1 R_1]" {
+		t.Fatalf("expect EndLockResource replayed, got %s", calls)
+	}
+
+	if err := process.AfterRequire(requireContext("2", "R_2", false), "/test/Lock"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, locks := process.journal.pending(); len(locks) != 0 {
+		t.Fatalf("expect journal drained, got %v", locks)
+	}
+}
+
+func TestJournalFailedLockRecovery(t *testing.T) {
+	path := newJournalPath(t)
+	engine := &recordEngine{}
+	commits := 0
+
+	process := startProcess(t, path, engine, &commits)
+
+	process.crashAt(t, entryLocked, func() {
+		process.FailRequire(requireContext("1", "R_1", true), "/test/Lock", fmt.Errorf("out of stock"))
+	})
+
+	process = startProcess(t, path, engine, &commits)
+
+	process.replay()
+
+	if calls := engine.String(); calls != "[fail 1 R_1 cancel 1]" {
+		t.Fatalf("expect failed lock replayed, got %s", calls)
+	}
+
+	if _, locks := process.journal.pending(); len(locks) != 0 {
+		t.Fatalf("expect journal drained, got %v", locks)
+	}
+}
+
+func TestJournalReplaySkipsRunning(t *testing.T) {
+	journal, err := openJournal(newJournalPath(t), 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{Workers: 1, Queue: 1}, 0)
+	agent.journal = journal
+
+	release := make(chan struct{})
+	calls := make(chan string, 4)
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		calls <- txid
+		<-release
+		return nil
+	})
+
+	agent.handleCmd(commandFor("1", "/test/Lock"))
+
+	<-calls
+
+	// the re-attach replays the journal while the command still runs in the pool
+	agent.replay()
+
+	close(release)
+
+	agent.running.Wait()
+
+	if len(calls) != 0 {
+		t.Fatal("expect the running command not replayed")
+	}
+
+	if calls := engine.String(); calls != "[status 1 Confirmed]" {
+		t.Fatalf("expect status reported once, got %s", calls)
+	}
+}
+
+func TestJournalRestoreLocks(t *testing.T) {
+	path := newJournalPath(t)
+	engine := &recordEngine{}
+	commits := 0
+
+	process := startProcess(t, path, engine, &commits)
+
+	for _, txid := range []string{"1", "2"} {
+		ctx := context.WithValue(requireContext(txid, "R_"+txid, false), payloadKey{}, &payloadHolder{payload: []byte(txid)})
+
+		if err := process.AfterRequire(ctx, "/test/Lock"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	process.journal.close()
+
+	process = startProcess(t, path, engine, &commits)
+
+	participant := &testParticipant{}
+	process.resources["/test/Lock"] = participant
+
+	cancel := commandFor("1", "/test/Lock")
+	cancel.Command = tcc.AgentCommand_Cancel
+
+	process.handleCmd(cancel)
+
+	if len(participant.cancels) != 1 {
+		t.Fatalf("expect cancel called once, got %d", len(participant.cancels))
+	}
+
+	if request := participant.cancels[0]; request.Rid != "R_1" || string(request.Payload) != "1" {
+		t.Fatalf("expect rid and payload restored from the journal, got %+v", request)
+	}
+
+	if locks := process.journal.locked(); len(locks) != 1 || locks[0].Txid != "2" {
+		t.Fatalf("expect the lock of the reported command dropped, got %v", locks)
+	}
+
+	process.journal.close()
+
+	journal, err := openJournal(path, time.Nanosecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer journal.close()
+
+	if locks := journal.locked(); len(locks) != 0 {
+		t.Fatalf("expect the expired locks dropped, got %v", locks)
+	}
+}
@@ -0,0 +1,317 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+)
+
+// ParticipantRequest the command of one locked resource delivered to the participant
+type ParticipantRequest struct {
+	Txid     string    // transaction id
+	Rid      string    // resource require id, empty if the agent restarted without journal since the resource locked
+	Resource string    // resource name, the grpc require full method
+	Attempt  int       // delivery attempt of the command by this agent process, starts from 1
+	Deadline time.Time // handler deadline, zero if the handler timeout disabled
+	Payload  []byte    // payload set by the require call through SetPayload
+}
+
+// ConfirmRequest confirm the locked resource
+type ConfirmRequest struct {
+	ParticipantRequest
+}
+
+// CancelRequest cancel the locked resource
+type CancelRequest struct {
+	ParticipantRequest
+}
+
+// Participant the context aware confirm and cancel handlers of one tcc resource, the handlers must be
+// idempotent, return an error made by Permanent to stop retrying the command
+type Participant interface {
+	Confirm(ctx context.Context, request ConfirmRequest) error
+	Cancel(ctx context.Context, request CancelRequest) error
+}
+
+// PermanentError participant failure the agent doesn't retry
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return "permanent: " + err.Err.Error()
+}
+
+// Permanent mark the participant error permanent
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent check if err or its cause is a PermanentError
+func IsPermanent(err error) bool {
+	for err != nil {
+		if _, ok := err.(*PermanentError); ok {
+			return true
+		}
+
+		cause, ok := err.(xerrors.Error)
+
+		if !ok {
+			return false
+		}
+
+		err = cause.Cause()
+	}
+
+	return false
+}
+
+// tccResourceParticipant adapt the gomesh.TccResource handlers to Participant
+type tccResourceParticipant struct {
+	resource gomesh.TccResource
+}
+
+// FromTccResource adapt the gomesh.TccResource commit and cancel handlers to Participant
+func FromTccResource(resource gomesh.TccResource) Participant {
+	return &tccResourceParticipant{resource: resource}
+}
+
+func (participant *tccResourceParticipant) Confirm(ctx context.Context, request ConfirmRequest) error {
+	return participant.resource.Commit(request.Txid)
+}
+
+func (participant *tccResourceParticipant) Cancel(ctx context.Context, request CancelRequest) error {
+	return participant.resource.Cancel(request.Txid)
+}
+
+type payloadKey struct{}
+
+// payloadHolder carry the payload from the require handler to AfterRequire
+type payloadHolder struct {
+	sync.Mutex
+	payload []byte
+}
+
+// SetPayload attach payload to the resource locked by the require call of ctx, the payload is passed to the
+// participant confirm and cancel handlers, it is kept in the agent memory and the journal if enabled
+func SetPayload(ctx context.Context, payload []byte) error {
+	holder, ok := ctx.Value(payloadKey{}).(*payloadHolder)
+
+	if !ok {
+		return xerrors.New("context is not a tcc resource require call")
+	}
+
+	holder.Lock()
+	holder.payload = payload
+	holder.Unlock()
+
+	return nil
+}
+
+func payloadFromContext(ctx context.Context) []byte {
+	holder, ok := ctx.Value(payloadKey{}).(*payloadHolder)
+
+	if !ok {
+		return nil
+	}
+
+	holder.Lock()
+	defer holder.Unlock()
+
+	return holder.payload
+}
+
+// lockRecord one resource locked by this agent process, or restored from the journal
+type lockRecord struct {
+	rid     string
+	payload []byte
+	failed  bool      // the require failed, canceled without calling the participant
+	time    time.Time // locked time
+}
+
+// failure the permanent failure of a command
+type failure struct {
+	err  error
+	time time.Time
+}
+
+// deliveries the locks, delivery attempts and permanent failures of the commands not reported yet
+type deliveries struct {
+	sync.Mutex
+	locks    map[string][]*lockRecord // by txid and resource
+	attempts map[string]int           // by commandKey
+	failed   map[string]*failure      // permanent failures by commandKey
+	ttl      time.Duration            // keep duration of the locks and failures, 0 keeps forever
+	swept    time.Time                // last expire sweep
+}
+
+func newDeliveries() *deliveries {
+	return &deliveries{
+		locks:    make(map[string][]*lockRecord),
+		attempts: make(map[string]int),
+		failed:   make(map[string]*failure),
+	}
+}
+
+func resourceKey(txid, resource string) string {
+	return txid + "\x00" + resource
+}
+
+func (deliveries *deliveries) locked(txid, resource string, record *lockRecord) {
+	deliveries.Lock()
+	defer deliveries.Unlock()
+
+	now := time.Now()
+
+	if record.time.IsZero() {
+		record.time = now
+	}
+
+	key := resourceKey(txid, resource)
+
+	deliveries.locks[key] = append(deliveries.locks[key], record)
+
+	deliveries.expire(now)
+}
+
+// restore the locks of the journal entries
+func (deliveries *deliveries) restore(entries []*journalEntry) {
+	for _, entry := range entries {
+		deliveries.locked(entry.Txid, entry.Resource, &lockRecord{
+			rid: entry.Rid, payload: entry.Payload, failed: entry.Failed != "", time: entry.Time,
+		})
+	}
+}
+
+// expire drop the locks and permanent failures older than ttl, the commands of them are never delivered or
+// already failed long ago, it sweeps at most once per ttl
+func (deliveries *deliveries) expire(now time.Time) {
+	if deliveries.ttl <= 0 || now.Sub(deliveries.swept) < deliveries.ttl {
+		return
+	}
+
+	deliveries.swept = now
+
+	for key, records := range deliveries.locks {
+		// the slice may be read by a running delivery, build a new one
+		var kept []*lockRecord
+
+		for _, record := range records {
+			if now.Sub(record.time) < deliveries.ttl {
+				kept = append(kept, record)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(deliveries.locks, key)
+		} else if len(kept) != len(records) {
+			deliveries.locks[key] = kept
+		}
+	}
+
+	for key, failure := range deliveries.failed {
+		if now.Sub(failure.time) >= deliveries.ttl {
+			delete(deliveries.failed, key)
+		}
+	}
+}
+
+// deliver return the delivery attempt and the locks of the command, or the permanent failure of it
+func (deliveries *deliveries) deliver(entry *journalEntry) (int, []*lockRecord, error) {
+	deliveries.Lock()
+	defer deliveries.Unlock()
+
+	key := entry.commandKey()
+
+	if failure, ok := deliveries.failed[key]; ok {
+		return 0, nil, failure.err
+	}
+
+	deliveries.attempts[key]++
+
+	locks := deliveries.locks[resourceKey(entry.Txid, entry.Resource)]
+
+	if len(locks) == 0 {
+		locks = []*lockRecord{{}}
+	}
+
+	return deliveries.attempts[key], locks, nil
+}
+
+func (deliveries *deliveries) fail(entry *journalEntry, err error) {
+	deliveries.Lock()
+	defer deliveries.Unlock()
+
+	now := time.Now()
+
+	deliveries.failed[entry.commandKey()] = &failure{err: err, time: now}
+
+	deliveries.expire(now)
+}
+
+// reported forget the command reported, the permanent failure of it is kept unless forgotten, a command
+// delivered again after the failure reported is reported failed without calling the handler
+func (deliveries *deliveries) reported(entry *journalEntry, forgetFailure bool) {
+	deliveries.Lock()
+	defer deliveries.Unlock()
+
+	delete(deliveries.locks, resourceKey(entry.Txid, entry.Resource))
+	delete(deliveries.attempts, entry.commandKey())
+
+	if forgetFailure {
+		delete(deliveries.failed, entry.commandKey())
+	}
+}
+
+// commandLocks keep the first lock whose require succeeded
+func commandLocks(locks []*lockRecord) []*lockRecord {
+	for _, lock := range locks {
+		if !lock.failed {
+			return []*lockRecord{lock}
+		}
+	}
+
+	return nil
+}
+
+// deliverCommand call the participant handler once for each resource the agent locked in the transaction, the
+// failed requires are skipped
+func (agent *agentImpl) deliverCommand(participant Participant, entry *journalEntry) error {
+	attempt, locks, err := agent.deliveries.deliver(entry)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "command %s of tx %s failed permanently before", entry.Command, entry.Txid)
+	}
+
+	// the gomesh.TccResource handlers only take the txid, call them once per command
+	if _, ok := participant.(*tccResourceParticipant); ok {
+		locks = commandLocks(locks)
+	}
+
+	for _, lock := range locks {
+		if lock.failed {
+			continue
+		}
+
+		err := agent.callHandler(participant, entry, ParticipantRequest{
+			Txid:     entry.Txid,
+			Rid:      lock.rid,
+			Resource: entry.Resource,
+			Attempt:  attempt,
+			Payload:  lock.payload,
+		})
+
+		if err != nil {
+			if IsPermanent(err) {
+				agent.deliveries.fail(entry, err)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type testParticipant struct {
+	confirms []ConfirmRequest
+	cancels  []CancelRequest
+	err      error
+}
+
+func (participant *testParticipant) Confirm(ctx context.Context, request ConfirmRequest) error {
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(request.Deadline) {
+		return errors.New("expect request deadline as context deadline")
+	}
+
+	participant.confirms = append(participant.confirms, request)
+
+	return participant.err
+}
+
+func (participant *testParticipant) Cancel(ctx context.Context, request CancelRequest) error {
+	participant.cancels = append(participant.cancels, request)
+
+	return participant.err
+}
+
+func TestParticipantRequest(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, time.Second)
+	agent.pools = nil
+	agent.snode, _ = snowflake.NewNode(0)
+
+	participant := &testParticipant{}
+
+	if err := agent.RegisterParticipant("/test/Lock", participant); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", "1"))
+
+	var rids []string
+
+	for _, payload := range []string{"a", "b"} {
+		ctx, err := agent.BeforeRequire(ctx, "/test/Lock")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := SetPayload(ctx, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := agent.AfterRequire(ctx, "/test/Lock"); err != nil {
+			t.Fatal(err)
+		}
+
+		rid, _ := gomesh.TccRid(ctx)
+		rids = append(rids, rid)
+	}
+
+	before := time.Now()
+
+	agent.handleCmd(commitCommand)
+
+	if len(participant.confirms) != 2 {
+		t.Fatalf("expect confirm called for each lock, got %d", len(participant.confirms))
+	}
+
+	for i, request := range participant.confirms {
+		if request.Txid != "1" || request.Resource != "/test/Lock" || request.Rid != rids[i] || request.Attempt != 1 {
+			t.Fatalf("unexpected confirm request %+v", request)
+		}
+
+		if string(request.Payload) != []string{"a", "b"}[i] {
+			t.Fatalf("expect payload %d passed, got %s", i, request.Payload)
+		}
+
+		if request.Deadline.Before(before.Add(time.Second)) {
+			t.Fatalf("expect deadline of the handler timeout, got %s", request.Deadline)
+		}
+	}
+
+	if err := SetPayload(context.Background(), nil); err == nil {
+		t.Fatal("expect SetPayload error outside require call")
+	}
+}
+
+func TestParticipantErrors(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, 0)
+	agent.pools = nil
+
+	participant := &testParticipant{err: errors.New("retry later")}
+
+	agent.RegisterParticipant("/test/Lock", participant)
+
+	cancel := commandFor("1", "/test/Lock")
+	cancel.Command = tcc.AgentCommand_Cancel
+
+	agent.handleCmd(cancel)
+	agent.handleCmd(cancel)
+
+	participant.err = Permanent(errors.New("account closed"))
+
+	// the permanent failure report is lost, the redelivered command is reported again without calling the handler
+	engine.fail = true
+
+	agent.handleCmd(cancel)
+
+	engine.fail = false
+
+	agent.handleCmd(cancel)
+
+	if len(participant.cancels) != 3 {
+		t.Fatalf("expect no delivery after permanent failure, got %d", len(participant.cancels))
+	}
+
+	for i, request := range participant.cancels {
+		if request.Attempt != i+1 || request.Rid != "" || !request.Deadline.IsZero() {
+			t.Fatalf("unexpected cancel request %+v", request)
+		}
+	}
+
+	if calls := engine.String(); calls != "[failed 1 Cancel failed 1 Cancel failed 1 Cancel permanent]" {
+		t.Fatalf("expect failed command reported as failure, got %s", calls)
+	}
+
+	if len(agent.deliveries.attempts) != 0 || len(agent.deliveries.failed) != 1 || len(agent.deliveries.locks) != 0 {
+		t.Fatalf("expect the permanently failed command evicted but the failure, got %d attempts %d failed %d locks",
+			len(agent.deliveries.attempts), len(agent.deliveries.failed), len(agent.deliveries.locks))
+	}
+
+	// a resent command after the failure reported doesn't call the handler again
+	agent.handleCmd(cancel)
+
+	if len(participant.cancels) != 3 {
+		t.Fatalf("expect no delivery after permanent failure reported, got %d", len(participant.cancels))
+	}
+
+	if !IsPermanent(participant.err) || IsPermanent(errors.New("retry later")) {
+		t.Fatal("IsPermanent mismatch")
+	}
+}
+
+func TestTccResourceOncePerCommand(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, 0)
+	agent.pools = nil
+
+	var commits []string
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		commits = append(commits, txid)
+		return nil
+	})
+
+	for _, rid := range []string{"r1", "r2", "r3"} {
+		agent.deliveries.locked("1", "/test/Lock", &lockRecord{rid: rid, failed: rid == "r1"})
+	}
+
+	agent.handleCmd(commandFor("1", "/test/Lock"))
+
+	if fmt.Sprint(commits) != "[1]" {
+		t.Fatalf("expect Commit called once per command, got %v", commits)
+	}
+
+	if calls := engine.String(); calls != "[status 1 Confirmed]" {
+		t.Fatalf("expect command reported, got %s", calls)
+	}
+}
+
+func TestFailRequire(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, 0)
+	agent.pools = nil
+	agent.snode, _ = snowflake.NewNode(0)
+
+	participant := &testParticipant{}
+
+	agent.RegisterParticipant("/test/Lock", participant)
+
+	interceptor := agent.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Lock"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", "1"))
+
+	var rids []string
+
+	for _, fail := range []bool{true, false} {
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			rid, _ := gomesh.TccRid(ctx)
+			rids = append(rids, rid)
+
+			if fail {
+				return nil, errors.New("out of stock")
+			}
+
+			return nil, nil
+		})
+
+		if (err != nil) != fail {
+			t.Fatalf("expect the handler error returned, got %v", err)
+		}
+	}
+
+	expect := "[begin 1 " + rids[0] + " fail 1 " + rids[0] + " begin 1 " + rids[1] + " end 1 " + rids[1] + "]"
+
+	if calls := engine.String(); calls != expect {
+		t.Fatalf("expect %s, got %s", expect, calls)
+	}
+
+	cancel := commandFor("1", "/test/Lock")
+	cancel.Command = tcc.AgentCommand_Cancel
+
+	agent.handleCmd(cancel)
+
+	if len(participant.cancels) != 1 || participant.cancels[0].Rid != rids[1] {
+		t.Fatalf("expect only the locked rid canceled, got %v", participant.cancels)
+	}
+
+	// the local transaction created by BeforeRequire is canceled
+	engine.calls = nil
+
+	if err := agent.FailRequire(requireContext("2", "R_3", true), "/test/Lock", errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := engine.String(); calls != "[fail 2 R_3 cancel 2]" {
+		t.Fatalf("expect failed lock reported and local tx canceled, got %s", calls)
+	}
+}
+
+func TestDeliveriesExpire(t *testing.T) {
+	deliveries := newDeliveries()
+	deliveries.ttl = time.Hour
+
+	expired := time.Now().Add(-2 * time.Hour)
+
+	deliveries.locked("1", "/test/Lock", &lockRecord{rid: "r1", time: expired})
+
+	if len(deliveries.locks) != 0 {
+		t.Fatalf("expect the expired lock dropped, got %d", len(deliveries.locks))
+	}
+
+	deliveries.locked("2", "/test/Lock", &lockRecord{rid: "r2"})
+
+	deliveries.failed["1"] = &failure{err: errors.New("account closed"), time: expired}
+	deliveries.swept = time.Time{}
+
+	deliveries.fail(&journalEntry{Txid: "2", Resource: "/test/Lock"}, errors.New("account closed"))
+
+	if len(deliveries.locks) != 1 || len(deliveries.failed) != 1 {
+		t.Fatalf("expect the live lock and failure kept, got %d locks %d failed", len(deliveries.locks), len(deliveries.failed))
+	}
+}
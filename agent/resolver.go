@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/resolver"
+)
+
+// staticScheme resolve the comma separated engine address list of the target endpoint
+const staticScheme = "tcc-static"
+
+func init() {
+	resolver.Register(&staticBuilder{})
+}
+
+type staticBuilder struct{}
+
+func (builder *staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	var addrs []resolver.Address
+
+	for _, addr := range strings.Split(target.Endpoint, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, resolver.Address{Addr: addr})
+		}
+	}
+
+	cc.NewAddress(addrs)
+
+	return &staticResolver{}, nil
+}
+
+func (builder *staticBuilder) Scheme() string {
+	return staticScheme
+}
+
+type staticResolver struct{}
+
+func (r *staticResolver) ResolveNow(resolver.ResolveNowOption) {}
+
+func (r *staticResolver) Close() {}
+
+// dial the engine endpoints with round robin balancing, remote is a comma separated address list or a grpc
+// target such as dns:///tcc-engine:2100 resolving to several addresses
+func dial(remote string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	target := remote
+
+	if strings.Contains(remote, ",") {
+		target = staticScheme + ":///" + remote
+	}
+
+	opts = append(opts, grpc.WithBalancerName(roundrobin.Name))
+
+	return grpc.Dial(target, opts...)
+}
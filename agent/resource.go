@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dynamicgo/xerrors"
+)
+
+// tryMethod the Try method of a struct resource, one of
+// func(context.Context) error, func(context.Context, T) error, func(context.Context, T) (R, error)
+type tryMethod struct {
+	method  reflect.Value
+	request reflect.Type // nil if Try takes no request
+	result  bool         // whether Try returns a result
+}
+
+func newTryMethod(value interface{}, name string) (*tryMethod, error) {
+	method := reflect.ValueOf(value).MethodByName(name)
+
+	if !method.IsValid() {
+		return nil, xerrors.Wrapf(ErrResource, "%T has no method %s", value, name)
+	}
+
+	t := method.Type()
+
+	if t.NumIn() < 1 || t.NumIn() > 2 || t.In(0) != contextType ||
+		t.NumOut() < 1 || t.NumOut() > 2 || t.Out(t.NumOut()-1) != errorType {
+		return nil, xerrors.Wrapf(ErrResource,
+			"%T method %s is %s, expect func(context.Context[, T]) ([R, ]error)", value, name, t)
+	}
+
+	try := &tryMethod{method: method, result: t.NumOut() == 2}
+
+	if t.NumIn() == 2 {
+		try.request = t.In(1)
+	}
+
+	return try, nil
+}
+
+// arg check the request against the Try method before the resource locked, return the invalid value if Try
+// takes no request
+func (try *tryMethod) arg(request interface{}) (reflect.Value, error) {
+	if try.request == nil {
+		return reflect.Value{}, nil
+	}
+
+	if request == nil {
+		return reflect.Zero(try.request), nil
+	}
+
+	value := reflect.ValueOf(request)
+
+	if !value.Type().AssignableTo(try.request) {
+		return value, xerrors.Wrapf(ErrResource, "Try request %T not assignable to %s", request, try.request)
+	}
+
+	return value, nil
+}
+
+func (try *tryMethod) call(ctx context.Context, arg reflect.Value) (interface{}, error) {
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+
+	if arg.IsValid() {
+		in = append(in, arg)
+	}
+
+	out := try.method.Call(in)
+
+	err, _ := out[len(out)-1].Interface().(error)
+
+	if !try.result {
+		return nil, err
+	}
+
+	return out[0].Interface(), err
+}
+
+// newStructParticipant lookup the try, confirm and cancel methods of value
+func newStructParticipant(value interface{}, try, confirm, cancel string) (*tryMethod, Participant, error) {
+	tryMethod, err := newTryMethod(value, try)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	confirmMethod, err := lookupMethod(value, confirm, confirmRequestType)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cancelMethod, err := lookupMethod(value, cancel, cancelRequestType)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tryMethod, &methodParticipant{confirm: confirmMethod, cancel: cancelMethod}, nil
+}
+
+func (agent *agentImpl) RegisterResource(name string, value interface{}) error {
+	try, participant, err := newStructParticipant(value, "Try", "Confirm", "Cancel")
+
+	if err != nil {
+		return xerrors.Wrapf(err, "register resource %s error", name)
+	}
+
+	return agent.registerParticipants(map[string]Participant{name: participant}, map[string]*tryMethod{name: try})
+}
+
+func (agent *agentImpl) RegisterResources(prefix string, value interface{}) error {
+	participants := make(map[string]Participant)
+	tries := make(map[string]*tryMethod)
+
+	t := reflect.TypeOf(value)
+
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+
+		if !strings.HasPrefix(name, "Try") || name == "Try" {
+			continue
+		}
+
+		suffix := strings.TrimPrefix(name, "Try")
+
+		try, participant, err := newStructParticipant(value, name, "Confirm"+suffix, "Cancel"+suffix)
+
+		if err != nil {
+			return xerrors.Wrapf(err, "register resource %s%s error", prefix, suffix)
+		}
+
+		participants[prefix+suffix] = participant
+		tries[prefix+suffix] = try
+	}
+
+	if len(participants) == 0 {
+		return xerrors.Wrapf(ErrResource, "%T has no TryXXX method", value)
+	}
+
+	return agent.registerParticipants(participants, tries)
+}
+
+func (agent *agentImpl) Try(ctx context.Context, resource string, request interface{}) (interface{}, error) {
+	agent.RLock()
+	try, ok := agent.tries[resource]
+	agent.RUnlock()
+
+	if !ok {
+		return nil, xerrors.Wrapf(ErrResource, "resource %s not registered by RegisterResource", resource)
+	}
+
+	arg, err := try.arg(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+
+	err = agent.LocalCall(ctx, resource, func(ctx context.Context) error {
+		var err error
+		result, err = try.call(ctx, arg)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// registerParticipants register all or none of the participants and the Try methods of the struct resources
+func (agent *agentImpl) registerParticipants(participants map[string]Participant, tries map[string]*tryMethod) error {
+	agent.Lock()
+	defer agent.Unlock()
+
+	for resource := range participants {
+		if _, ok := agent.resources[resource]; ok {
+			return xerrors.New(fmt.Sprintf("resource exits: %s", resource))
+		}
+	}
+
+	for resource, participant := range participants {
+		agent.resources[resource] = participant
+	}
+
+	if len(tries) != 0 && agent.tries == nil {
+		agent.tries = make(map[string]*tryMethod)
+	}
+
+	for resource, try := range tries {
+		agent.tries[resource] = try
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/dynamicgo/xerrors"
+	"google.golang.org/grpc/metadata"
+)
+
+type order struct {
+	ID string
+}
+
+type reserve struct {
+	tried     []string
+	confirmed []ConfirmRequest
+}
+
+func (r *reserve) Try(ctx context.Context, order *order) (string, error) {
+	r.tried = append(r.tried, order.ID)
+	return "reserved " + order.ID, nil
+}
+
+func (r *reserve) Confirm(ctx context.Context, request ConfirmRequest) error {
+	r.confirmed = append(r.confirmed, request)
+	return nil
+}
+
+func (r *reserve) Cancel(ctx context.Context, request CancelRequest) error {
+	return nil
+}
+
+type inventory struct{}
+
+func (i *inventory) TryReserve(ctx context.Context) error                             { return nil }
+func (i *inventory) ConfirmReserve(ctx context.Context, request ConfirmRequest) error { return nil }
+func (i *inventory) CancelReserve(ctx context.Context, request CancelRequest) error   { return nil }
+func (i *inventory) TryDeduct(ctx context.Context, amount int) error                  { return nil }
+func (i *inventory) ConfirmDeduct(ctx context.Context, request ConfirmRequest) error  { return nil }
+func (i *inventory) CancelDeduct(ctx context.Context, request CancelRequest) error    { return nil }
+
+type misnamed struct{}
+
+func (m *misnamed) TryPay(ctx context.Context) error                           { return nil }
+func (m *misnamed) ConfirmPay(ctx context.Context, txid string) error          { return nil }
+func (m *misnamed) CancelPay(ctx context.Context, request CancelRequest) error { return nil }
+
+func TestRegisterResource(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{}, 0)
+	agent.pools = nil
+	agent.snode, _ = snowflake.NewNode(0)
+
+	r := &reserve{}
+
+	if err := agent.RegisterResource("stock.reserve", r); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", "1"))
+
+	result, err := agent.Try(ctx, "stock.reserve", &order{ID: "o1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != "reserved o1" || len(r.tried) != 1 {
+		t.Fatalf("expect Try called, got %v %v", result, r.tried)
+	}
+
+	if calls := engine.String(); !strings.HasPrefix(calls, "[begin 1 R_") || !strings.Contains(calls, "end 1 R_") {
+		t.Fatalf("expect the resource locked, got %s", calls)
+	}
+
+	calls := engine.String()
+
+	if _, err := agent.Try(ctx, "stock.reserve", "o2"); !xerrors.Is(err, ErrResource) {
+		t.Fatalf("expect request type mismatch, got %v", err)
+	}
+
+	if engine.String() != calls {
+		t.Fatalf("expect no lock for the mismatched request, got %s", engine.String())
+	}
+
+	if _, err := agent.Try(ctx, "stock.unknown", nil); !xerrors.Is(err, ErrResource) {
+		t.Fatalf("expect unknown resource, got %v", err)
+	}
+
+	agent.handleCmd(commandFor("1", "stock.reserve"))
+
+	if len(r.confirmed) != 1 || r.confirmed[0].Txid != "1" {
+		t.Fatalf("expect Confirm called, got %v", r.confirmed)
+	}
+}
+
+func TestRegisterResources(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{}, 0)
+
+	if err := agent.RegisterResources("inventory.", &inventory{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !agent.isTccResource("inventory.Reserve") || !agent.isTccResource("inventory.Deduct") {
+		t.Fatal("expect the TryXXX methods registered")
+	}
+
+	err := agent.RegisterResources("pay.", &misnamed{})
+
+	if !xerrors.Is(err, ErrResource) || !strings.Contains(err.Error(), "ConfirmPay") {
+		t.Fatalf("expect ConfirmPay signature mismatch, got %v", err)
+	}
+
+	if err := agent.RegisterResources("none.", &reserve{}); !xerrors.Is(err, ErrResource) {
+		t.Fatalf("expect no TryXXX methods error, got %v", err)
+	}
+
+	if err := agent.RegisterResource("inventory", &inventory{}); !xerrors.Is(err, ErrResource) {
+		t.Fatalf("expect missing Try error, got %v", err)
+	}
+
+	if len(agent.resources) != 2 {
+		t.Fatalf("expect failed registrations register nothing, got %d", len(agent.resources))
+	}
+}
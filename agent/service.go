@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc"
+)
+
+// resourceOption the tcc.resource option of one rpc method
+type resourceOption struct {
+	method  string
+	confirm string
+	cancel  string
+}
+
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	confirmRequestType = reflect.TypeOf(ConfirmRequest{})
+	cancelRequestType  = reflect.TypeOf(CancelRequest{})
+)
+
+// methodParticipant call the confirm and cancel methods found by reflection
+type methodParticipant struct {
+	confirm reflect.Value
+	cancel  reflect.Value
+}
+
+func (participant *methodParticipant) Confirm(ctx context.Context, request ConfirmRequest) error {
+	return callMethod(participant.confirm, ctx, request)
+}
+
+func (participant *methodParticipant) Cancel(ctx context.Context, request CancelRequest) error {
+	return callMethod(participant.cancel, ctx, request)
+}
+
+func callMethod(method reflect.Value, ctx context.Context, request interface{}) error {
+	out := method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(request)})
+
+	err, _ := out[0].Interface().(error)
+
+	return err
+}
+
+// lookupMethod return the method name of impl, expect func(context.Context, requestType) error
+func lookupMethod(impl interface{}, name string, requestType reflect.Type) (reflect.Value, error) {
+	method := reflect.ValueOf(impl).MethodByName(name)
+
+	if !method.IsValid() {
+		return method, xerrors.Wrapf(ErrResource, "%T has no method %s", impl, name)
+	}
+
+	t := method.Type()
+
+	if t.NumIn() != 2 || t.In(0) != contextType || t.In(1) != requestType || t.NumOut() != 1 || t.Out(0) != errorType {
+		return method, xerrors.Wrapf(ErrResource, "%T method %s is %s, expect func(context.Context, %s) error",
+			impl, name, t, requestType)
+	}
+
+	return method, nil
+}
+
+func (agent *agentImpl) RegisterService(desc *grpc.ServiceDesc, impl interface{}) error {
+	handlerType := reflect.TypeOf(desc.HandlerType).Elem()
+
+	if !reflect.TypeOf(impl).Implements(handlerType) {
+		return xerrors.Wrapf(ErrResource, "%T does not implement %s", impl, handlerType)
+	}
+
+	file, ok := desc.Metadata.(string)
+
+	if !ok || proto.FileDescriptor(file) == nil {
+		return xerrors.Wrapf(ErrResource, "service %s file descriptor %v not registered", desc.ServiceName, desc.Metadata)
+	}
+
+	options, err := parseResourceOptions(proto.FileDescriptor(file), desc.ServiceName)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "parse service %s file descriptor %s error", desc.ServiceName, file)
+	}
+
+	if len(options) == 0 {
+		return xerrors.Wrapf(ErrResource, "service %s has no method annotated by tcc.resource", desc.ServiceName)
+	}
+
+	unary := make(map[string]bool)
+
+	for _, method := range desc.Methods {
+		unary[method.MethodName] = true
+	}
+
+	participants := make(map[string]Participant)
+
+	for _, option := range options {
+		if !unary[option.method] {
+			return xerrors.Wrapf(ErrResource, "tcc resource %s/%s is not an unary method", desc.ServiceName, option.method)
+		}
+
+		if option.confirm == "" || option.cancel == "" {
+			return xerrors.Wrapf(ErrResource, "tcc resource %s/%s expect both confirm and cancel", desc.ServiceName, option.method)
+		}
+
+		confirm, err := lookupMethod(impl, option.confirm, confirmRequestType)
+
+		if err != nil {
+			return err
+		}
+
+		cancel, err := lookupMethod(impl, option.cancel, cancelRequestType)
+
+		if err != nil {
+			return err
+		}
+
+		participants[fmt.Sprintf("/%s/%s", desc.ServiceName, option.method)] = &methodParticipant{
+			confirm: confirm,
+			cancel:  cancel,
+		}
+	}
+
+	return agent.registerParticipants(participants, nil)
+}
+
+// parseResourceOptions read the tcc.resource options of service from the gzipped FileDescriptorProto
+func parseResourceOptions(gzipped []byte, service string) ([]*resourceOption, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(gzipped))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := &descriptor.FileDescriptorProto{}
+
+	if err := proto.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+
+	var options []*resourceOption
+
+	for _, desc := range file.Service {
+		name := desc.GetName()
+
+		if file.GetPackage() != "" {
+			name = file.GetPackage() + "." + name
+		}
+
+		if name != service {
+			continue
+		}
+
+		for _, method := range desc.Method {
+			if method.Options == nil || !proto.HasExtension(method.Options, tcc.E_Resource) {
+				continue
+			}
+
+			ext, err := proto.GetExtension(method.Options, tcc.E_Resource)
+
+			if err != nil {
+				return nil, xerrors.Wrapf(err, "read method %s tcc.resource option error", method.GetName())
+			}
+
+			resource := ext.(*tcc.ResourceOptions)
+
+			options = append(options, &resourceOption{
+				method:  method.GetName(),
+				confirm: resource.Confirm,
+				cancel:  resource.Cancel,
+			})
+		}
+	}
+
+	return options, nil
+}
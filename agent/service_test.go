@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/agent/internal/testpb"
+	"google.golang.org/grpc"
+)
+
+type stock struct {
+	confirmed []ConfirmRequest
+	canceled  []CancelRequest
+}
+
+func (s *stock) Reserve(ctx context.Context, request *testpb.ReserveRequest) (*testpb.ReserveResponse, error) {
+	return &testpb.ReserveResponse{}, nil
+}
+
+func (s *stock) Watch(stream testpb.Stock_WatchServer) error {
+	return nil
+}
+
+func (s *stock) Subscribe(stream testpb.StockStream_SubscribeServer) error {
+	return nil
+}
+
+func (s *stock) ConfirmReserve(ctx context.Context, request ConfirmRequest) error {
+	s.confirmed = append(s.confirmed, request)
+	return nil
+}
+
+func (s *stock) CancelReserve(ctx context.Context, request CancelRequest) error {
+	s.canceled = append(s.canceled, request)
+	return nil
+}
+
+func (s *stock) ConfirmWithTxid(txid string) error {
+	return nil
+}
+
+func TestRegisterService(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{}, 0)
+	agent.pools = nil
+
+	impl := &stock{}
+
+	if err := agent.RegisterService(testpb.Stock, impl); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := agent.RegisterService(testpb.Stock, impl); err == nil {
+		t.Fatal("expect duplicate registration error")
+	}
+
+	if !agent.isTccResource("/test.Stock/Reserve") || agent.isTccResource("/test.Stock/Watch") {
+		t.Fatal("expect only the annotated method registered")
+	}
+
+	command := commandFor("1", "/test.Stock/Reserve")
+
+	agent.handleCmd(command)
+
+	command.Command = tcc.AgentCommand_Cancel
+
+	agent.handleCmd(command)
+
+	if len(impl.confirmed) != 1 || impl.confirmed[0].Txid != "1" || len(impl.canceled) != 1 {
+		t.Fatalf("expect confirm and cancel dispatched, got %v %v", impl.confirmed, impl.canceled)
+	}
+}
+
+func TestRegisterServiceMisconfigured(t *testing.T) {
+	missing := *testpb.Stock
+	missing.Metadata = "missing.proto"
+
+	cases := []struct {
+		name string
+		desc *grpc.ServiceDesc
+		impl interface{}
+	}{
+		{"no annotation", testpb.StockNone, &stock{}},
+		{"missing cancel", testpb.StockMissingCancel, &stock{}},
+		{"unknown method", testpb.StockUnknown, &stock{}},
+		{"signature", testpb.StockSignature, &stock{}},
+		{"swapped", testpb.StockSwapped, &stock{}},
+		{"stream", testpb.StockStream, &stock{}},
+		{"handler type", testpb.Stock, struct{}{}},
+		{"not registered", &missing, &stock{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agent := newPoolAgent(&recordEngine{}, poolConfig{}, 0)
+
+			err := agent.RegisterService(c.desc, c.impl)
+
+			if !xerrors.Is(err, ErrResource) {
+				t.Fatalf("expect ErrResource, got %v", err)
+			}
+
+			if len(agent.resources) != 0 {
+				t.Fatalf("expect nothing registered, got %v", agent.resources)
+			}
+		})
+	}
+}
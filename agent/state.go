@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gomeshnetwork/gomesh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// State the engine connection state passed to the state listeners
+type State struct {
+	Conn     connectivity.State // client connection state over all engine endpoints
+	Attached bool               // whether the command stream attached
+	Remote   string             // engine address of the attached command stream
+	Err      error              // the error detached the command stream
+}
+
+// Agent the tcc agent created by New
+type Agent interface {
+	gomesh.TccServer
+	// OnStateChange register listener called on each engine connection state change, the listeners are
+	// called serially and must not block
+	OnStateChange(listener func(state State))
+	// RegisterParticipant register the context aware handlers of resource, the grpc require full method
+	RegisterParticipant(resource string, participant Participant) error
+	// RegisterService register the methods of the grpc service annotated by the tcc.resource option, the
+	// confirm and cancel methods named by the option are called on impl
+	RegisterService(desc *grpc.ServiceDesc, impl interface{}) error
+	// RegisterResource register value with the Try, Confirm and Cancel methods as resource name
+	RegisterResource(name string, value interface{}) error
+	// RegisterResources register each TryXXX, ConfirmXXX and CancelXXX methods of value as resource prefix+XXX
+	RegisterResources(prefix string, value interface{}) error
+	// Try call the Try method of the struct resource in the tcc transaction of ctx, or a local transaction
+	// if ctx has none, returns the Try result if any
+	Try(ctx context.Context, resource string, request interface{}) (interface{}, error)
+	// FailRequire report the failed require of the resource instead of AfterRequire
+	FailRequire(ctx context.Context, grpcRequireFullMethod string, cause error) error
+	// LocalCall call f as the require of resource like gomesh LocalCall, the failure of f calls FailRequire
+	LocalCall(ctx context.Context, resource string, f func(ctx context.Context) error) error
+	// UnaryServerInterceptor grpc interceptor calling BeforeRequire, AfterRequire and FailRequire around the
+	// registered resource methods
+	UnaryServerInterceptor() grpc.UnaryServerInterceptor
+	// StreamServerInterceptor grpc interceptor locking the registered resources of the streaming methods
+	StreamServerInterceptor() grpc.StreamServerInterceptor
+	// Inspect the registered resources, engine connection and the pending commands of the agent
+	Inspect() *Inspection
+	// DebugHandler the http handler serving Inspect as json
+	DebugHandler() http.Handler
+	// Stop detach from the engine and wait the received commands handled and reported until ctx done
+	Stop(ctx context.Context) error
+}
+
+func (agent *agentImpl) OnStateChange(listener func(state State)) {
+	agent.stateMutex.Lock()
+	defer agent.stateMutex.Unlock()
+
+	agent.listeners = append(agent.listeners, listener)
+}
+
+// updateState apply f to the current state and notify the listeners
+func (agent *agentImpl) updateState(f func(state *State)) {
+	agent.stateMutex.Lock()
+	defer agent.stateMutex.Unlock()
+
+	f(&agent.state)
+
+	for _, listener := range agent.listeners {
+		listener(agent.state)
+	}
+}
+
+// watchConn report the client connection state changes until the connection closed
+func (agent *agentImpl) watchConn() {
+	for {
+		current := agent.conn.GetState()
+
+		agent.updateState(func(state *State) {
+			state.Conn = current
+		})
+
+		if current == connectivity.Shutdown || !agent.conn.WaitForStateChange(context.Background(), current) {
+			return
+		}
+	}
+}
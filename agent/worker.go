@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime/debug"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+)
+
+// poolConfig worker pool config of one resource
+type poolConfig struct {
+	Workers int `json:"workers"` // concurrent handlers
+	Queue   int `json:"queue"`   // queued commands per worker
+}
+
+// workerPool run the commands of one resource, the commands of one txid are run by the same worker in order
+type workerPool struct {
+	queues []chan *journalEntry
+}
+
+func newWorkerPool(conf poolConfig, run func(entry *journalEntry)) *workerPool {
+	if conf.Workers < 1 {
+		conf.Workers = 1
+	}
+
+	pool := &workerPool{}
+
+	for i := 0; i < conf.Workers; i++ {
+		queue := make(chan *journalEntry, conf.Queue)
+
+		pool.queues = append(pool.queues, queue)
+
+		go func() {
+			for entry := range queue {
+				run(entry)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// dispatch queue the command to the worker of its txid, blocks while the worker queue is full so the command
+// stream stops reading and the engine is pushed back by the stream flow control
+func (pool *workerPool) dispatch(entry *journalEntry) {
+	hash := fnv.New32a()
+	hash.Write([]byte(entry.Txid))
+
+	pool.queues[hash.Sum32()%uint32(len(pool.queues))] <- entry
+}
+
+// dispatch the command to the worker pool of its resource, run it inline if the pools are not started, return
+// false if the agent is draining
+func (agent *agentImpl) dispatch(entry *journalEntry) bool {
+	// Stop sets draining under stopMutex before waiting on running, so no command is added after the wait
+	agent.stopMutex.Lock()
+
+	if agent.draining {
+		agent.stopMutex.Unlock()
+		return false
+	}
+
+	agent.Lock()
+
+	agent.dispatched(entry)
+
+	pool, ok := agent.pools[entry.Resource]
+
+	if !ok && agent.pools != nil {
+		if _, ok = agent.resources[entry.Resource]; ok {
+			conf, found := agent.poolConfigs[entry.Resource]
+
+			if !found {
+				conf = agent.poolDefault
+			}
+
+			pool = newWorkerPool(conf, agent.runDispatched)
+			agent.pools[entry.Resource] = pool
+		}
+	}
+
+	agent.Unlock()
+	agent.stopMutex.Unlock()
+
+	if !ok {
+		agent.runDispatched(entry)
+		return true
+	}
+
+	pool.dispatch(entry)
+
+	return true
+}
+
+// dispatchPending dispatch the pending command unless it is still running or queued or the agent is draining,
+// return false if skipped
+func (agent *agentImpl) dispatchPending(entry *journalEntry) bool {
+	agent.Lock()
+	running := agent.inflight[entry.commandKey()] > 0
+	agent.Unlock()
+
+	if running {
+		return false
+	}
+
+	return agent.dispatch(entry)
+}
+
+// dispatched track the command until runDispatched finished, must be called with lock
+func (agent *agentImpl) dispatched(entry *journalEntry) {
+	if agent.inflight == nil {
+		agent.inflight = make(map[string]int)
+	}
+
+	agent.inflight[entry.commandKey()]++
+	agent.running.Add(1)
+}
+
+// runDispatched run the dispatched command
+func (agent *agentImpl) runDispatched(entry *journalEntry) {
+	defer func() {
+		agent.Lock()
+
+		if agent.inflight[entry.commandKey()]--; agent.inflight[entry.commandKey()] <= 0 {
+			delete(agent.inflight, entry.commandKey())
+		}
+
+		agent.Unlock()
+
+		agent.running.Done()
+	}()
+
+	agent.runCommand(entry)
+}
+
+// callHandler call the participant confirm or cancel handler with the handler timeout as context deadline, a
+// handler panic or timeout is returned as error, the timed out handler is left running
+func (agent *agentImpl) callHandler(participant Participant, entry *journalEntry, request ParticipantRequest) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if agent.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), agent.timeout)
+		request.Deadline, _ = ctx.Deadline()
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				agent.ErrorF("agent %s resource %s handler panic: %v\n%s", agent.id, entry.Resource, r, debug.Stack())
+				done <- xerrors.Wrapf(ErrPanic, "txid %s panic: %v", entry.Txid, r)
+			}
+		}()
+
+		if entry.Command == tcc.AgentCommand_COMMMIT {
+			done <- participant.Confirm(ctx, ConfirmRequest{request})
+		} else {
+			done <- participant.Cancel(ctx, CancelRequest{request})
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return xerrors.Wrapf(ErrTimeout, "txid %s handler not returned in %s", entry.Txid, agent.timeout)
+	}
+}
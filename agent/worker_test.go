@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+)
+
+func newPoolAgent(engine tcc.EngineClient, conf poolConfig, timeout time.Duration) *agentImpl {
+	return &agentImpl{
+		Logger:      slf4go.Get("tcc-agent"),
+		id:          "agent",
+		engine:      engine,
+		resources:   make(map[string]Participant),
+		deliveries:  newDeliveries(),
+		pools:       make(map[string]*workerPool),
+		poolDefault: conf,
+		poolConfigs: make(map[string]poolConfig),
+		timeout:     timeout,
+	}
+}
+
+func registerHandler(agent *agentImpl, resource string, handler func(txid string) error) {
+	agent.Register(gomesh.TccResource{
+		GrpcRequireFullMethod: resource,
+		Commit:                handler,
+		Cancel:                handler,
+	})
+}
+
+func commandFor(txid, resource string) *tcc.AgentCommandRequest {
+	return &tcc.AgentCommandRequest{Txid: txid, Resource: resource, Command: tcc.AgentCommand_COMMMIT}
+}
+
+func TestWorkerPoolIsolation(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{Workers: 1, Queue: 1}, 0)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	done := make(chan string, 1)
+
+	registerHandler(agent, "/test/Slow", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	registerHandler(agent, "/test/Fast", func(txid string) error {
+		done <- txid
+		return nil
+	})
+
+	agent.handleCmd(commandFor("1", "/test/Slow"))
+	agent.handleCmd(commandFor("2", "/test/Fast"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slow resource stalls the other resource")
+	}
+}
+
+func TestWorkerPoolOrdering(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{Workers: 8, Queue: 16}, 0)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	calls := make(map[string][]int)
+	seq := 0
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		defer wg.Done()
+
+		mutex.Lock()
+		calls[txid] = append(calls[txid], seq)
+		seq++
+		mutex.Unlock()
+
+		return nil
+	})
+
+	for i := 0; i < 10; i++ {
+		for txid := 0; txid < 10; txid++ {
+			wg.Add(1)
+			agent.handleCmd(commandFor(fmt.Sprint(txid), "/test/Lock"))
+		}
+	}
+
+	wg.Wait()
+
+	for txid, seqs := range calls {
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] < seqs[i-1] {
+				t.Fatalf("txid %s commands out of order %v", txid, seqs)
+			}
+		}
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	agent := newPoolAgent(&recordEngine{}, poolConfig{Workers: 1, Queue: 1}, 0)
+
+	release := make(chan struct{})
+
+	registerHandler(agent, "/test/Slow", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	// one running and one queued
+	agent.handleCmd(commandFor("1", "/test/Slow"))
+	agent.handleCmd(commandFor("1", "/test/Slow"))
+
+	dispatched := make(chan struct{})
+
+	go func() {
+		agent.handleCmd(commandFor("1", "/test/Slow"))
+		close(dispatched)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("expect dispatch blocked by the full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("expect dispatch resumed once the queue drained")
+	}
+}
+
+func TestHandlerFailures(t *testing.T) {
+	engine := &recordEngine{}
+	agent := newPoolAgent(engine, poolConfig{Workers: 1}, 50*time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	registerHandler(agent, "/test/Panic", func(txid string) error {
+		panic("handler bug")
+	})
+
+	registerHandler(agent, "/test/Hang", func(txid string) error {
+		<-release
+		return nil
+	})
+
+	registerHandler(agent, "/test/Lock", func(txid string) error {
+		return nil
+	})
+
+	agent.handleCmd(commandFor("1", "/test/Panic"))
+	agent.handleCmd(commandFor("2", "/test/Hang"))
+	agent.handleCmd(commandFor("3", "/test/Lock"))
+
+	// the pools process in parallel, wait the reported command then for the timeout of the hanging handler
+	time.Sleep(200 * time.Millisecond)
+
+	engine.Lock()
+	calls := append([]string(nil), engine.calls...)
+	engine.Unlock()
+
+	sort.Strings(calls)
+
+	if fmt.Sprint(calls) != "[failed 1 COMMMIT failed 2 COMMMIT status 3 Confirmed]" {
+		t.Fatalf("expect the panic and timeout reported as failures, got %v", calls)
+	}
+
+	if err := agent.callHandler(agent.resources["/test/Panic"], newCommandEntry(commandFor("4", "/test/Panic")), ParticipantRequest{}); !xerrors.Is(err, ErrPanic) {
+		t.Fatalf("expect ErrPanic, got %v", err)
+	}
+
+	if err := agent.callHandler(agent.resources["/test/Hang"], newCommandEntry(commandFor("5", "/test/Hang")), ParticipantRequest{}); !xerrors.Is(err, ErrTimeout) {
+		t.Fatalf("expect ErrTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package auth bearer token credentials of the engine rpc
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	metadataKey  = "authorization"
+	bearerPrefix = "Bearer "
+)
+
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+// NewTokenCredentials create the per rpc credentials sending token, secure refuse to send it over plain
+// connections
+func NewTokenCredentials(token string, secure bool) credentials.PerRPCCredentials {
+	return &tokenCredentials{
+		token:  token,
+		secure: secure,
+	}
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{metadataKey: bearerPrefix + c.token}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// Token return the bearer token of the incoming grpc call
+func Token(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+
+	if !ok {
+		return "", false
+	}
+
+	for _, value := range md.Get(metadataKey) {
+		if strings.HasPrefix(value, bearerPrefix) {
+			return strings.TrimPrefix(value, bearerPrefix), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,318 @@
+// Package client the initiator side of tcc transactions, grpc client interceptors propagating the txid to the
+// called resources and Run committing or canceling the transaction of a function
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
+	"github.com/gomeshnetwork/gomesh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const apierrScope = "tcc.client"
+
+// errors
+var (
+	ErrInitiator = apierr.WithScope(-1, "tcc server not registered", apierrScope)
+)
+
+// txidKey the gomesh metadata key of the txid
+const txidKey = "gomesh_tcc_txid"
+
+// Initiator create, commit and cancel transactions, implemented by the tcc agent
+type Initiator interface {
+	NewTx(ctx context.Context, parentTxid string) (string, error)
+	Commit(ctx context.Context, txid string) error
+	Cancel(ctx context.Context, txid string) error
+}
+
+type txidContextKey struct{}
+
+// WithTxid bind txid to ctx, the interceptors attach it to the outgoing calls of ctx
+func WithTxid(ctx context.Context, txid string) context.Context {
+	return context.WithValue(ctx, txidContextKey{}, txid)
+}
+
+// Txid the txid bound to ctx, or the txid of the incoming call if ctx is the context of a tcc resource
+func Txid(ctx context.Context) (string, bool) {
+	if txid, ok := ctx.Value(txidContextKey{}).(string); ok {
+		return txid, true
+	}
+
+	return gomesh.TccTxid(ctx)
+}
+
+// TxError the error of the function or the commit of the transaction run by Run
+type TxError struct {
+	Txid string
+	Err  error
+}
+
+func (err *TxError) Error() string {
+	return fmt.Sprintf("tx %s: %s", err.Txid, err.Err)
+}
+
+// GRPCStatus the status of the grpc error wrapped, keep the status code of the failed call
+func (err *TxError) GRPCStatus() *status.Status {
+	return status.Convert(err.Err)
+}
+
+// TxidOf the txid recorded in err by Run
+func TxidOf(err error) (string, bool) {
+	for err != nil {
+		if txErr, ok := err.(*TxError); ok {
+			return txErr.Txid, true
+		}
+
+		cause, ok := err.(xerrors.Error)
+
+		if !ok {
+			return "", false
+		}
+
+		err = cause.Cause()
+	}
+
+	return "", false
+}
+
+// defaultInitiator the registered gomesh tcc server, gomesh panics if not registered
+func defaultInitiator() (initiator Initiator, err error) {
+	defer func() {
+		if recover() != nil {
+			initiator, err = nil, ErrInitiator
+		}
+	}()
+
+	return gomesh.GetTccServer(), nil
+}
+
+// Run run f in the transaction of ctx, or in a new transaction by the registered gomesh tcc server
+func Run(ctx context.Context, f func(ctx context.Context) error) error {
+	initiator, err := defaultInitiator()
+
+	if err != nil {
+		return err
+	}
+
+	return RunWith(ctx, initiator, f)
+}
+
+// RunWith run f in the transaction of ctx, or in a new transaction which is committed if f succeeded,
+// canceled if f returned error or panicked. The error of f or the commit is returned as TxError
+func RunWith(ctx context.Context, initiator Initiator, f func(ctx context.Context) error) (err error) {
+	if txid, ok := Txid(ctx); ok {
+		if err := f(WithTxid(ctx, txid)); err != nil {
+			return &TxError{Txid: txid, Err: err}
+		}
+
+		return nil
+	}
+
+	txid, err := initiator.NewTx(ctx, "")
+
+	if err != nil {
+		return xerrors.Wrapf(err, "create tx error")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			cancelTx(initiator, txid)
+			panic(r)
+		}
+	}()
+
+	if err := f(WithTxid(ctx, txid)); err != nil {
+		if cancelErr := cancelTx(initiator, txid); cancelErr != nil {
+			err = xerrors.Wrapf(err, "cancel error: %s", cancelErr)
+		}
+
+		return &TxError{Txid: txid, Err: err}
+	}
+
+	if err := initiator.Commit(ctx, txid); err != nil {
+		return &TxError{Txid: txid, Err: err}
+	}
+
+	return nil
+}
+
+// cancelTimeout the timeout of the cancel sent after the caller's ctx may be done
+const cancelTimeout = 10 * time.Second
+
+// cancelTx cancel the transaction by a ctx detached from the caller's, the cancel of a done ctx never reaches
+// the engine
+func cancelTx(initiator Initiator, txid string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+
+	return initiator.Cancel(ctx, txid)
+}
+
+// Client the grpc client interceptors
+type Client struct {
+	initiator Initiator
+	methods   map[string]bool
+}
+
+// New create interceptors of initiator, the calls of methods without a transaction run in new transactions
+func New(initiator Initiator, methods ...string) *Client {
+	client := &Client{
+		initiator: initiator,
+		methods:   make(map[string]bool),
+	}
+
+	for _, method := range methods {
+		client.methods[method] = true
+	}
+
+	return client
+}
+
+// outgoing attach txid to the outgoing metadata of ctx
+func outgoing(ctx context.Context, txid string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	if values := md.Get(txidKey); len(values) != 0 && values[0] == txid {
+		return ctx
+	}
+
+	md = md.Copy()
+	md.Set(txidKey, txid)
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientInterceptor attach the txid of ctx to the call, or run the call of the configured methods in a
+// new transaction
+func (client *Client) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+		if txid, ok := Txid(ctx); ok || !client.methods[method] {
+			if ok {
+				ctx = outgoing(ctx, txid)
+			}
+
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		return RunWith(ctx, client.initiator, func(ctx context.Context) error {
+			txid, _ := Txid(ctx)
+			return invoker(outgoing(ctx, txid), method, req, reply, cc, opts...)
+		})
+	}
+}
+
+// StreamClientInterceptor attach the txid of ctx to the stream, or run the stream of the configured methods in
+// a new transaction, committed when the stream ends by io.EOF or by the reply of a stream without server
+// streaming, canceled when it ends by other error or when ctx is done
+func (client *Client) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+		if txid, ok := Txid(ctx); ok || !client.methods[method] {
+			if ok {
+				ctx = outgoing(ctx, txid)
+			}
+
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		txid, err := client.initiator.NewTx(ctx, "")
+
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "create tx error")
+		}
+
+		stream, err := streamer(outgoing(WithTxid(ctx, txid), txid), desc, cc, method, opts...)
+
+		if err != nil {
+			cancelTx(client.initiator, txid)
+			return nil, &TxError{Txid: txid, Err: err}
+		}
+
+		return newTxClientStream(ctx, stream, desc, txid, client.initiator), nil
+	}
+}
+
+// txClientStream end the transaction of the stream when the stream ends
+type txClientStream struct {
+	grpc.ClientStream
+	ctx           context.Context
+	txid          string
+	initiator     Initiator
+	serverStreams bool
+	once          sync.Once
+	done          chan struct{}
+}
+
+func newTxClientStream(ctx context.Context, clientStream grpc.ClientStream, desc *grpc.StreamDesc, txid string,
+	initiator Initiator) *txClientStream {
+
+	stream := &txClientStream{
+		ClientStream:  clientStream,
+		ctx:           ctx,
+		txid:          txid,
+		initiator:     initiator,
+		serverStreams: desc.ServerStreams,
+		done:          make(chan struct{}),
+	}
+
+	go stream.watch()
+
+	return stream
+}
+
+// watch cancel the transaction when ctx is done before the stream ends
+func (stream *txClientStream) watch() {
+	select {
+	case <-stream.ctx.Done():
+		stream.end(stream.ctx.Err())
+	case <-stream.done:
+	}
+}
+
+// end commit the transaction if err is nil, cancel it otherwise, only the first call ends the transaction
+func (stream *txClientStream) end(err error) (endErr error) {
+	stream.once.Do(func() {
+		close(stream.done)
+
+		if err == nil {
+			endErr = stream.initiator.Commit(stream.ctx, stream.txid)
+			return
+		}
+
+		cancelTx(stream.initiator, stream.txid)
+	})
+
+	return
+}
+
+func (stream *txClientStream) RecvMsg(m interface{}) error {
+	err := stream.ClientStream.RecvMsg(m)
+
+	if err == nil && stream.serverStreams {
+		return nil
+	}
+
+	if err != nil && err != io.EOF {
+		stream.end(err)
+		return &TxError{Txid: stream.txid, Err: err}
+	}
+
+	// the stream ends by io.EOF, or by the only reply of a stream without server streaming
+	if endErr := stream.end(nil); endErr != nil {
+		return &TxError{Txid: stream.txid, Err: endErr}
+	}
+
+	return err
+}
@@ -0,0 +1,474 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mockInitiator struct {
+	sync.Mutex
+	calls []string
+	next  int
+}
+
+func (initiator *mockInitiator) record(call string) {
+	initiator.Lock()
+	defer initiator.Unlock()
+	initiator.calls = append(initiator.calls, call)
+}
+
+func (initiator *mockInitiator) NewTx(ctx context.Context, parentTxid string) (string, error) {
+	initiator.Lock()
+	initiator.next++
+	txid := fmt.Sprintf("tx%d", initiator.next)
+	initiator.Unlock()
+
+	initiator.record("new " + txid)
+
+	return txid, nil
+}
+
+func (initiator *mockInitiator) Commit(ctx context.Context, txid string) error {
+	initiator.record("commit " + txid)
+	return nil
+}
+
+func (initiator *mockInitiator) Cancel(ctx context.Context, txid string) error {
+	if ctx.Err() != nil {
+		initiator.record("cancel " + txid + " with done ctx")
+		return ctx.Err()
+	}
+
+	initiator.record("cancel " + txid)
+	return nil
+}
+
+func (initiator *mockInitiator) String() string {
+	initiator.Lock()
+	defer initiator.Unlock()
+	return fmt.Sprint(initiator.calls)
+}
+
+// echoEngine echo the txid of the incoming calls
+type echoEngine struct {
+	tcc.EngineServer
+}
+
+func (engine *echoEngine) NewTx(ctx context.Context, request *tcc.NewTxRequest) (*tcc.NewTxResponse, error) {
+	txid, _ := gomesh.TccTxid(ctx)
+
+	if request.Txid == "fail" {
+		return nil, status.Errorf(codes.FailedPrecondition, "out of stock")
+	}
+
+	return &tcc.NewTxResponse{Txid: txid}, nil
+}
+
+func (engine *echoEngine) AttachAgent(request *tcc.AttachAgentRequest, server tcc.Engine_AttachAgentServer) error {
+	txid, _ := gomesh.TccTxid(server.Context())
+
+	if err := server.Send(&tcc.AgentCommandRequest{Txid: txid}); err != nil {
+		return err
+	}
+
+	if request.Agent == "fail" {
+		return status.Errorf(codes.Aborted, "stream aborted")
+	}
+
+	return nil
+}
+
+// serve dial the server registered by register with the interceptors of client
+func serve(t *testing.T, client *Client, register func(server *grpc.Server)) *grpc.ClientConn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	register(server)
+
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(client.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(client.StreamClientInterceptor()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func serveEcho(t *testing.T, client *Client) tcc.EngineClient {
+	return tcc.NewEngineClient(serve(t, client, func(server *grpc.Server) {
+		tcc.RegisterEngineServer(server, &echoEngine{})
+	}))
+}
+
+// the streams of test.Stream reply the txid of the incoming stream, a request of txid fail aborts the stream
+var (
+	sumStream   = &grpc.StreamDesc{StreamName: "Sum", ClientStreams: true}
+	watchStream = &grpc.StreamDesc{StreamName: "Watch", ServerStreams: true}
+	chatStream  = &grpc.StreamDesc{StreamName: "Chat", ClientStreams: true, ServerStreams: true}
+)
+
+// sum reply once when the client closes the send direction
+func sum(srv interface{}, stream grpc.ServerStream) error {
+	txid, _ := gomesh.TccTxid(stream.Context())
+
+	for {
+		request := &tcc.NewTxRequest{}
+
+		if err := stream.RecvMsg(request); err == io.EOF {
+			return stream.SendMsg(&tcc.NewTxResponse{Txid: txid})
+		} else if err != nil {
+			return err
+		}
+
+		if request.Txid == "fail" {
+			return status.Errorf(codes.Aborted, "stream aborted")
+		}
+	}
+}
+
+// watch reply once then wait for the client to go away
+func watch(srv interface{}, stream grpc.ServerStream) error {
+	txid, _ := gomesh.TccTxid(stream.Context())
+
+	if err := stream.SendMsg(&tcc.NewTxResponse{Txid: txid}); err != nil {
+		return err
+	}
+
+	<-stream.Context().Done()
+
+	return stream.Context().Err()
+}
+
+// chat reply each request
+func chat(srv interface{}, stream grpc.ServerStream) error {
+	txid, _ := gomesh.TccTxid(stream.Context())
+
+	for {
+		request := &tcc.NewTxRequest{}
+
+		if err := stream.RecvMsg(request); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if request.Txid == "fail" {
+			return status.Errorf(codes.Aborted, "stream aborted")
+		}
+
+		if err := stream.SendMsg(&tcc.NewTxResponse{Txid: txid}); err != nil {
+			return err
+		}
+	}
+}
+
+func serveStream(t *testing.T, client *Client) *grpc.ClientConn {
+	return serve(t, client, func(server *grpc.Server) {
+		server.RegisterService(&grpc.ServiceDesc{
+			ServiceName: "test.Stream",
+			HandlerType: (*interface{})(nil),
+			Streams: []grpc.StreamDesc{
+				{StreamName: "Sum", Handler: sum, ClientStreams: true},
+				{StreamName: "Watch", Handler: watch, ServerStreams: true},
+				{StreamName: "Chat", Handler: chat, ClientStreams: true, ServerStreams: true},
+			},
+		}, struct{}{})
+	})
+}
+
+// waitCalls wait for the tx calls ended asynchronously
+func waitCalls(t *testing.T, initiator *mockInitiator, expect string) {
+	for i := 0; i < 100; i++ {
+		if initiator.String() == expect {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expect %s, got %s", expect, initiator.String())
+}
+
+func TestRun(t *testing.T) {
+	initiator := &mockInitiator{}
+	engine := serveEcho(t, New(initiator))
+	ctx := context.Background()
+
+	err := RunWith(ctx, initiator, func(ctx context.Context) error {
+		resp, err := engine.NewTx(ctx, &tcc.NewTxRequest{})
+
+		if err != nil {
+			return err
+		}
+
+		if resp.Txid != "tx1" {
+			return fmt.Errorf("expect txid propagated, got %s", resp.Txid)
+		}
+
+		// joined by the nested run
+		return RunWith(ctx, initiator, func(ctx context.Context) error {
+			resp, err := engine.NewTx(ctx, &tcc.NewTxRequest{})
+
+			if err == nil && resp.Txid != "tx1" {
+				err = fmt.Errorf("expect the nested run joined, got %s", resp.Txid)
+			}
+
+			return err
+		})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RunWith(ctx, initiator, func(ctx context.Context) error {
+		_, err := engine.NewTx(ctx, &tcc.NewTxRequest{Txid: "fail"})
+		return err
+	})
+
+	if txid, ok := TxidOf(err); !ok || txid != "tx2" || status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expect the error of tx2 with the call status, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic")
+			}
+		}()
+
+		RunWith(ctx, initiator, func(ctx context.Context) error {
+			panic("bug")
+		})
+	}()
+
+	// the caller gives up, the tx is still canceled
+	canceled, cancel := context.WithCancel(ctx)
+
+	RunWith(canceled, initiator, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	if calls := initiator.String(); calls != "[new tx1 commit tx1 new tx2 cancel tx2 new tx3 cancel tx3 new tx4 cancel tx4]" {
+		t.Fatalf("unexpected tx calls %s", calls)
+	}
+
+	if _, err := engine.NewTx(ctx, &tcc.NewTxRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(ctx, func(ctx context.Context) error { return nil }); err != ErrInitiator {
+		t.Fatalf("expect ErrInitiator, got %v", err)
+	}
+}
+
+func TestInterceptorTx(t *testing.T) {
+	initiator := &mockInitiator{}
+	engine := serveEcho(t, New(initiator, "/tcc.Engine/NewTx", "/tcc.Engine/AttachAgent"))
+	ctx := context.Background()
+
+	resp, err := engine.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Txid != "tx1" {
+		t.Fatalf("expect the call run in a new tx, got %s", resp.Txid)
+	}
+
+	if _, err := engine.NewTx(ctx, &tcc.NewTxRequest{Txid: "fail"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expect FailedPrecondition, got %v", err)
+	}
+
+	for _, agent := range []string{"ok", "fail"} {
+		stream, err := engine.AttachAgent(ctx, &tcc.AttachAgentRequest{Agent: agent})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cmd, err := stream.Recv()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = stream.Recv()
+
+		if agent == "ok" && err != io.EOF {
+			t.Fatalf("expect EOF, got %v", err)
+		}
+
+		if txid, _ := TxidOf(err); agent == "fail" && (txid != cmd.Txid || status.Code(err) != codes.Aborted) {
+			t.Fatalf("expect the stream error of tx %s, got %v", cmd.Txid, err)
+		}
+	}
+
+	expect := "[new tx1 commit tx1 new tx2 cancel tx2 new tx3 commit tx3 new tx4 cancel tx4]"
+
+	if calls := initiator.String(); calls != expect {
+		t.Fatalf("expect %s, got %s", expect, calls)
+	}
+
+	// the calls in a transaction don't start another
+	err = RunWith(ctx, initiator, func(ctx context.Context) error {
+		resp, err := engine.NewTx(ctx, &tcc.NewTxRequest{})
+
+		if err == nil && resp.Txid != "tx5" {
+			err = errors.New("expect joined tx5, got " + resp.Txid)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterceptorClientStream(t *testing.T) {
+	initiator := &mockInitiator{}
+	conn := serveStream(t, New(initiator, "/test.Stream/Sum"))
+	ctx := context.Background()
+
+	for _, txid := range []string{"ok", "fail"} {
+		stream, err := conn.NewStream(ctx, sumStream, "/test.Stream/Sum")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stream.SendMsg(&tcc.NewTxRequest{Txid: txid}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := &tcc.NewTxResponse{}
+
+		// the reply ends the stream without io.EOF
+		err = stream.RecvMsg(resp)
+
+		if txid == "ok" && (err != nil || resp.Txid != "tx1") {
+			t.Fatalf("expect the reply of tx1, got %v %v", resp, err)
+		}
+
+		if id, _ := TxidOf(err); txid == "fail" && (id != "tx2" || status.Code(err) != codes.Aborted) {
+			t.Fatalf("expect the stream error of tx2, got %v", err)
+		}
+	}
+
+	waitCalls(t, initiator, "[new tx1 commit tx1 new tx2 cancel tx2]")
+}
+
+func TestInterceptorServerStream(t *testing.T) {
+	initiator := &mockInitiator{}
+	conn := serveStream(t, New(initiator, "/test.Stream/Watch"))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream, err := conn.NewStream(ctx, watchStream, "/test.Stream/Watch")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.SendMsg(&tcc.NewTxRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &tcc.NewTxResponse{}
+
+	if err := stream.RecvMsg(resp); err != nil || resp.Txid != "tx1" {
+		t.Fatalf("expect the reply of tx1, got %v %v", resp, err)
+	}
+
+	// the caller gives up the stream without reading it to the end
+	cancel()
+
+	waitCalls(t, initiator, "[new tx1 cancel tx1]")
+
+	if id, _ := TxidOf(stream.RecvMsg(resp)); id != "tx1" {
+		t.Fatalf("expect the stream error of tx1")
+	}
+
+	if calls := initiator.String(); calls != "[new tx1 cancel tx1]" {
+		t.Fatalf("expect the tx ended once, got %s", calls)
+	}
+}
+
+func TestInterceptorBidiStream(t *testing.T) {
+	initiator := &mockInitiator{}
+	conn := serveStream(t, New(initiator, "/test.Stream/Chat"))
+	ctx := context.Background()
+
+	for _, txid := range []string{"ok", "fail"} {
+		stream, err := conn.NewStream(ctx, chatStream, "/test.Stream/Chat")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := stream.SendMsg(&tcc.NewTxRequest{}); err != nil {
+				t.Fatal(err)
+			}
+
+			resp := &tcc.NewTxResponse{}
+
+			// the replies don't end the stream
+			if err := stream.RecvMsg(resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if txid == "fail" {
+			if err := stream.SendMsg(&tcc.NewTxRequest{Txid: txid}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+
+		err = stream.RecvMsg(&tcc.NewTxResponse{})
+
+		if txid == "ok" && err != io.EOF {
+			t.Fatalf("expect EOF, got %v", err)
+		}
+
+		if id, _ := TxidOf(err); txid == "fail" && (id != "tx2" || status.Code(err) != codes.Aborted) {
+			t.Fatalf("expect the stream error of tx2, got %v", err)
+		}
+	}
+
+	waitCalls(t, initiator, "[new tx1 commit tx1 new tx2 cancel tx2]")
+}
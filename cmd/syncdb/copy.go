@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+)
+
+// copyCommand copy all engine tables from one database to another, interrupt with ctrl-c and continue with -resume
+func copyCommand(config config.Config, args []string) int {
+	flags := flag.NewFlagSet("copy", flag.ExitOnError)
+
+	from := flags.String("from", "", "source database as driver,source")
+	to := flags.String("to", "", "target database as driver,source, migrated to the latest version")
+	batch := flags.Int("batch", 500, "rows per batch")
+	resume := flags.Bool("resume", false, "continue the interrupted copy")
+
+	flags.Parse(args)
+
+	if *from == "" || *to == "" || *batch <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	fromDB, err := openDSN(*from)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer fromDB.Close()
+
+	toDB, err := openDSN(*to)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer toDB.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "interrupting, continue later with -resume")
+		cancel()
+	}()
+
+	copier := migration.NewCopier(fromDB, toDB, *batch, *resume)
+
+	copier.Progress = func(table string, rows int64) {
+		fmt.Printf("%s: %d rows copied\n", table, rows)
+	}
+
+	if err := copier.Run(ctx); err != nil {
+		return fatalf("%s", err)
+	}
+
+	fmt.Println("copy finished, row counts and checksums verified")
+
+	return 0
+}
+
+// openDSN open database of driver,source
+func openDSN(dsn string) (*xorm.Engine, error) {
+	i := strings.Index(dsn, ",")
+
+	if i < 0 {
+		return nil, fmt.Errorf("invalid database %s, expect driver,source", dsn)
+	}
+
+	return xorm.NewEngine(dsn[:i], dsn[i+1:])
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+)
+
+// statusCommand print current schema version and all migrations apply status
+func statusCommand(config config.Config, args []string) int {
+	db, err := openDB(config)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer db.Close()
+
+	migrator := migration.New(db)
+
+	current, err := migrator.Current()
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	status, err := migrator.Status()
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	fmt.Printf("current version %d, latest version %d\n", current, migration.Latest())
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "VERSION\tAPPLIED\tDESCRIPTION")
+
+	for _, s := range status {
+		applied := "-"
+
+		if s.Applied {
+			applied = s.AppliedTime.Format("2006-01-02 15:04:05")
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\n", s.Version, applied, s.Description)
+	}
+
+	writer.Flush()
+
+	return 0
+}
+
+// migrateCommand apply migrations up to the target version
+func migrateCommand(config config.Config, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	target := flags.Int("to", -1, "target version, default the latest version")
+	dryRun := flags.Bool("dry-run", false, "print sql without executing")
+
+	flags.Parse(args)
+
+	db, err := openDB(config)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer db.Close()
+
+	sqls, err := migration.New(db).Migrate(*target, *dryRun)
+
+	printSQL(sqls)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	return 0
+}
+
+// rollbackCommand revert migrations down to the target version
+func rollbackCommand(config config.Config, args []string) int {
+	flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+
+	target := flags.Int("to", -1, "target version, default revert the last applied migration")
+	dryRun := flags.Bool("dry-run", false, "print sql without executing")
+
+	flags.Parse(args)
+
+	db, err := openDB(config)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer db.Close()
+
+	migrator := migration.New(db)
+
+	if *target < 0 {
+		status, err := migrator.Status()
+
+		if err != nil {
+			return fatalf("%s", err)
+		}
+
+		*target = 0
+
+		for i := len(status) - 1; i > 0; i-- {
+			if status[i].Applied {
+				*target = status[i-1].Version
+				break
+			}
+		}
+	}
+
+	sqls, err := migrator.Rollback(*target, *dryRun)
+
+	printSQL(sqls)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	return 0
+}
+
+// baselineCommand mark migrations applied for the database created by the old syncdb
+func baselineCommand(config config.Config, args []string) int {
+	flags := flag.NewFlagSet("baseline", flag.ExitOnError)
+
+	version := flags.Int("version", 1, "the schema version of the existing database")
+
+	flags.Parse(args)
+
+	db, err := openDB(config)
+
+	if err != nil {
+		return fatalf("%s", err)
+	}
+
+	defer db.Close()
+
+	if err := migration.New(db).Baseline(*version); err != nil {
+		return fatalf("%s", err)
+	}
+
+	return 0
+}
+
+func printSQL(sqls []string) {
+	for _, sql := range sqls {
+		fmt.Printf("%s;\n", sql)
+	}
+}
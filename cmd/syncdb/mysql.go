@@ -0,0 +1,7 @@
+//go:build mysql
+// +build mysql
+
+package main
+
+// mysql driver is optional, build with `-tags mysql`
+import _ "github.com/go-sql-driver/mysql"
@@ -1,18 +1,87 @@
 package main
 
 import (
-	"github.com/dynamicgo/xxorm/sync"
-	"github.com/gomeshnetwork/tcc/engine"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/envvar"
+	"github.com/dynamicgo/go-config/source/file"
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// command syncdb sub command, return the process exit code
+type command func(config config.Config, args []string) int
+
+var commands = map[string]command{
+	"status":   statusCommand,
+	"migrate":  migrateCommand,
+	"rollback": rollbackCommand,
+	"baseline": baselineCommand,
+	"copy":     copyCommand,
+}
+
 func main() {
-	sync.Register("tcc", func() []interface{} {
-		return []interface{}{
-			new(engine.Transaction),
-			new(engine.Resource),
+	configpath := flag.String("config", "./syncdb.json", "special the syncdb config file")
+
+	flag.Usage = func() {
+		var names []string
+
+		for name := range commands {
+			names = append(names, name)
 		}
-	})
 
-	sync.Run("tcc.syncdb")
+		sort.Strings(names)
+
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: syncdb [options] command [command options]\ncommands: %v\n", names)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	name := "migrate"
+	args := flag.Args()
+
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	command, ok := commands[name]
+
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := config.NewConfig()
+
+	if err := config.Load(envvar.NewSource(envvar.WithPrefix()), file.NewSource(file.WithPath(*configpath))); err != nil {
+		os.Exit(fatalf("load config %s error: %s", *configpath, err))
+	}
+
+	os.Exit(command(config, args))
+}
+
+// openDB open the tcc database of config database.tcc.driver/source
+func openDB(config config.Config) (*xorm.Engine, error) {
+	driver := config.Get("database", "tcc", "driver").String("sqlite3")
+	source := config.Get("database", "tcc", "source").String("./tcc.db")
+
+	db, err := xorm.NewEngine(driver, source)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "open %s database %s error", driver, source)
+	}
+
+	return db, nil
+}
+
+func fatalf(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
 }
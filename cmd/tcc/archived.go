@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gomeshnetwork/tcc"
+)
+
+// archivedCommand lookup archived transactions by txid through engine rpc
+func archivedCommand(args []string) int {
+	flags := flag.NewFlagSet("archived", flag.ExitOnError)
+
+	remote := newRemoteFlags(flags)
+	timeout := flags.Duration("timeout", time.Second*10, "rpc timeout")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: tcc archived [options] txid...\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	conn, err := remote.dial()
+
+	if err != nil {
+		return fatalf("grpc connect to %s error: %s", remote.remote, err)
+	}
+
+	defer conn.Close()
+
+	client := tcc.NewEngineClient(conn)
+
+	for _, txid := range flags.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+
+		resp, err := client.GetArchivedTx(ctx, &tcc.GetArchivedTxRequest{Txid: txid})
+
+		cancel()
+
+		if err != nil {
+			return fatalf("get archived tx %s error: %s", txid, err)
+		}
+
+		buff, err := json.Marshal(resp)
+
+		if err != nil {
+			return fatalf("marshal archived tx %s error: %s", txid, err)
+		}
+
+		fmt.Println(string(buff))
+	}
+
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gomeshnetwork/tcc/auth"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// command tcc sub command, return the process exit code
+type command func(args []string) int
+
+var commands = map[string]command{
+	"archived": archivedCommand,
+	"history":  historyCommand,
+	"export":   exportCommand,
+	"import":   importCommand,
+}
+
+func runCommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	command, ok := commands[os.Args[1]]
+
+	if !ok {
+		return
+	}
+
+	os.Exit(command(os.Args[2:]))
+}
+
+func fatalf(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 1
+}
+
+// remoteFlags the engine address and tls flags of the rpc commands
+type remoteFlags struct {
+	remote string
+	token  string
+	tls    tlsconfig.Config
+}
+
+func newRemoteFlags(flags *flag.FlagSet) *remoteFlags {
+	remote := &remoteFlags{}
+
+	flags.StringVar(&remote.remote, "remote", "127.0.0.1:2100", "tcc engine address")
+	flags.StringVar(&remote.token, "token", os.Getenv("TCC_TOKEN"), "engine bearer token, defaults to $TCC_TOKEN")
+	flags.StringVar(&remote.tls.CA, "ca", "", "ca file to verify the engine certificate, enable tls")
+	flags.StringVar(&remote.tls.Cert, "cert", "", "client certificate file, enable tls")
+	flags.StringVar(&remote.tls.Key, "key", "", "client private key file")
+	flags.StringVar(&remote.tls.ServerName, "server-name", "", "engine certificate name to verify")
+
+	return remote
+}
+
+func (remote *remoteFlags) dial() (*grpc.ClientConn, error) {
+	options := []grpc.DialOption{grpc.WithInsecure()}
+
+	if remote.tls.Enabled() {
+		conf, err := remote.tls.Client()
+
+		if err != nil {
+			return nil, err
+		}
+
+		options = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(conf))}
+	}
+
+	if remote.token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(auth.NewTokenCredentials(remote.token, remote.tls.Enabled())))
+	}
+
+	return grpc.Dial(remote.remote, options...)
+}
@@ -7,7 +7,9 @@ import (
 	_ "github.com/gomeshnetwork/agent/basic"
 	"github.com/gomeshnetwork/gomesh"
 	"github.com/gomeshnetwork/gomesh/app"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
 	"github.com/gomeshnetwork/tcc/engine/services/notifier"
+	"github.com/gomeshnetwork/tcc/engine/services/retention"
 	"github.com/gomeshnetwork/tcc/engine/services/scheduler"
 	"github.com/gomeshnetwork/tcc/engine/services/storage"
 	_ "github.com/lib/pq"
@@ -15,8 +17,20 @@ import (
 
 func main() {
 
+	runCommand()
+
+	handleShutdown()
+
 	gomesh.LocalService("tcc.Scheduler", func(config config.Config) (gomesh.Service, error) {
-		return scheduler.New(config)
+		service, err := scheduler.New(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		closeOnShutdown(service)
+
+		return service, nil
 	})
 
 	gomesh.LocalService("tcc.Snowflake", func(config config.Config) (gomesh.Service, error) {
@@ -24,11 +38,43 @@ func main() {
 	})
 
 	gomesh.LocalService("tcc.Storage", func(config config.Config) (gomesh.Service, error) {
-		return storage.New(config)
+		s, err := storage.New(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		closeOnShutdown(s)
+
+		return storage.Instrument(s), nil
 	})
 
 	gomesh.LocalService("tcc.Notifier", func(config config.Config) (gomesh.Service, error) {
-		return notifier.New(config)
+		service, err := notifier.New(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		closeOnShutdown(service)
+
+		return service, nil
+	})
+
+	gomesh.LocalService("tcc.Retention", func(config config.Config) (gomesh.Service, error) {
+		service, err := retention.New(config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		closeOnShutdown(service)
+
+		return service, nil
+	})
+
+	gomesh.LocalService("tcc.Metrics", func(config config.Config) (gomesh.Service, error) {
+		return metrics.New(config)
 	})
 
 	app.Run("tcc")
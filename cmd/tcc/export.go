@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/dump"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+)
+
+// exportCommand dump transactions with their resources and histories from the engine storage as json lines
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+
+	driver := flags.String("driver", "sqlite3", "storage driver, sqlite3, postgres, mysql or memory")
+	source := flags.String("source", "./tcc.db", "storage source, the snapshot file for the memory driver")
+	output := flags.String("output", "-", "output file, - for stdout")
+	ids := flags.String("ids", "", "comma separated txids")
+	status := flags.String("status", "", "comma separated tx status, e.g. Locked,Confirmed")
+	from := flags.String("from", "", "tx created at or after, RFC3339")
+	to := flags.String("to", "", "tx created before, RFC3339")
+	children := flags.Bool("children", true, "export the child transactions after their parent")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: tcc export [options]\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	filter := engine.TxFilter{}
+
+	if *ids != "" {
+		filter.IDs = strings.Split(*ids, ",")
+	}
+
+	if *status != "" {
+		for _, name := range strings.Split(*status, ",") {
+			value, ok := tcc.TxStatus_value[name]
+
+			if !ok {
+				return fatalf("unknown tx status %s", name)
+			}
+
+			filter.Status = append(filter.Status, tcc.TxStatus(value))
+		}
+	}
+
+	var err error
+
+	if *from != "" {
+		if filter.After, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fatalf("invalid -from %s: %s", *from, err)
+		}
+	}
+
+	if *to != "" {
+		if filter.Before, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fatalf("invalid -to %s: %s", *to, err)
+		}
+	}
+
+	storage, err := openStorage(*driver, *source)
+
+	if err != nil {
+		return fatalf("open storage error: %s", err)
+	}
+
+	defer closeStorage(storage)
+
+	var w io.Writer = os.Stdout
+
+	if *output != "-" {
+		file, err := os.Create(*output)
+
+		if err != nil {
+			return fatalf("create %s error: %s", *output, err)
+		}
+
+		defer file.Close()
+
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+
+	count, err := dump.Export(storage, filter, *children, buffered)
+
+	if err != nil {
+		return fatalf("export error: %s", err)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fatalf("write output error: %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d txs exported\n", count)
+
+	return 0
+}
+
+// openStorage open the engine storage without the engine services
+func openStorage(driver, source string) (engine.Storage, error) {
+	data, err := json.Marshal(map[string]string{
+		"driver":   driver,
+		"source":   source,
+		"snapshot": source,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	conf := config.NewConfig()
+
+	if err := conf.Load(memory.NewSource(memory.WithData(data))); err != nil {
+		return nil, err
+	}
+
+	return storage.New(conf)
+}
+
+// closeStorage write the memory storage snapshot
+func closeStorage(storage engine.Storage) {
+	if closer, ok := storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "close storage error: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gomeshnetwork/tcc"
+)
+
+// historyCommand print the status transition histories of transactions through engine rpc
+func historyCommand(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+
+	remote := newRemoteFlags(flags)
+	timeout := flags.Duration("timeout", time.Second*10, "rpc timeout")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: tcc history [options] txid...\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	conn, err := remote.dial()
+
+	if err != nil {
+		return fatalf("grpc connect to %s error: %s", remote.remote, err)
+	}
+
+	defer conn.Close()
+
+	client := tcc.NewEngineClient(conn)
+
+	for _, txid := range flags.Args() {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+
+		resp, err := client.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: txid})
+
+		cancel()
+
+		if err != nil {
+			return fatalf("get tx %s history error: %s", txid, err)
+		}
+
+		for _, history := range resp.Histories {
+			buff, err := json.Marshal(history)
+
+			if err != nil {
+				return fatalf("marshal tx %s history error: %s", txid, err)
+			}
+
+			fmt.Println(string(buff))
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gomeshnetwork/tcc/engine/dump"
+)
+
+// importCommand load the json lines written by tcc export into the engine storage, keep the ids and times
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+
+	driver := flags.String("driver", "sqlite3", "storage driver, sqlite3, postgres, mysql or memory")
+	source := flags.String("source", "./tcc.db", "storage source, the snapshot file for the memory driver")
+	input := flags.String("input", "-", "input file, - for stdin")
+	skipExisting := flags.Bool("skip-existing", false, "skip the existing txs instead of stopping")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: tcc import [options]\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	var r io.Reader = os.Stdin
+
+	if *input != "-" {
+		file, err := os.Open(*input)
+
+		if err != nil {
+			return fatalf("open %s error: %s", *input, err)
+		}
+
+		defer file.Close()
+
+		r = file
+	}
+
+	storage, err := openStorage(*driver, *source)
+
+	if err != nil {
+		return fatalf("open storage error: %s", err)
+	}
+
+	defer closeStorage(storage)
+
+	imported, skipped, err := dump.Import(storage, bufio.NewReader(r), *skipExisting)
+
+	fmt.Fprintf(os.Stderr, "%d txs imported, %d skipped\n", imported, skipped)
+
+	if err != nil {
+		return fatalf("import error: %s", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// closers services closed on shutdown, e.g. the memory storage writing its snapshot and the service loops
+var closers struct {
+	sync.Mutex
+	services []interface{ Close() error }
+}
+
+func closeOnShutdown(service interface{}) {
+	closer, ok := service.(interface{ Close() error })
+
+	if !ok {
+		return
+	}
+
+	closers.Lock()
+	defer closers.Unlock()
+
+	closers.services = append(closers.services, closer)
+}
+
+// handleShutdown close the services in reverse order on SIGINT or SIGTERM, then terminate the process by the signal
+func handleShutdown() {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+
+		closers.Lock()
+
+		for i := len(closers.services) - 1; i >= 0; i-- {
+			if err := closers.services[i].Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "close service error: %s\n", err)
+			}
+		}
+
+		closers.Unlock()
+
+		// restore default behavior and redeliver the signal to terminate process
+		signal.Reset(sig)
+
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(sig)
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+// Package dump export and import engine transactions as json lines of engine.TxRecord
+package dump
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// pageSize default transactions loaded per storage query
+const pageSize = 100
+
+const apierrScope = "tcc.dump"
+
+// errors
+var (
+	ErrRecord = apierr.WithScope(-1, "invalid export record", apierrScope)
+)
+
+type exporter struct {
+	storage  engine.Storage
+	encoder  *json.Encoder
+	children bool
+	seen     map[string]bool
+}
+
+// Export write the live transactions matched by filter with their resources and histories to w, one record
+// per line, the child transactions follow their parent if children, filter.Limit is the query page size,
+// return the exported record count
+func Export(storage engine.Storage, filter engine.TxFilter, children bool, w io.Writer) (int, error) {
+	exporter := &exporter{
+		storage:  storage,
+		encoder:  json.NewEncoder(w),
+		children: children,
+		seen:     make(map[string]bool),
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = pageSize
+	}
+
+	for {
+		txs, err := storage.QueryTx(&filter)
+
+		if err != nil {
+			return len(exporter.seen), err
+		}
+
+		if len(txs) == 0 {
+			return len(exporter.seen), nil
+		}
+
+		for _, tx := range txs {
+			if err := exporter.export(tx); err != nil {
+				return len(exporter.seen), err
+			}
+		}
+
+		filter.AfterID = txs[len(txs)-1].ID
+	}
+}
+
+func (exporter *exporter) export(tx *engine.Transaction) error {
+	if exporter.seen[tx.ID] {
+		return nil
+	}
+
+	exporter.seen[tx.ID] = true
+
+	resources, err := exporter.storage.GetResourceByTx(tx.ID)
+
+	if err != nil {
+		return err
+	}
+
+	histories, err := exporter.storage.GetTxHistory(tx.ID)
+
+	if err != nil {
+		return err
+	}
+
+	record := &engine.TxRecord{
+		Tx:        tx,
+		Resources: resources,
+		Histories: histories,
+	}
+
+	if err := exporter.encoder.Encode(record); err != nil {
+		return xerrors.Wrapf(err, "write tx %s error", tx.ID)
+	}
+
+	if !exporter.children {
+		return nil
+	}
+
+	children, err := exporter.storage.QueryTx(&engine.TxFilter{PIDs: []string{tx.ID}})
+
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err := exporter.export(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import load the records exported by Export from r into storage, the existing transactions are skipped if
+// skipExisting otherwise the import stops with gomesh.ErrExists, return the imported and skipped record count
+func Import(storage engine.Storage, r io.Reader, skipExisting bool) (imported int, skipped int, err error) {
+	decoder := json.NewDecoder(r)
+
+	for {
+		record := &engine.TxRecord{}
+
+		if err := decoder.Decode(record); err != nil {
+			if err == io.EOF {
+				return imported, skipped, nil
+			}
+
+			return imported, skipped, xerrors.Wrapf(err, "decode record %d error", imported+skipped+1)
+		}
+
+		if record.Tx == nil {
+			return imported, skipped, xerrors.Wrapf(ErrRecord, "record %d without tx", imported+skipped+1)
+		}
+
+		if err := storage.ImportTx(record); err != nil {
+			if skipExisting && xerrors.Is(err, gomesh.ErrExists) {
+				skipped++
+				continue
+			}
+
+			return imported, skipped, xerrors.Wrapf(err, "import tx %s error", record.Tx.ID)
+		}
+
+		imported++
+	}
+}
@@ -0,0 +1,193 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+)
+
+func newSQLiteStorage(t *testing.T) engine.Storage {
+	dir, err := ioutil.TempDir("", "tcc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := fmt.Sprintf("file:%s?_busy_timeout=5000", filepath.Join(dir, "tcc.db"))
+
+	db, err := xorm.NewEngine("sqlite3", source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migration.New(db).Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	conf := config.NewConfig()
+
+	data := fmt.Sprintf(`{"driver":"sqlite3","source":%q}`, source)
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := storage.New(conf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage
+}
+
+func prepare(t *testing.T, storage engine.Storage) {
+	txs := []*engine.Transaction{
+		{ID: "1", Status: tcc.TxStatus_Created},
+		{ID: "2", Status: tcc.TxStatus_Created},
+		{ID: "3", PID: "1", Status: tcc.TxStatus_Created},
+		{ID: "4", PID: "3", Status: tcc.TxStatus_Created},
+	}
+
+	for _, tx := range txs {
+		history := &engine.History{
+			ID: "H_C" + tx.ID, Event: engine.HistoryCreate, Node: "node", ActorType: engine.ActorInitiator, Actor: "127.0.0.1",
+		}
+
+		if err := storage.NewTx(tx, history); err != nil {
+			t.Fatal(err)
+		}
+
+		resource := &engine.Resource{
+			ID: "R_" + tx.ID, Tx: tx.ID, Require: "rid", Agent: "agent", Resource: "/test/Lock", Status: tcc.TxStatus_Locked,
+		}
+
+		if err := storage.NewResource(resource, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := &engine.History{ID: "H_T1", Event: engine.HistoryTransit, ActorType: engine.ActorAdmin, Error: "manual"}
+
+	if err := storage.UpdateTxStatus(txs[0], tcc.TxStatus_Confirmed, history); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func export(t *testing.T, storage engine.Storage, filter engine.TxFilter, children bool) (string, int) {
+	var buff bytes.Buffer
+
+	count, err := Export(storage, filter, children, &buff)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buff.String(), count
+}
+
+func TestRoundTrip(t *testing.T) {
+	from := newSQLiteStorage(t)
+	to := newSQLiteStorage(t)
+
+	prepare(t, from)
+
+	exported, count := export(t, from, engine.TxFilter{Limit: 3}, false)
+
+	if count != 4 {
+		t.Fatalf("expect 4 txs exported, got %d", count)
+	}
+
+	imported, skipped, err := Import(to, bytes.NewBufferString(exported), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imported != 4 || skipped != 0 {
+		t.Fatalf("expect 4 txs imported, got %d imported %d skipped", imported, skipped)
+	}
+
+	if reexported, _ := export(t, to, engine.TxFilter{}, false); reexported != exported {
+		t.Fatalf("expect lossless round trip, exported:\n%s\nreexported:\n%s", exported, reexported)
+	}
+
+	tx, err := to.GetTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Status != tcc.TxStatus_Confirmed || tx.Version != 2 || tx.CreatedTime.IsZero() {
+		t.Fatalf("unexpect imported tx %v", tx)
+	}
+
+	if _, _, err := Import(to, bytes.NewBufferString(exported), false); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect ErrExists for imported txs, got %v", err)
+	}
+
+	imported, skipped, err = Import(to, bytes.NewBufferString(exported), true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imported != 0 || skipped != 4 {
+		t.Fatalf("expect 4 txs skipped, got %d imported %d skipped", imported, skipped)
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	storage := newSQLiteStorage(t)
+
+	prepare(t, storage)
+
+	if _, count := export(t, storage, engine.TxFilter{IDs: []string{"1"}}, false); count != 1 {
+		t.Fatalf("expect 1 tx exported by id, got %d", count)
+	}
+
+	exported, count := export(t, storage, engine.TxFilter{IDs: []string{"1"}}, true)
+
+	if count != 3 {
+		t.Fatalf("expect tx 1 exported with descendants, got %d", count)
+	}
+
+	if lines := bytes.Split(bytes.TrimSpace([]byte(exported)), []byte("\n")); len(lines) != 3 ||
+		!bytes.Contains(lines[2], []byte(`"ID":"4"`)) {
+		t.Fatalf("expect descendants follow the parent, got\n%s", exported)
+	}
+
+	filter := engine.TxFilter{Status: []tcc.TxStatus{tcc.TxStatus_Created}}
+
+	if _, count := export(t, storage, filter, false); count != 3 {
+		t.Fatalf("expect 3 created txs exported, got %d", count)
+	}
+
+	if _, count := export(t, storage, engine.TxFilter{Before: time.Now().Add(-time.Hour)}, false); count != 0 {
+		t.Fatalf("expect no tx created an hour ago, got %d", count)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	storage := newSQLiteStorage(t)
+
+	if _, _, err := Import(storage, bytes.NewBufferString(`{"resources":[]}`), false); !xerrors.Is(err, ErrRecord) {
+		t.Fatalf("expect ErrRecord for record without tx, got %v", err)
+	}
+}
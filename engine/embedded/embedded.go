@@ -0,0 +1,202 @@
+package embedded
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	config "github.com/dynamicgo/go-config"
+	extend "github.com/dynamicgo/go-config-extend"
+	"github.com/dynamicgo/injector"
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/agent"
+	"github.com/gomeshnetwork/tcc/engine/services/notifier"
+	"github.com/gomeshnetwork/tcc/engine/services/retention"
+	"github.com/gomeshnetwork/tcc/engine/services/scheduler"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const apierrScope = "tcc.embedded"
+
+// errors
+var (
+	ErrClosed = apierr.WithScope(-1, "embedded engine stopped", apierrScope)
+)
+
+func init() {
+	agent.RegisterEmbedded(func(config config.Config) (agent.EmbeddedEngine, error) {
+		return New(config)
+	})
+}
+
+// newStorage create the instrumented storage
+func newStorage(conf config.Config) (interface{}, error) {
+	s, err := storage.New(conf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.Instrument(s), nil
+}
+
+type runnable interface {
+	Start() error
+}
+
+// factory create the service name with the config key
+type factory struct {
+	name string
+	key  string
+	f    func(conf config.Config) (interface{}, error)
+}
+
+// factories of the engine services in the start order
+var factories = []factory{
+	{"tcc.Storage", "storage", newStorage},
+	{"tcc.Notifier", "notifier", func(conf config.Config) (interface{}, error) { return notifier.New(conf) }},
+	{"tcc.Scheduler", "scheduler", func(conf config.Config) (interface{}, error) { return scheduler.New(conf) }},
+	{"tcc.Retention", "retention", func(conf config.Config) (interface{}, error) { return retention.New(conf) }},
+}
+
+// Engine the scheduler, storage and notifier services of cmd/tcc running in-process
+type Engine struct {
+	slf4go.Logger                   // mixin logger
+	server        *grpc.Server      // engine grpc server
+	listener      *bufconn.Listener // in-memory listener of Dial
+	scheduler     tcc.EngineServer  // scheduler service
+	closers       []func() error    // services closed by Stop in reverse start order
+	once          sync.Once         // stop once
+}
+
+// New create and start the in-process engine, the services read the config of cmd/tcc from the keys storage,
+// scheduler, notifier and retention, the snowflake node from snode
+func New(config config.Config) (*Engine, error) {
+	snode, err := snowflake.NewNode(int64(config.Get("snode").Int(0)))
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "create snowflake node error")
+	}
+
+	context := injector.New()
+
+	context.Register("tcc.Snowflake", snode)
+
+	embedded := &Engine{
+		Logger:   slf4go.Get("tcc-embedded"),
+		listener: bufconn.Listen(1 << 20),
+	}
+
+	var services []interface{}
+
+	for _, factory := range factories {
+		subconfig, err := extend.SubConfig(config, factory.key)
+
+		if err != nil {
+			embedded.close()
+			return nil, xerrors.Wrapf(err, "load service %s config error", factory.name)
+		}
+
+		service, err := factory.f(subconfig)
+
+		if err != nil {
+			embedded.close()
+			return nil, xerrors.Wrapf(err, "create service %s error", factory.name)
+		}
+
+		if closer, ok := service.(interface{ Close() error }); ok {
+			embedded.closers = append(embedded.closers, closer.Close)
+		}
+
+		if scheduler, ok := service.(tcc.EngineServer); ok {
+			embedded.scheduler = scheduler
+		}
+
+		context.Register(factory.name, service)
+		services = append(services, service)
+	}
+
+	for i, service := range services {
+		if err := context.Bind(service); err != nil {
+			embedded.close()
+			return nil, xerrors.Wrapf(err, "service %s bind error", factories[i].name)
+		}
+	}
+
+	for i, service := range services {
+		if runnable, ok := service.(runnable); ok {
+			if err := runnable.Start(); err != nil {
+				embedded.close()
+				return nil, xerrors.Wrapf(err, "start service %s error", factories[i].name)
+			}
+		}
+	}
+
+	embedded.server = grpc.NewServer()
+
+	tcc.RegisterEngineServer(embedded.server, embedded.scheduler)
+
+	go embedded.Serve(embedded.listener)
+
+	return embedded, nil
+}
+
+// Serve serve the engine rpc on listener too, for the agents of other processes
+func (embedded *Engine) Serve(listener net.Listener) error {
+	if err := embedded.server.Serve(listener); err != nil {
+		embedded.ErrorF("embedded engine serve %s error: %s", listener.Addr(), err)
+		return err
+	}
+
+	return nil
+}
+
+// Dial create the in-memory grpc connection to the engine
+func (embedded *Engine) Dial(options ...grpc.DialOption) (*grpc.ClientConn, error) {
+	options = append(options, grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return embedded.dial()
+	}))
+
+	conn, err := grpc.Dial("embedded", options...)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "dial embedded engine error")
+	}
+
+	return conn, nil
+}
+
+// dial create the in-memory connection accepted by the engine grpc server
+func (embedded *Engine) dial() (net.Conn, error) {
+	conn, err := embedded.listener.Dial()
+
+	if err != nil {
+		return nil, ErrClosed
+	}
+
+	return conn, nil
+}
+
+// Stop the grpc server and close the services in reverse start order
+func (embedded *Engine) Stop() {
+	embedded.once.Do(func() {
+		embedded.server.Stop()
+		embedded.close()
+	})
+}
+
+func (embedded *Engine) close() {
+	embedded.listener.Close()
+
+	for i := len(embedded.closers) - 1; i >= 0; i-- {
+		if err := embedded.closers[i](); err != nil {
+			embedded.ErrorF("close embedded engine service error: %s", err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/gomeshnetwork/tcc/agent"
+	"google.golang.org/grpc/metadata"
+)
+
+const engineConfig = `{"storage":{"driver":"memory"},"notifier":{"reload":"100ms"}}`
+
+type stock struct {
+	confirmed chan string
+	canceled  chan string
+}
+
+func (s *stock) Try(ctx context.Context) error {
+	return nil
+}
+
+func (s *stock) Confirm(ctx context.Context, request agent.ConfirmRequest) error {
+	s.confirmed <- request.Txid
+	return nil
+}
+
+func (s *stock) Cancel(ctx context.Context, request agent.CancelRequest) error {
+	s.canceled <- request.Txid
+	return nil
+}
+
+func newTestConfig(t *testing.T, data string) config.Config {
+	conf := config.NewConfig()
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func startAgent(t *testing.T, remote string) (agent.Agent, *stock) {
+	a := agent.New()
+
+	s := &stock{
+		confirmed: make(chan string, 1),
+		canceled:  make(chan string, 1),
+	}
+
+	if err := a.RegisterResource("stock", s); err != nil {
+		t.Fatal(err)
+	}
+
+	attached := make(chan struct{}, 1)
+
+	a.OnStateChange(func(state agent.State) {
+		if state.Attached {
+			select {
+			case attached <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	conf := newTestConfig(t, fmt.Sprintf(`{"gomesh":{"tcc":{"id":"agent","remote":"%s","embedded":%s}}}`, remote, engineConfig))
+
+	if err := a.Start(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-attached:
+	case <-time.After(time.Second * 5):
+		t.Fatal("agent not attached")
+	}
+
+	return a, s
+}
+
+func expectTx(t *testing.T, calls chan string, txid string) {
+	select {
+	case called := <-calls:
+		if called != txid {
+			t.Fatalf("expect tx %s, got %s", txid, called)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("wait tx %s timeout", txid)
+	}
+}
+
+// runTx lock the stock resource in a new tx then commit or cancel it
+func runTx(t *testing.T, a agent.Agent, s *stock, commit bool) {
+	txid, err := a.NewTx(context.Background(), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("gomesh_tcc_txid", txid))
+
+	if _, err := a.Try(ctx, "stock", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if commit {
+		if err := a.Commit(ctx, txid); err != nil {
+			t.Fatal(err)
+		}
+
+		expectTx(t, s.confirmed, txid)
+	} else {
+		if err := a.Cancel(ctx, txid); err != nil {
+			t.Fatal(err)
+		}
+
+		expectTx(t, s.canceled, txid)
+	}
+}
+
+func runSuite(t *testing.T, a agent.Agent, s *stock) {
+	runTx(t, a, s, true)
+	runTx(t, a, s, false)
+
+	if err := a.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	a, s := startAgent(t, agent.EmbeddedRemote)
+
+	runSuite(t, a, s)
+}
+
+func TestNetworked(t *testing.T) {
+	engine, err := New(newTestConfig(t, engineConfig))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer engine.Stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go engine.Serve(listener)
+
+	a, s := startAgent(t, listener.Addr().String())
+
+	runSuite(t, a, s)
+}
+
+// engineGoroutines the stacks of the goroutines running or created by the engine packages
+func engineGoroutines() []string {
+	buff := make([]byte, 1<<20)
+
+	var stacks []string
+
+	for _, stack := range strings.Split(string(buff[:runtime.Stack(buff, true)]), "\n\n") {
+		if strings.Contains(stack, "gomeshnetwork/tcc/engine/") {
+			stacks = append(stacks, stack)
+		}
+	}
+
+	return stacks
+}
+
+func TestStop(t *testing.T) {
+	conf := newTestConfig(t, `{"storage":{"driver":"memory"},"notifier":{"reload":"100ms"},
+		"retention":{"interval":"100ms","confirmed":"1h"},"scheduler":{"batch":{"size":8}}}`)
+
+	before := len(engineGoroutines())
+
+	engine, err := New(conf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(engineGoroutines()) == before {
+		t.Fatal("expect the engine goroutines started")
+	}
+
+	engine.Stop()
+
+	if _, err := engine.dial(); err != ErrClosed {
+		t.Fatalf("expect closed error, got %v", err)
+	}
+
+	// the reload, retention, batcher and grpc server goroutines exit
+	for i := 0; len(engineGoroutines()) > before; i++ {
+		if i == 100 {
+			t.Fatalf("expect no goroutine leaked, got:\n%s", strings.Join(engineGoroutines(), "\n\n"))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -3,16 +3,25 @@ package engine
 import (
 	"time"
 
+	"github.com/dynamicgo/xerrors/apierr"
 	"github.com/gomeshnetwork/tcc"
 )
 
+const apierrScope = "tcc.engine"
+
+// errors
+var (
+	ErrConflict = apierr.WithScope(-1, "the row version changed by concurrent update", apierrScope)
+)
+
 // Transaction .
 type Transaction struct {
-	ID          string       `xorm:"pk"`      // txid
-	PID         string       `xorm:"index"`   // parent txid
-	Status      tcc.TxStatus `xorm:"index"`   // transaction status
-	CreatedTime time.Time    `xorm:"created"` // create time
-	UpdatedTime time.Time    `xorm:"updated"` // updated time
+	ID          string       `xorm:"pk"`                // txid
+	PID         string       `xorm:"index"`             // parent txid
+	Status      tcc.TxStatus `xorm:"index"`             // transaction status
+	Version     int64        `xorm:"notnull default 1"` // optimistic lock version
+	CreatedTime time.Time    `xorm:"created"`           // create time
+	UpdatedTime time.Time    `xorm:"updated"`           // updated time
 }
 
 // TableName .
@@ -20,16 +29,18 @@ func (table *Transaction) TableName() string {
 	return "tcc_engine_transaction"
 }
 
-// Resource tcc resource status table
+// Resource tcc resource status table, the unique index columns are sized
+// to fit the mysql index key length limit with utf8mb4
 type Resource struct {
-	ID          string       `xorm:"pk"`                       // txid
-	Tx          string       `xorm:"unique(tx_req_agent_res)"` // resource bind transaction
-	Require     string       `xorm:"unique(tx_req_agent_res)"` // resource require id
-	Agent       string       `xorm:"unique(tx_req_agent_res)"` // resource require agent id
-	Resource    string       `xorm:"unique(tx_req_agent_res)"` // resource require agent id
-	Status      tcc.TxStatus `xorm:"index"`                    // transaction status
-	CreatedTime time.Time    `xorm:"created"`                  // create time
-	UpdatedTime time.Time    `xorm:"updated"`                  // updated time
+	ID          string       `xorm:"varchar(64) pk"`                        // txid
+	Tx          string       `xorm:"varchar(64) unique(tx_req_agent_res)"`  // resource bind transaction
+	Require     string       `xorm:"varchar(64) unique(tx_req_agent_res)"`  // resource require id
+	Agent       string       `xorm:"varchar(128) unique(tx_req_agent_res)"` // resource require agent id
+	Resource    string       `xorm:"varchar(255) unique(tx_req_agent_res)"` // resource require agent id
+	Status      tcc.TxStatus `xorm:"index"`                                 // transaction status
+	Version     int64        `xorm:"notnull default 1"`                     // optimistic lock version
+	CreatedTime time.Time    `xorm:"created"`                               // create time
+	UpdatedTime time.Time    `xorm:"updated"`                               // updated time
 }
 
 // TableName .
@@ -37,15 +48,152 @@ func (table *Resource) TableName() string {
 	return "tcc_engine_resource"
 }
 
-// Storage .
+// ArchivedTransaction archived finished transaction table
+type ArchivedTransaction struct {
+	Transaction  `xorm:"extends"`
+	ArchivedTime time.Time `xorm:"index"` // archive time
+}
+
+// TableName .
+func (table *ArchivedTransaction) TableName() string {
+	return "tcc_engine_transaction_archive"
+}
+
+// ArchivedResource archived resource table of finished transaction
+type ArchivedResource struct {
+	Resource     `xorm:"extends"`
+	ArchivedTime time.Time `xorm:"index"` // archive time
+}
+
+// TableName .
+func (table *ArchivedResource) TableName() string {
+	return "tcc_engine_resource_archive"
+}
+
+// history events
+const (
+	HistoryCreate    = "create"    // transaction or resource created
+	HistoryTransit   = "transit"   // status changed
+	HistoryRedeliver = "redeliver" // status change requested again with the current status
+	HistoryReject    = "reject"    // status change rejected, see History.Error
+	HistoryFail      = "fail"      // resource require failed and canceled, or command handler failed, see History.Error
+)
+
+// history actor types
+const (
+	ActorInitiator   = "initiator"   // the agent begin and commit/cancel transaction
+	ActorParticipant = "participant" // the agent lock and confirm/cancel resource
+	ActorAdmin       = "admin"       // operator
+	ActorNotifier    = "notifier"    // the engine resend command to the agent, the actor is the target agent
+)
+
+// History append-only transaction and resource status transition table
+type History struct {
+	ID          string       `xorm:"varchar(64) pk"`    // history id
+	Tx          string       `xorm:"varchar(64) index"` // transaction id
+	Resource    string       `xorm:"varchar(64)"`       // resource id, empty for transaction history
+	Event       string       `xorm:"varchar(16)"`       // history event
+	FromStatus  tcc.TxStatus // status before
+	ToStatus    tcc.TxStatus // status after or requested
+	Node        string       `xorm:"varchar(128)"` // engine node
+	ActorType   string       `xorm:"varchar(16)"`  // actor type
+	Actor       string       `xorm:"varchar(255)"` // actor agent id or address
+	Error       string       `xorm:"text"`         // reject reason
+	CreatedTime time.Time    `xorm:"created"`      // create time
+}
+
+// TableName .
+func (table *History) TableName() string {
+	return "tcc_engine_history"
+}
+
+// ArchivedHistory archived history table of finished transaction
+type ArchivedHistory struct {
+	History      `xorm:"extends"`
+	ArchivedTime time.Time `xorm:"index"` // archive time
+}
+
+// TableName .
+func (table *ArchivedHistory) TableName() string {
+	return "tcc_engine_history_archive"
+}
+
+// Tables return all tables of the engine storage
+func Tables() []interface{} {
+	return []interface{}{
+		new(Transaction),
+		new(Resource),
+		new(ArchivedTransaction),
+		new(ArchivedResource),
+		new(History),
+		new(ArchivedHistory),
+	}
+}
+
+// TxFilter query transactions filter, the zero value fields are ignored
+type TxFilter struct {
+	IDs     []string       // transaction ids
+	PIDs    []string       // parent transaction ids
+	Status  []tcc.TxStatus // transaction status
+	After   time.Time      // created at or after
+	Before  time.Time      // created before
+	AfterID string         // transaction id greater than, for paging in id order
+	Limit   int            // max transactions returned
+}
+
+// TxRecord transaction with its resources and histories, used to export and import engine state
+type TxRecord struct {
+	Tx        *Transaction `json:"tx"`
+	Resources []*Resource  `json:"resources"`
+	Histories []*History   `json:"histories"`
+}
+
+// ResourceWrite one write of Storage.WriteResources, insert Resource if not Update, otherwise update
+// the Resource status to Status as UpdateResourceStatus
+type ResourceWrite struct {
+	Resource *Resource
+	Update   bool
+	Status   tcc.TxStatus
+	History  *History
+}
+
+// Storage the history arguments of the write methods may be nil, otherwise the history is filled with
+// the transaction, resource and status, then written atomically with the row
 type Storage interface {
-	NewTx(tx *Transaction) error
-	UpdateTxStatus(id string, status tcc.TxStatus) (bool, error)
-	NewResource(resource *Resource) error
-	UpdateResourceStatus(txid, agent, resource, rid string, status tcc.TxStatus) error
-	UpdateResourcesStatus(txid, agent, resource string, status tcc.TxStatus) error
+	NewTx(tx *Transaction, history *History) error
+	// GetTx get transaction by id, return nil if not found
+	GetTx(id string) (*Transaction, error)
+	// UpdateTxStatus compare and swap tx status on tx.Version, return ErrConflict if the row version changed,
+	// on success tx status and version are updated in place
+	UpdateTxStatus(tx *Transaction, status tcc.TxStatus, history *History) error
+	NewResource(resource *Resource, history *History) error
+	// GetResource get resource by (txid, rid, agent, resource), return nil if not found
+	GetResource(txid, rid, agent, resource string) (*Resource, error)
+	// UpdateResourceStatus compare and swap resource status on resource.Version, see UpdateTxStatus
+	UpdateResourceStatus(resource *Resource, status tcc.TxStatus, history *History) error
+	// WriteResources apply the writes in one database transaction if possible, return the error of each write,
+	// a failed write doesn't affect the others
+	WriteResources(writes []*ResourceWrite) []error
+	// AppendHistory append history without status change
+	AppendHistory(history *History) error
+	// GetTxHistory get the live or archived histories of transaction in order
+	GetTxHistory(id string) ([]*History, error)
+	// QueryTx query live transactions in id order
+	QueryTx(filter *TxFilter) ([]*Transaction, error)
+	// ImportTx insert the record rows as is atomically, keep the ids, versions and timestamps
+	ImportTx(record *TxRecord) error
 	GetResourceByTx(id string) ([]*Resource, error)
 	QueryNotifyTx(agent string) ([]*Transaction, error)
+	// QueryFinishedTx query transactions of status updated before the time which all resources are confirmed or canceled
+	// and all child transactions are finished
+	QueryFinishedTx(status tcc.TxStatus, before time.Time, limit int) ([]*Transaction, error)
+	// ArchiveTx move transactions still finished and their resources and histories into archive tables,
+	// return the count of archived transactions
+	ArchiveTx(ids []string) (int, error)
+	// DeleteTx delete transactions still finished and their resources and histories, return the count of deleted transactions
+	DeleteTx(ids []string) (int, error)
+	// GetArchivedTx get archived transaction and resources, return nil transaction if not found
+	GetArchivedTx(id string) (*ArchivedTransaction, []*ArchivedResource, error)
 }
 
 // Notifier .
@@ -54,3 +202,9 @@ type Notifier interface {
 	CancelTx(id string)
 	RunAgent(agent string, server tcc.Engine_AttachAgentServer)
 }
+
+// Retention archive or delete finished transactions
+type Retention interface {
+	// RunOnce run one retention round and return the handled transaction count
+	RunOnce() (int, error)
+}
@@ -0,0 +1,44 @@
+package metrics
+
+// the engine metrics, the names and labels are stable
+var (
+	// Transactions the transaction events: created, confirmed, canceled and timeout
+	Transactions = newCounterVec("tcc_transactions_total",
+		"transactions created, committed, canceled and canceled by the session timeout", "event")
+	// ConfirmSeconds the latency from the tx commit until all its resources confirmed
+	ConfirmSeconds = newHistogram("tcc_transaction_confirm_seconds",
+		"latency from the tx commit until all its resources confirmed")
+	// AgentInstances the attached command streams of each agent id
+	AgentInstances = newGaugeVec("tcc_agent_instances",
+		"attached command streams of the agent", "agent")
+	// QueueDepth the commands queued for each agent
+	QueueDepth = newGaugeVec("tcc_notifier_queue_depth",
+		"commands queued for the agent command stream", "agent", "command")
+	// Redeliveries the commands sent again by the notifier reload
+	Redeliveries = newCounterVec("tcc_notifier_redeliveries_total",
+		"commands sent again by the notifier reload", "agent")
+	// DeadLetters the commands dropped by the notifier and left to the reload, or failed permanently by the agent
+	DeadLetters = newCounterVec("tcc_notifier_dead_letters_total",
+		"commands dropped by the notifier and left to the reload, or failed permanently by the agent", "agent", "reason")
+	// StorageSeconds the storage operation latencies
+	StorageSeconds = newHistogramVec("tcc_storage_operation_seconds",
+		"storage operation latency", "operation")
+	// StorageErrors the failed storage operations
+	StorageErrors = newCounterVec("tcc_storage_errors_total",
+		"failed storage operations", "operation")
+)
+
+// transaction events
+const (
+	EventCreated   = "created"
+	EventConfirmed = "confirmed"
+	EventCanceled  = "canceled"
+	EventTimeout   = "timeout"
+)
+
+// dead letter reasons
+const (
+	ReasonNotAttached = "not_attached" // no command stream of the agent
+	ReasonClosed      = "closed"       // the command stream closed while queueing
+	ReasonFailed      = "failed"       // the agent handler failed permanently, the resource moved to Failed
+)
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Default the registry of the engine metrics, with the go runtime and process collectors
+var Default = prometheus.NewRegistry()
+
+func init() {
+	Default.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+// Handler the http handler serving the Default metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+func newCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+
+	Default.MustRegister(counter)
+
+	return counter
+}
+
+func newGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+
+	Default.MustRegister(gauge)
+
+	return gauge
+}
+
+func newHistogram(name, help string) prometheus.Histogram {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: prometheus.DefBuckets,
+	})
+
+	Default.MustRegister(histogram)
+
+	return histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+
+	Default.MustRegister(histogram)
+
+	return histogram
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEngineMetrics the names, types and labels of the engine metrics are stable
+func TestEngineMetrics(t *testing.T) {
+	Transactions.WithLabelValues(EventCreated).Inc()
+	ConfirmSeconds.Observe(0.1)
+	AgentInstances.WithLabelValues("agent").Inc()
+	QueueDepth.WithLabelValues("agent", "commit").Inc()
+	Redeliveries.WithLabelValues("agent").Inc()
+	DeadLetters.WithLabelValues("agent", ReasonNotAttached).Inc()
+	StorageSeconds.WithLabelValues("GetTx").Observe(0.1)
+	StorageErrors.WithLabelValues("GetTx").Inc()
+
+	recorder := httptest.NewRecorder()
+
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+
+	for _, line := range []string{
+		"# TYPE tcc_transactions_total counter",
+		`tcc_transactions_total{event="created"} `,
+		"# TYPE tcc_transaction_confirm_seconds histogram",
+		`tcc_transaction_confirm_seconds_bucket{le="0.25"} `,
+		"# TYPE tcc_agent_instances gauge",
+		`tcc_agent_instances{agent="agent"} `,
+		"# TYPE tcc_notifier_queue_depth gauge",
+		`tcc_notifier_queue_depth{agent="agent",command="commit"} `,
+		"# TYPE tcc_notifier_redeliveries_total counter",
+		`tcc_notifier_redeliveries_total{agent="agent"} `,
+		"# TYPE tcc_notifier_dead_letters_total counter",
+		`tcc_notifier_dead_letters_total{agent="agent",reason="not_attached"} `,
+		"# TYPE tcc_storage_operation_seconds histogram",
+		`tcc_storage_operation_seconds_count{operation="GetTx"} `,
+		"# TYPE tcc_storage_errors_total counter",
+		`tcc_storage_errors_total{operation="GetTx"} `,
+		"# TYPE go_goroutines gauge",
+	} {
+		if !strings.Contains(body, "\n"+line) && !strings.HasPrefix(body, line) {
+			t.Fatalf("metric line %q not found in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+)
+
+type serviceImpl struct {
+	slf4go.Logger        // mixin logger
+	laddr         string // http listen address
+	path          string // metrics http path
+}
+
+// New create the service serving the Default registry over http
+func New(config config.Config) (gomesh.RunnableService, error) {
+	return &serviceImpl{
+		Logger: slf4go.Get("tcc-metrics"),
+		laddr:  config.Get("laddr").String(":2110"),
+		path:   config.Get("path").String("/metrics"),
+	}, nil
+}
+
+func (service *serviceImpl) Start() error {
+	listener, err := net.Listen("tcp", service.laddr)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "create metrics listener %s error", service.laddr)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(service.path, Handler())
+
+	service.InfoF("serve metrics on %s%s", listener.Addr(), service.path)
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			service.ErrorF("metrics serve error: %s", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// CopyCheckpoint copy progress of one table, saved in the target database with each batch
+type CopyCheckpoint struct {
+	Table       string    `xorm:"varchar(128) pk"` // copied table name
+	LastID      string    `xorm:"varchar(255)"`    // the last copied primary key in source order
+	Copied      int64     // copied rows
+	UpdatedTime time.Time `xorm:"updated"` // updated time
+}
+
+// TableName .
+func (table *CopyCheckpoint) TableName() string {
+	return "copy_checkpoint"
+}
+
+// Copier copy all engine tables between two databases of the latest schema version
+type Copier struct {
+	slf4go.Logger
+	from     *xorm.Engine
+	to       *xorm.Engine
+	batch    int
+	resume   bool
+	Progress func(table string, rows int64) // called after each batch committed
+}
+
+// NewCopier create copier, resume continue from the checkpoints of the interrupted copy
+func NewCopier(from, to *xorm.Engine, batch int, resume bool) *Copier {
+	return &Copier{
+		Logger: slf4go.Get("tcc.migration.copy"),
+		from:   from,
+		to:     to,
+		batch:  batch,
+		resume: resume,
+	}
+}
+
+// Run copy all tables then verify row counts and checksums, the checkpoints are removed after verified
+func (copier *Copier) Run(ctx context.Context) error {
+	if err := Check(copier.from); err != nil {
+		return xerrors.Wrapf(err, "check source schema error")
+	}
+
+	if err := Check(copier.to); err != nil {
+		return xerrors.Wrapf(err, "check target schema error")
+	}
+
+	if err := copier.to.Sync2(new(CopyCheckpoint)); err != nil {
+		return xerrors.Wrapf(err, "create copy_checkpoint error")
+	}
+
+	for _, bean := range engine.Tables() {
+		if err := copier.copyTable(ctx, bean); err != nil {
+			return err
+		}
+	}
+
+	if err := copier.Verify(); err != nil {
+		return err
+	}
+
+	if err := copier.to.DropTables(new(CopyCheckpoint)); err != nil {
+		return xerrors.Wrapf(err, "drop copy_checkpoint error")
+	}
+
+	return nil
+}
+
+func (copier *Copier) checkpoint(name string) (*CopyCheckpoint, error) {
+	checkpoint := &CopyCheckpoint{Table: name}
+
+	ok, err := copier.to.Get(checkpoint)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "load checkpoint of %s error", name)
+	}
+
+	if ok && !copier.resume {
+		return nil, xerrors.Wrapf(ErrCopyTarget, "checkpoint of %s exists, resume the interrupted copy", name)
+	}
+
+	if ok {
+		copier.InfoF("resume copy %s after %s, copied %d", name, checkpoint.LastID, checkpoint.Copied)
+		return checkpoint, nil
+	}
+
+	count, err := copier.to.Table(name).Count()
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "count target %s error", name)
+	}
+
+	if count != 0 {
+		return nil, xerrors.Wrapf(ErrCopyTarget, "target %s not empty", name)
+	}
+
+	return checkpoint, nil
+}
+
+func (copier *Copier) copyTable(ctx context.Context, bean interface{}) error {
+	table := copier.from.TableInfo(bean)
+
+	checkpoint, err := copier.checkpoint(table.Name)
+
+	if err != nil {
+		return err
+	}
+
+	fresh := checkpoint.Copied == 0 && checkpoint.LastID == ""
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Wrapf(err, "copy %s interrupted", table.Name)
+		}
+
+		rows, err := copier.load(copier.from, bean, checkpoint.LastID, copier.batch)
+
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			copier.InfoF("copy %s finished, copied %d", table.Name, checkpoint.Copied)
+			return nil
+		}
+
+		checkpoint.LastID = primaryKey(table, rows[len(rows)-1])
+		checkpoint.Copied += int64(len(rows))
+
+		if err := copier.save(rows, checkpoint, fresh); err != nil {
+			return err
+		}
+
+		fresh = false
+
+		if copier.Progress != nil {
+			copier.Progress(table.Name, checkpoint.Copied)
+		}
+	}
+}
+
+// load rows after the primary key in primary key order
+func (copier *Copier) load(db *xorm.Engine, bean interface{}, after string, limit int) ([]interface{}, error) {
+	name := db.TableName(bean)
+
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(bean)))
+
+	err := db.Where(fmt.Sprintf("%s > ?", db.Quote("i_d")), after).Asc("i_d").Limit(limit).Find(rows.Interface())
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "load %s after %s error", name, after)
+	}
+
+	result := make([]interface{}, 0, rows.Elem().Len())
+
+	for i := 0; i < rows.Elem().Len(); i++ {
+		result = append(result, rows.Elem().Index(i).Interface())
+	}
+
+	return result, nil
+}
+
+// save insert rows and the checkpoint in one target session transaction
+func (copier *Copier) save(rows []interface{}, checkpoint *CopyCheckpoint, fresh bool) error {
+	session := copier.to.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return xerrors.Wrapf(err, "copy begin session error")
+	}
+
+	// the statement options are reset after each insert, keep the row times with NoAutoTime row by row
+	for _, row := range rows {
+		if _, err := session.NoAutoTime().InsertOne(row); err != nil {
+			session.Rollback()
+			return xerrors.Wrapf(err, "copy insert %s error", checkpoint.Table)
+		}
+	}
+
+	var err error
+
+	if fresh {
+		_, err = session.InsertOne(checkpoint)
+	} else {
+		_, err = session.ID(checkpoint.Table).Cols("last_i_d", "copied").Update(checkpoint)
+	}
+
+	if err != nil {
+		session.Rollback()
+		return xerrors.Wrapf(err, "save checkpoint of %s error", checkpoint.Table)
+	}
+
+	if err := session.Commit(); err != nil {
+		return xerrors.Wrapf(err, "copy commit session error")
+	}
+
+	return nil
+}
+
+// Verify compare row counts and checksums of all tables between source and target
+func (copier *Copier) Verify() error {
+	for _, bean := range engine.Tables() {
+		name := copier.from.TableName(bean)
+
+		fromRows, fromSum, err := copier.checksum(copier.from, bean)
+
+		if err != nil {
+			return err
+		}
+
+		toRows, toSum, err := copier.checksum(copier.to, bean)
+
+		if err != nil {
+			return err
+		}
+
+		if fromRows != toRows || fromSum != toSum {
+			return xerrors.Wrapf(ErrMismatch, "table %s rows %d/%d checksum %016x/%016x", name, fromRows, toRows, fromSum, toSum)
+		}
+
+		copier.InfoF("verify %s rows %d checksum %016x", name, fromRows, fromSum)
+	}
+
+	return nil
+}
+
+// checksum the sum of all row digests, independent of the row order which depends on the database collation
+func (copier *Copier) checksum(db *xorm.Engine, bean interface{}) (int64, uint64, error) {
+	table := db.TableInfo(bean)
+
+	var count int64
+	var sum uint64
+
+	after := ""
+
+	for {
+		rows, err := copier.load(db, bean, after, copier.batch)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if len(rows) == 0 {
+			return count, sum, nil
+		}
+
+		for _, row := range rows {
+			digest, err := rowDigest(table, row)
+
+			if err != nil {
+				return 0, 0, err
+			}
+
+			sum += digest
+		}
+
+		count += int64(len(rows))
+		after = primaryKey(table, rows[len(rows)-1])
+	}
+}
+
+func primaryKey(table *xorm.Table, row interface{}) string {
+	value, _ := table.GetColumn("i_d").ValueOf(row)
+	return value.String()
+}
+
+// rowDigest hash all column values, the times are compared in unix seconds since the datetime precision and
+// time zone differ between databases
+func rowDigest(table *xorm.Table, row interface{}) (uint64, error) {
+	hash := sha256.New()
+
+	for _, column := range table.Columns() {
+		value, err := column.ValueOf(row)
+
+		if err != nil {
+			return 0, xerrors.Wrapf(err, "get %s.%s value error", table.Name, column.Name)
+		}
+
+		if t, ok := value.Interface().(time.Time); ok {
+			fmt.Fprintf(hash, "%s=%d;", column.Name, t.Unix())
+			continue
+		}
+
+		fmt.Fprintf(hash, "%s=%v;", column.Name, value.Interface())
+	}
+
+	return binary.BigEndian.Uint64(hash.Sum(nil)), nil
+}
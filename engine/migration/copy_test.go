@@ -0,0 +1,172 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+func newMigratedEngine(t *testing.T) *xorm.Engine {
+	db := newTestEngine(t)
+
+	if _, err := New(db).Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func prepareCopySource(t *testing.T, db *xorm.Engine, txs int) {
+	created := time.Now().Add(-time.Hour)
+
+	for i := 0; i < txs; i++ {
+		tx := &engine.Transaction{
+			ID:          fmt.Sprintf("%04d", i),
+			Status:      tcc.TxStatus(i % 4),
+			Version:     int64(i%3 + 1),
+			CreatedTime: created,
+			UpdatedTime: created,
+		}
+
+		if _, err := db.NoAutoTime().InsertOne(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		resource := &engine.Resource{
+			ID:       fmt.Sprintf("R_%04d", i),
+			Tx:       tx.ID,
+			Require:  "rid",
+			Agent:    "agent",
+			Resource: "/test/Lock",
+			Status:   tx.Status,
+			Version:  1,
+		}
+
+		if _, err := db.InsertOne(resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archived := &engine.ArchivedTransaction{
+		Transaction:  engine.Transaction{ID: "archived", Status: tcc.TxStatus_Confirmed, Version: 2},
+		ArchivedTime: time.Now(),
+	}
+
+	if _, err := db.InsertOne(archived); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, db *xorm.Engine, bean interface{}) int64 {
+	count, err := db.Count(bean)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestCopy(t *testing.T) {
+	from := newMigratedEngine(t)
+	to := newMigratedEngine(t)
+
+	prepareCopySource(t, from, 25)
+
+	if err := NewCopier(from, to, 10, false).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := count(t, to, new(engine.Transaction)); c != 25 {
+		t.Fatalf("expect 25 txs copied, got %d", c)
+	}
+
+	if c := count(t, to, new(engine.ArchivedTransaction)); c != 1 {
+		t.Fatalf("expect 1 archived tx copied, got %d", c)
+	}
+
+	source := &engine.Transaction{ID: "0005"}
+	tx := &engine.Transaction{ID: "0005"}
+
+	if ok, err := from.Get(source); err != nil || !ok {
+		t.Fatalf("get source tx error: %v", err)
+	}
+
+	if ok, err := to.Get(tx); err != nil || !ok {
+		t.Fatalf("get copied tx error: %v", err)
+	}
+
+	if tx.Status != tcc.TxStatus_Locked || tx.Version != 3 || !tx.CreatedTime.Equal(source.CreatedTime) {
+		t.Fatalf("unexpect copied tx %v, source %v", tx, source)
+	}
+
+	if ok, _ := to.IsTableExist(new(CopyCheckpoint)); ok {
+		t.Fatalf("expect checkpoint removed after copy verified")
+	}
+
+	if err := NewCopier(from, to, 10, false).Run(context.Background()); !xerrors.Is(err, ErrCopyTarget) {
+		t.Fatalf("expect ErrCopyTarget for not empty target, got %v", err)
+	}
+}
+
+func TestCopyResume(t *testing.T) {
+	from := newMigratedEngine(t)
+	to := newMigratedEngine(t)
+
+	prepareCopySource(t, from, 25)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	copier := NewCopier(from, to, 10, false)
+
+	copier.Progress = func(table string, rows int64) {
+		if table == "tcc_engine_resource" && rows >= 10 {
+			cancel()
+		}
+	}
+
+	if err := copier.Run(ctx); !xerrors.Is(err, context.Canceled) {
+		t.Fatalf("expect copy interrupted, got %v", err)
+	}
+
+	if c := count(t, to, new(engine.Resource)); c != 10 {
+		t.Fatalf("expect 10 resources copied before interrupted, got %d", c)
+	}
+
+	if err := NewCopier(from, to, 10, false).Run(context.Background()); !xerrors.Is(err, ErrCopyTarget) {
+		t.Fatalf("expect ErrCopyTarget without resume, got %v", err)
+	}
+
+	if err := NewCopier(from, to, 10, true).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := count(t, to, new(engine.Resource)); c != 25 {
+		t.Fatalf("expect 25 resources copied after resume, got %d", c)
+	}
+}
+
+func TestCopyVerifyMismatch(t *testing.T) {
+	from := newMigratedEngine(t)
+	to := newMigratedEngine(t)
+
+	prepareCopySource(t, from, 5)
+
+	if err := NewCopier(from, to, 10, false).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := to.ID("0001").Cols("status").Update(&engine.Transaction{Status: tcc.TxStatus_Timeout}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewCopier(from, to, 10, false).Verify(); !xerrors.Is(err, ErrMismatch) {
+		t.Fatalf("expect ErrMismatch for changed row, got %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+// Package migration versioned schema migrations of the engine sql storage
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+)
+
+const apierrScope = "tcc.migration"
+
+// errors
+var (
+	ErrOutdated   = apierr.WithScope(-1, "database schema is older than expected", apierrScope)
+	ErrLegacy     = apierr.WithScope(-2, "database schema created without schema_version", apierrScope)
+	ErrVersion    = apierr.WithScope(-3, "unknown schema version", apierrScope)
+	ErrCopyTarget = apierr.WithScope(-4, "copy target not empty or has checkpoint", apierrScope)
+	ErrMismatch   = apierr.WithScope(-5, "copy verify rows mismatch", apierrScope)
+)
+
+// SchemaVersion applied migration record table
+type SchemaVersion struct {
+	Version     int       `xorm:"pk"`      // migration version
+	Description string    `xorm:"text"`    // migration description
+	AppliedTime time.Time `xorm:"created"` // apply time
+}
+
+// TableName .
+func (table *SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Migration one schema change step, Up and Down generate the sql statements for the engine dialect
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(engine *xorm.Engine) []string
+	Down        func(engine *xorm.Engine) []string
+}
+
+// Status migration apply status
+type Status struct {
+	*Migration
+	Applied     bool
+	AppliedTime time.Time
+}
+
+// Migrator apply migrations to database
+type Migrator struct {
+	slf4go.Logger
+	engine     *xorm.Engine
+	migrations []*Migration
+}
+
+// New create migrator of the engine storage migrations
+func New(engine *xorm.Engine) *Migrator {
+	return &Migrator{
+		Logger:     slf4go.Get("tcc.migration"),
+		engine:     engine,
+		migrations: migrations,
+	}
+}
+
+// Latest the latest migration version the engine expected
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Check return ErrOutdated if the database schema version is older than Latest
+func Check(engine *xorm.Engine) error {
+	current, err := New(engine).Current()
+
+	if err != nil {
+		return err
+	}
+
+	if current < Latest() {
+		return xerrors.Wrapf(ErrOutdated, "schema version %d, expect %d, run syncdb migrate", current, Latest())
+	}
+
+	return nil
+}
+
+func (migrator *Migrator) tableExists(bean interface{}) (bool, error) {
+	ok, err := migrator.engine.IsTableExist(bean)
+
+	if err != nil {
+		return false, xerrors.Wrapf(err, "check table %s exists error", migrator.engine.TableName(bean))
+	}
+
+	return ok, nil
+}
+
+func (migrator *Migrator) applied() ([]*SchemaVersion, error) {
+	ok, err := migrator.tableExists(new(SchemaVersion))
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	versions := make([]*SchemaVersion, 0)
+
+	if err := migrator.engine.Asc("version").Find(&versions); err != nil {
+		return nil, xerrors.Wrapf(err, "load schema_version error")
+	}
+
+	return versions, nil
+}
+
+// Current return the current schema version, 0 means empty database
+func (migrator *Migrator) Current() (int, error) {
+	versions, err := migrator.applied()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(versions) == 0 {
+		if err := migrator.checkLegacy(); err != nil {
+			return 0, err
+		}
+
+		return 0, nil
+	}
+
+	return versions[len(versions)-1].Version, nil
+}
+
+// checkLegacy refuse to migrate tables created by the sync2 based syncdb
+func (migrator *Migrator) checkLegacy() error {
+	ok, err := migrator.tableExists(legacyProbe)
+
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return xerrors.Wrapf(ErrLegacy, "table %s exists, run syncdb baseline <version>", migrator.engine.TableName(legacyProbe))
+	}
+
+	return nil
+}
+
+// Status return all migrations status
+func (migrator *Migrator) Status() ([]*Status, error) {
+	versions, err := migrator.applied()
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexer := make(map[int]*SchemaVersion)
+
+	for _, version := range versions {
+		indexer[version.Version] = version
+	}
+
+	status := make([]*Status, 0, len(migrator.migrations))
+
+	for _, migration := range migrator.migrations {
+		s := &Status{Migration: migration}
+
+		if version, ok := indexer[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedTime = version.AppliedTime
+		}
+
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+func (migrator *Migrator) checkTarget(target int) error {
+	if target == 0 {
+		return nil
+	}
+
+	for _, migration := range migrator.migrations {
+		if migration.Version == target {
+			return nil
+		}
+	}
+
+	return xerrors.Wrapf(ErrVersion, "migration version %d not found", target)
+}
+
+// Migrate apply migrations up to target version, target < 0 means Latest, return the sql statements executed
+// or to be executed if dryRun
+func (migrator *Migrator) Migrate(target int, dryRun bool) ([]string, error) {
+	if target < 0 {
+		target = Latest()
+	}
+
+	if err := migrator.checkTarget(target); err != nil {
+		return nil, err
+	}
+
+	current, err := migrator.Current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sqls []string
+
+	ok, err := migrator.tableExists(new(SchemaVersion))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		sqls = append(sqls, createTable(migrator.engine, new(SchemaVersion))...)
+
+		if !dryRun {
+			if err := migrator.exec(sqls); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, migration := range migrator.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+
+		statements := migration.Up(migrator.engine)
+
+		sqls = append(sqls, statements...)
+
+		if dryRun {
+			continue
+		}
+
+		migrator.InfoF("migrate up %d %s", migration.Version, migration.Description)
+
+		err := migrator.apply(statements, func(session *xorm.Session) error {
+			_, err := session.InsertOne(&SchemaVersion{Version: migration.Version, Description: migration.Description})
+			return err
+		})
+
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "migrate up %d error", migration.Version)
+		}
+	}
+
+	return sqls, nil
+}
+
+// Rollback revert migrations down to target version, return the sql statements executed or to be executed if dryRun
+func (migrator *Migrator) Rollback(target int, dryRun bool) ([]string, error) {
+	if err := migrator.checkTarget(target); err != nil {
+		return nil, err
+	}
+
+	current, err := migrator.Current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sqls []string
+
+	for i := len(migrator.migrations) - 1; i >= 0; i-- {
+		migration := migrator.migrations[i]
+
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		statements := migration.Down(migrator.engine)
+
+		sqls = append(sqls, statements...)
+
+		if dryRun {
+			continue
+		}
+
+		migrator.InfoF("migrate down %d %s", migration.Version, migration.Description)
+
+		err := migrator.apply(statements, func(session *xorm.Session) error {
+			_, err := session.Delete(&SchemaVersion{Version: migration.Version})
+			return err
+		})
+
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "migrate down %d error", migration.Version)
+		}
+	}
+
+	return sqls, nil
+}
+
+// Baseline mark migrations up to version applied without executing them, used to adopt the database created by
+// the sync2 based syncdb
+func (migrator *Migrator) Baseline(version int) error {
+	if err := migrator.checkTarget(version); err != nil {
+		return err
+	}
+
+	if err := migrator.engine.Sync2(new(SchemaVersion)); err != nil {
+		return xerrors.Wrapf(err, "create schema_version error")
+	}
+
+	versions, err := migrator.applied()
+
+	if err != nil {
+		return err
+	}
+
+	if len(versions) != 0 {
+		return xerrors.Wrapf(ErrVersion, "schema_version not empty, current version %d", versions[len(versions)-1].Version)
+	}
+
+	for _, migration := range migrator.migrations {
+		if migration.Version > version {
+			break
+		}
+
+		_, err := migrator.engine.InsertOne(&SchemaVersion{Version: migration.Version, Description: migration.Description})
+
+		if err != nil {
+			return xerrors.Wrapf(err, "baseline %d error", migration.Version)
+		}
+	}
+
+	return nil
+}
+
+func (migrator *Migrator) exec(sqls []string) error {
+	for _, sql := range sqls {
+		if _, err := migrator.engine.Exec(sql); err != nil {
+			return xerrors.Wrapf(err, "exec %s error", sql)
+		}
+	}
+
+	return nil
+}
+
+// apply execute statements and update schema_version in one session transaction, the mysql ddl statements
+// commit implicitly
+func (migrator *Migrator) apply(sqls []string, record func(session *xorm.Session) error) error {
+	session := migrator.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return xerrors.Wrapf(err, "begin session error")
+	}
+
+	for _, sql := range sqls {
+		if _, err := session.Exec(sql); err != nil {
+			session.Rollback()
+			return xerrors.Wrapf(err, "exec %s error", sql)
+		}
+	}
+
+	if err := record(session); err != nil {
+		session.Rollback()
+		return xerrors.Wrapf(err, "update schema_version error")
+	}
+
+	if err := session.Commit(); err != nil {
+		return xerrors.Wrapf(err, "commit session error")
+	}
+
+	return nil
+}
+
+// createTable generate create table and indexes sql of the bean
+func createTable(engine *xorm.Engine, bean interface{}) []string {
+	table := engine.TableInfo(bean)
+	dialect := engine.Dialect()
+
+	sqls := []string{strings.TrimSpace(dialect.CreateTableSql(table.Table, table.Name, "", ""))}
+
+	names := make([]string, 0, len(table.Indexes))
+
+	for name := range table.Indexes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		sqls = append(sqls, strings.TrimSpace(dialect.CreateIndexSql(table.Name, table.Indexes[name])))
+	}
+
+	return sqls
+}
+
+// dropTable generate drop table sql
+func dropTable(engine *xorm.Engine, bean interface{}) []string {
+	return []string{strings.TrimSpace(engine.Dialect().DropTableSql(engine.TableName(bean)))}
+}
+
+// addColumn generate add column sql
+func addColumn(engine *xorm.Engine, table string, column *core.Column) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s", engine.Quote(table), strings.TrimSpace(column.StringNoPk(engine.Dialect())))
+}
+
+// dropColumn generate drop column sql
+func dropColumn(engine *xorm.Engine, table string, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", engine.Quote(table), engine.Quote(column))
+}
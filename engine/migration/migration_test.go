@@ -0,0 +1,197 @@
+package migration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestEngine(t *testing.T) *xorm.Engine {
+	dir, err := ioutil.TempDir("", "tcc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := xorm.NewEngine("sqlite3", filepath.Join(dir, "tcc.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	return db
+}
+
+func current(t *testing.T, migrator *Migrator) int {
+	version, err := migrator.Current()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestMigrateRollback(t *testing.T) {
+	db := newTestEngine(t)
+	migrator := New(db)
+
+	if err := Check(db); !xerrors.Is(err, ErrOutdated) {
+		t.Fatalf("expect ErrOutdated for empty database, got %v", err)
+	}
+
+	if _, err := migrator.Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := current(t, migrator); version != Latest() {
+		t.Fatalf("expect version %d, got %d", Latest(), version)
+	}
+
+	if err := Check(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// the migrated schema must cover all columns of the engine tables
+	for _, bean := range engine.Tables() {
+		table := db.TableInfo(bean)
+
+		for _, column := range table.Columns() {
+			ok, err := db.Dialect().IsColumnExist(table.Name, column.Name)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ok {
+				t.Fatalf("column %s.%s not migrated", table.Name, column.Name)
+			}
+		}
+	}
+
+	if _, err := db.InsertOne(&engine.Transaction{ID: "1", Status: tcc.TxStatus_Created, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Rollback(1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := current(t, migrator); version != 1 {
+		t.Fatalf("expect version 1 after rollback, got %d", version)
+	}
+
+	if ok, _ := db.IsTableExist(new(engine.ArchivedTransaction)); ok {
+		t.Fatalf("expect archive table dropped")
+	}
+
+	if count, err := db.Table("tcc_engine_transaction").Count(); err != nil || count != 1 {
+		t.Fatalf("expect tx rows kept after rollback, got %d %v", count, err)
+	}
+
+	if _, err := migrator.Rollback(0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := current(t, migrator); version != 0 {
+		t.Fatalf("expect version 0 after rollback, got %d", version)
+	}
+
+	if _, err := migrator.Migrate(2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := migrator.Status()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range status {
+		if s.Applied != (s.Version <= 2) {
+			t.Fatalf("unexpect migration %d applied %v", s.Version, s.Applied)
+		}
+	}
+
+	if _, err := migrator.Migrate(100, false); !xerrors.Is(err, ErrVersion) {
+		t.Fatalf("expect ErrVersion for unknown target, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	db := newTestEngine(t)
+	migrator := New(db)
+
+	sqls, err := migrator.Migrate(-1, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqls) == 0 {
+		t.Fatalf("expect dry run return migrate sql")
+	}
+
+	if ok, _ := db.IsTableExist(new(SchemaVersion)); ok {
+		t.Fatalf("expect dry run not create schema_version")
+	}
+
+	if _, err := migrator.Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	sqls, err = migrator.Rollback(0, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqls) == 0 {
+		t.Fatalf("expect dry run return rollback sql")
+	}
+
+	if version := current(t, migrator); version != Latest() {
+		t.Fatalf("expect dry run rollback keep version %d, got %d", Latest(), version)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	db := newTestEngine(t)
+	migrator := New(db)
+
+	if err := db.Sync2(new(transactionV1), new(resourceV1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Migrate(-1, false); !xerrors.Is(err, ErrLegacy) {
+		t.Fatalf("expect ErrLegacy for database created by sync2, got %v", err)
+	}
+
+	if err := migrator.Baseline(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := current(t, migrator); version != Latest() {
+		t.Fatalf("expect version %d, got %d", Latest(), version)
+	}
+
+	if err := migrator.Baseline(1); !xerrors.Is(err, ErrVersion) {
+		t.Fatalf("expect ErrVersion for baseline on versioned database, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+)
+
+// the table definitions below are frozen copies of the engine tables at the migration version,
+// never change them, append a new migration instead
+
+type transactionV1 struct {
+	ID          string       `xorm:"pk"`
+	PID         string       `xorm:"index"`
+	Status      tcc.TxStatus `xorm:"index"`
+	CreatedTime time.Time    `xorm:"created"`
+	UpdatedTime time.Time    `xorm:"updated"`
+}
+
+func (table *transactionV1) TableName() string {
+	return "tcc_engine_transaction"
+}
+
+type resourceV1 struct {
+	ID          string       `xorm:"varchar(64) pk"`
+	Tx          string       `xorm:"varchar(64) unique(tx_req_agent_res)"`
+	Require     string       `xorm:"varchar(64) unique(tx_req_agent_res)"`
+	Agent       string       `xorm:"varchar(128) unique(tx_req_agent_res)"`
+	Resource    string       `xorm:"varchar(255) unique(tx_req_agent_res)"`
+	Status      tcc.TxStatus `xorm:"index"`
+	CreatedTime time.Time    `xorm:"created"`
+	UpdatedTime time.Time    `xorm:"updated"`
+}
+
+func (table *resourceV1) TableName() string {
+	return "tcc_engine_resource"
+}
+
+type archivedTransactionV2 struct {
+	transactionV1 `xorm:"extends"`
+	ArchivedTime  time.Time `xorm:"index"`
+}
+
+func (table *archivedTransactionV2) TableName() string {
+	return "tcc_engine_transaction_archive"
+}
+
+type archivedResourceV2 struct {
+	resourceV1   `xorm:"extends"`
+	ArchivedTime time.Time `xorm:"index"`
+}
+
+func (table *archivedResourceV2) TableName() string {
+	return "tcc_engine_resource_archive"
+}
+
+type historyV4 struct {
+	ID          string `xorm:"varchar(64) pk"`
+	Tx          string `xorm:"varchar(64) index"`
+	Resource    string `xorm:"varchar(64)"`
+	Event       string `xorm:"varchar(16)"`
+	FromStatus  tcc.TxStatus
+	ToStatus    tcc.TxStatus
+	Node        string    `xorm:"varchar(128)"`
+	ActorType   string    `xorm:"varchar(16)"`
+	Actor       string    `xorm:"varchar(255)"`
+	Error       string    `xorm:"text"`
+	CreatedTime time.Time `xorm:"created"`
+}
+
+func (table *historyV4) TableName() string {
+	return "tcc_engine_history"
+}
+
+type archivedHistoryV4 struct {
+	historyV4    `xorm:"extends"`
+	ArchivedTime time.Time `xorm:"index"`
+}
+
+func (table *archivedHistoryV4) TableName() string {
+	return "tcc_engine_history_archive"
+}
+
+// legacyProbe the table created by every syncdb version
+var legacyProbe = new(transactionV1)
+
+var versionTablesV3 = []string{
+	"tcc_engine_transaction",
+	"tcc_engine_resource",
+	"tcc_engine_transaction_archive",
+	"tcc_engine_resource_archive",
+}
+
+func versionColumnV3() *core.Column {
+	return &core.Column{
+		Name:    "version",
+		SQLType: core.SQLType{Name: core.BigInt},
+		Default: "1",
+	}
+}
+
+var migrations = []*Migration{
+	{
+		Version:     1,
+		Description: "create transaction and resource tables",
+		Up: func(engine *xorm.Engine) []string {
+			return append(createTable(engine, new(transactionV1)), createTable(engine, new(resourceV1))...)
+		},
+		Down: func(engine *xorm.Engine) []string {
+			return append(dropTable(engine, new(resourceV1)), dropTable(engine, new(transactionV1))...)
+		},
+	},
+	{
+		Version:     2,
+		Description: "create archive tables",
+		Up: func(engine *xorm.Engine) []string {
+			return append(createTable(engine, new(archivedTransactionV2)), createTable(engine, new(archivedResourceV2))...)
+		},
+		Down: func(engine *xorm.Engine) []string {
+			return append(dropTable(engine, new(archivedResourceV2)), dropTable(engine, new(archivedTransactionV2))...)
+		},
+	},
+	{
+		Version:     3,
+		Description: "add optimistic lock version columns",
+		Up: func(engine *xorm.Engine) []string {
+			var sqls []string
+
+			for _, table := range versionTablesV3 {
+				sqls = append(sqls, addColumn(engine, table, versionColumnV3()))
+			}
+
+			return sqls
+		},
+		Down: func(engine *xorm.Engine) []string {
+			var sqls []string
+
+			for _, table := range versionTablesV3 {
+				sqls = append(sqls, dropColumn(engine, table, "version"))
+			}
+
+			return sqls
+		},
+	},
+	{
+		Version:     4,
+		Description: "create history tables",
+		Up: func(engine *xorm.Engine) []string {
+			return append(createTable(engine, new(historyV4)), createTable(engine, new(archivedHistoryV4))...)
+		},
+		Down: func(engine *xorm.Engine) []string {
+			return append(dropTable(engine, new(archivedHistoryV4)), dropTable(engine, new(historyV4))...)
+		},
+	},
+}
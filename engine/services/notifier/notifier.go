@@ -2,14 +2,17 @@ package notifier
 
 import (
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/bwmarrin/snowflake"
 	config "github.com/dynamicgo/go-config"
 	"github.com/dynamicgo/slf4go"
 	"github.com/dynamicgo/xerrors"
 	"github.com/gomeshnetwork/tcc"
 	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
 )
 
 type agentServer struct {
@@ -24,9 +27,14 @@ type notifierImpl struct {
 	slf4go.Logger  // logger
 	agents         map[string]*agentServer
 	cachesize      int
-	Storage        engine.Storage `inject:"tcc.Storage"`
+	node           string          // engine node name recorded in redelivery histories
+	SNode          *snowflake.Node `inject:"tcc.Snowflake"`
+	Storage        engine.Storage  `inject:"tcc.Storage"`
 	reloadTimeout  time.Duration
 	sessionTimeout time.Duration
+	closed         chan struct{}  // closed by Close to stop reload
+	closeOnce      sync.Once      // close once
+	wg             sync.WaitGroup // wait reload exit
 }
 
 // New .
@@ -34,29 +42,47 @@ func New(config config.Config) (engine.Notifier, error) {
 
 	cachesize := config.Get("cached").Int(1024)
 
+	hostname, _ := os.Hostname()
+
 	return &notifierImpl{
 		Logger:         slf4go.Get("notifier"),
 		agents:         make(map[string]*agentServer),
 		cachesize:      cachesize,
+		node:           config.Get("node").String(hostname),
 		reloadTimeout:  config.Get("reload").Duration(time.Minute),
 		sessionTimeout: config.Get("timeout").Duration(time.Minute * 10),
+		closed:         make(chan struct{}),
 	}, nil
 }
 
 func (notifier *notifierImpl) Start() error {
+	notifier.wg.Add(1)
 	go notifier.reload()
 	return nil
 }
 
+// Close stop the reload loop and wait it exit, the agent loops exit with their grpc streams
+func (notifier *notifierImpl) Close() error {
+	notifier.closeOnce.Do(func() {
+		close(notifier.closed)
+	})
+
+	notifier.wg.Wait()
+
+	return nil
+}
+
 func (notifier *notifierImpl) CommitTx(id string) {
-	notifier.send(id, true)
+	notifier.send(id, true, false)
 }
 
 func (notifier *notifierImpl) CancelTx(id string) {
-	notifier.send(id, false)
+	notifier.send(id, false, false)
 }
 
-func (notifier *notifierImpl) send(id string, commit bool) {
+// send the commands of the tx resources to the attached agents, the commands resent by reload are recorded
+// as redelivery histories
+func (notifier *notifierImpl) send(id string, commit bool, redeliver bool) {
 	resources, err := notifier.Storage.GetResourceByTx(id)
 
 	if err != nil {
@@ -73,6 +99,12 @@ func (notifier *notifierImpl) send(id string, commit bool) {
 	filters := make(map[string]*engine.Resource)
 
 	for _, resource := range resources {
+		// finished, or failed permanently and reported by the agent
+		if resource.Status == tcc.TxStatus_Confirmed || resource.Status == tcc.TxStatus_Canceled ||
+			resource.Status == tcc.TxStatus_Failed {
+			continue
+		}
+
 		filters[fmt.Sprintf("%s%s", resource.Agent, resource.Resource)] = resource
 	}
 
@@ -86,19 +118,26 @@ func (notifier *notifierImpl) send(id string, commit bool) {
 			notifier.WarnF("commit(%s) tx %s resource(%s,%s) to agent %s -- skipped, the agent not register",
 				commit, id, resource.Require, resource.Resource, resource.Agent)
 
+			metrics.DeadLetters.WithLabelValues(resource.Agent, metrics.ReasonNotAttached).Inc()
+
 			continue
 		}
 
-		notifier.doSend(resource, agent, commit)
-
+		if notifier.doSend(resource, agent, commit, redeliver) && redeliver {
+			notifier.redelivered(resource, commit)
+		}
 	}
 }
 
-func (notifier *notifierImpl) doSend(resource *engine.Resource, agent *agentServer, commit bool) {
+// doSend queue the command to the agent server, return false if the agent server closed, the queued
+// redeliveries are counted by the target agent
+func (notifier *notifierImpl) doSend(resource *engine.Resource, agent *agentServer, commit bool, redeliver bool) (queued bool) {
 
 	defer func() {
 		if recover() != nil {
 			notifier.ErrorF("checked closed chan for agent %s(%p) loop", agent.agent, agent)
+			metrics.DeadLetters.WithLabelValues(agent.agent, metrics.ReasonClosed).Inc()
+			queued = false
 		}
 	}()
 
@@ -107,6 +146,23 @@ func (notifier *notifierImpl) doSend(resource *engine.Resource, agent *agentServ
 	} else {
 		agent.cancel <- resource
 	}
+
+	metrics.QueueDepth.WithLabelValues(agent.agent, queueLabel(commit)).Inc()
+
+	if redeliver {
+		metrics.Redeliveries.WithLabelValues(agent.agent).Inc()
+	}
+
+	return true
+}
+
+// queueLabel the command label of the queue metrics
+func queueLabel(commit bool) string {
+	if commit {
+		return "commit"
+	}
+
+	return "cancel"
 }
 
 func (notifier *notifierImpl) RunAgent(agent string, server tcc.Engine_AttachAgentServer) {
@@ -125,6 +181,9 @@ func (notifier *notifierImpl) RunAgent(agent string, server tcc.Engine_AttachAge
 	notifier.agents[agent] = as
 	notifier.Unlock()
 
+	metrics.AgentInstances.WithLabelValues(agent).Inc()
+	defer metrics.AgentInstances.WithLabelValues(agent).Dec()
+
 	notifier.doAgentLoop(as)
 
 }
@@ -146,6 +205,7 @@ func (notifier *notifierImpl) doAgentLoop(as *agentServer) {
 				return
 			}
 
+			metrics.QueueDepth.WithLabelValues(as.agent, queueLabel(true)).Dec()
 			cmd.Command = tcc.AgentCommand_COMMMIT
 
 		case resource, ok = <-as.cancel:
@@ -154,7 +214,14 @@ func (notifier *notifierImpl) doAgentLoop(as *agentServer) {
 				return
 			}
 
+			metrics.QueueDepth.WithLabelValues(as.agent, queueLabel(false)).Dec()
 			cmd.Command = tcc.AgentCommand_Cancel
+
+		case <-as.server.Context().Done():
+			notifier.InfoF("agent %s(%p) detached, reroute queued commands", as.agent, as)
+			notifier.closeAgentServer(as)
+			notifier.reroute(as)
+			return
 		}
 
 		cmd.Resource = resource.Resource
@@ -165,10 +232,43 @@ func (notifier *notifierImpl) doAgentLoop(as *agentServer) {
 		if err := as.server.Send(cmd); err != nil {
 			notifier.ErrorF("cmd to agent %s err: %s", as.agent, err)
 			notifier.closeAgentServer(as)
+			notifier.rerouteResource(as, resource, cmd.Command == tcc.AgentCommand_COMMMIT)
+			notifier.reroute(as)
+			return
 		}
 	}
 }
 
+// reroute the queued commands of the detached agent server to the other instance attached with the same
+// agent id, the commands are left to reload if no instance attached
+func (notifier *notifierImpl) reroute(as *agentServer) {
+	for resource := range as.commit {
+		metrics.QueueDepth.WithLabelValues(as.agent, queueLabel(true)).Dec()
+		notifier.rerouteResource(as, resource, true)
+	}
+
+	for resource := range as.cancel {
+		metrics.QueueDepth.WithLabelValues(as.agent, queueLabel(false)).Dec()
+		notifier.rerouteResource(as, resource, false)
+	}
+}
+
+func (notifier *notifierImpl) rerouteResource(as *agentServer, resource *engine.Resource, commit bool) {
+	notifier.RLock()
+	current, ok := notifier.agents[as.agent]
+	notifier.RUnlock()
+
+	if !ok || current == as {
+		notifier.WarnF("commit(%v) tx %s resource %s to agent %s -- keep for redelivery, no instance attached",
+			commit, resource.Tx, resource.Resource, as.agent)
+
+		metrics.DeadLetters.WithLabelValues(as.agent, metrics.ReasonNotAttached).Inc()
+		return
+	}
+
+	notifier.doSend(resource, current, commit, false)
+}
+
 func (notifier *notifierImpl) closeAgentServer(as *agentServer) {
 	notifier.Lock()
 	defer notifier.Unlock()
@@ -0,0 +1,361 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/dynamicgo/slf4go"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+)
+
+type mockAgentServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	cmds chan *tcc.AgentCommandRequest
+}
+
+func (server *mockAgentServer) Context() context.Context {
+	return server.ctx
+}
+
+func (server *mockAgentServer) Send(cmd *tcc.AgentCommandRequest) error {
+	server.cmds <- cmd
+	return nil
+}
+
+func newTestNotifier() *notifierImpl {
+	snode, _ := snowflake.NewNode(0)
+
+	return &notifierImpl{
+		Logger:         slf4go.Get("notifier"),
+		agents:         make(map[string]*agentServer),
+		cachesize:      16,
+		node:           "node",
+		SNode:          snode,
+		Storage:        storage.NewMemory(),
+		reloadTimeout:  time.Minute,
+		sessionTimeout: time.Minute * 10,
+	}
+}
+
+func runTestAgent(t *testing.T, notifier *notifierImpl, agent string) *mockAgentServer {
+	return runTestAgentContext(t, notifier, agent, context.Background())
+}
+
+func runTestAgentContext(t *testing.T, notifier *notifierImpl, agent string, ctx context.Context) *mockAgentServer {
+	server := &mockAgentServer{
+		ctx:  ctx,
+		cmds: make(chan *tcc.AgentCommandRequest, 16),
+	}
+
+	go notifier.RunAgent(agent, server)
+
+	for i := 0; i < 100; i++ {
+		notifier.RLock()
+		as, ok := notifier.agents[agent]
+		notifier.RUnlock()
+
+		if ok && as.server == server {
+			return server
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatalf("agent %s not attached", agent)
+
+	return nil
+}
+
+func prepareTx(t *testing.T, notifier *notifierImpl, txid string, status tcc.TxStatus) {
+	if err := notifier.Storage.NewTx(&engine.Transaction{ID: txid, Status: status}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err := notifier.Storage.NewResource(&engine.Resource{
+		ID:       "R_" + txid,
+		Tx:       txid,
+		Require:  "r" + txid,
+		Agent:    "agent",
+		Resource: "/test/Lock",
+		Status:   tcc.TxStatus_Locked,
+	}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectCmd(t *testing.T, server *mockAgentServer, txid string, command tcc.AgentCommand) {
+	select {
+	case cmd := <-server.cmds:
+		if cmd.Txid != txid || cmd.Command != command || cmd.Resource != "/test/Lock" {
+			t.Fatalf("unexpect cmd %s", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait cmd %s for tx %s timeout", command, txid)
+	}
+}
+
+func TestCommitTx(t *testing.T) {
+	notifier := newTestNotifier()
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+
+	server := runTestAgent(t, notifier, "agent")
+
+	notifier.CommitTx("1")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	notifier.CancelTx("1")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_Cancel)
+}
+
+func TestReload(t *testing.T) {
+	notifier := newTestNotifier()
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+
+	server := runTestAgent(t, notifier, "agent")
+
+	notifier.doReload("agent")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	histories, err := notifier.Storage.GetTxHistory("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(histories) != 1 {
+		t.Fatalf("expect redeliver history, got %d", len(histories))
+	}
+
+	if h := histories[0]; h.Event != engine.HistoryRedeliver || h.Resource != "R_1" || h.ToStatus != tcc.TxStatus_Confirmed ||
+		h.Node != "node" || h.ActorType != engine.ActorNotifier || h.Actor != "agent" {
+		t.Fatalf("unexpect redeliver history %v", h)
+	}
+
+	notifier.CommitTx("1")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	if histories, _ := notifier.Storage.GetTxHistory("1"); len(histories) != 1 {
+		t.Fatalf("expect no redeliver history of the first delivery, got %d", len(histories))
+	}
+}
+
+func TestSkipFinishedResource(t *testing.T) {
+	notifier := newTestNotifier()
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+
+	for agent, status := range map[string]tcc.TxStatus{"other": tcc.TxStatus_Canceled, "failed": tcc.TxStatus_Failed} {
+		err := notifier.Storage.NewResource(&engine.Resource{
+			ID:       "R_" + agent,
+			Tx:       "1",
+			Require:  "r_" + agent,
+			Agent:    agent,
+			Resource: "/test/Lock",
+			Status:   status,
+		}, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := runTestAgent(t, notifier, "agent")
+	other := runTestAgent(t, notifier, "other")
+	failed := runTestAgent(t, notifier, "failed")
+
+	notifier.CommitTx("1")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	notifier.doReload("failed")
+
+	select {
+	case cmd := <-other.cmds:
+		t.Fatalf("expect no cmd for the canceled resource, got %s", cmd)
+	case cmd := <-failed.cmds:
+		t.Fatalf("expect no cmd for the failed resource, got %s", cmd)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDetachAgent(t *testing.T) {
+	notifier := newTestNotifier()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runTestAgentContext(t, notifier, "agent", ctx)
+
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		notifier.RLock()
+		_, ok := notifier.agents["agent"]
+		notifier.RUnlock()
+
+		if !ok {
+			return
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("detached agent still registered")
+}
+
+func TestRerouteQueued(t *testing.T) {
+	notifier := newTestNotifier()
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+	prepareTx(t, notifier, "2", tcc.TxStatus_Canceled)
+
+	resources, err := notifier.Storage.GetResourceByTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, err := notifier.Storage.GetResourceByTx("2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the draining instance with queued commands, already replaced by the other instance
+	draining := &agentServer{
+		agent:  "agent",
+		commit: make(chan *engine.Resource, 1),
+		cancel: make(chan *engine.Resource, 1),
+	}
+
+	draining.commit <- resources[0]
+	draining.cancel <- canceled[0]
+	close(draining.commit)
+	close(draining.cancel)
+
+	server := runTestAgent(t, notifier, "agent")
+
+	notifier.reroute(draining)
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+	expectCmd(t, server, "2", tcc.AgentCommand_Cancel)
+}
+
+func TestNotifierMetrics(t *testing.T) {
+	notifier := newTestNotifier()
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+
+	dropped := testutil.ToFloat64(metrics.DeadLetters.WithLabelValues("agent", metrics.ReasonNotAttached))
+	redelivered := testutil.ToFloat64(metrics.Redeliveries.WithLabelValues("agent"))
+
+	notifier.CommitTx("1")
+
+	// the reload of the not attached agent queues nothing
+	notifier.doReload("agent")
+
+	if testutil.ToFloat64(metrics.DeadLetters.WithLabelValues("agent", metrics.ReasonNotAttached)) != dropped+2 {
+		t.Fatal("expect dead letters of the not attached agent")
+	}
+
+	if testutil.ToFloat64(metrics.Redeliveries.WithLabelValues("agent")) != redelivered {
+		t.Fatal("expect no redelivery counted without the agent attached")
+	}
+
+	server := runTestAgent(t, notifier, "agent")
+
+	notifier.doReload("agent")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	if testutil.ToFloat64(metrics.Redeliveries.WithLabelValues("agent")) != redelivered+1 {
+		t.Fatal("expect redelivery counted")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	notifier := newTestNotifier()
+	notifier.sessionTimeout = 0
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Locked)
+
+	server := runTestAgent(t, notifier, "agent")
+
+	timeouts := testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventTimeout))
+
+	// every reload cancels the expired tx, only the first one moves it out of the session window
+	for i := 0; i < 2; i++ {
+		notifier.doReload("agent")
+
+		expectCmd(t, server, "1", tcc.AgentCommand_Cancel)
+	}
+
+	if testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventTimeout)) != timeouts+1 {
+		t.Fatal("expect the timeout counted once")
+	}
+
+	tx, err := notifier.Storage.GetTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Status != tcc.TxStatus_Timeout {
+		t.Fatalf("expect tx timeout, got %s", tx.Status)
+	}
+
+	histories, err := notifier.Storage.GetTxHistory("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := histories[0]; h.Event != engine.HistoryTransit || h.ToStatus != tcc.TxStatus_Timeout || h.ActorType != engine.ActorNotifier {
+		t.Fatalf("unexpect timeout history %v", h)
+	}
+}
+
+func TestTimeoutSkipsFinal(t *testing.T) {
+	notifier := newTestNotifier()
+	notifier.sessionTimeout = 0
+
+	prepareTx(t, notifier, "1", tcc.TxStatus_Confirmed)
+
+	server := runTestAgent(t, notifier, "agent")
+
+	timeouts := testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventTimeout))
+	redelivered := testutil.ToFloat64(metrics.Redeliveries.WithLabelValues("agent"))
+
+	notifier.doReload("agent")
+
+	expectCmd(t, server, "1", tcc.AgentCommand_COMMMIT)
+
+	select {
+	case cmd := <-server.cmds:
+		t.Fatalf("expect no cancel of the confirmed tx, got %s", cmd)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventTimeout)) != timeouts {
+		t.Fatal("expect the confirmed tx not counted as timeout")
+	}
+
+	if testutil.ToFloat64(metrics.Redeliveries.WithLabelValues("agent")) != redelivered+1 {
+		t.Fatal("expect only the commit counted as redelivery")
+	}
+}
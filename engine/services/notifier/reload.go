@@ -4,15 +4,25 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/dynamicgo/xerrors"
 	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
 )
 
 func (notifier *notifierImpl) reload() {
+	defer notifier.wg.Done()
+
 	ticker := time.NewTicker(notifier.reloadTimeout)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		notifier.reloadLoop()
+	for {
+		select {
+		case <-ticker.C:
+			notifier.reloadLoop()
+		case <-notifier.closed:
+			return
+		}
 	}
 }
 
@@ -36,17 +46,67 @@ func (notifier *notifierImpl) doReload(agent string) {
 	notifier.DebugF("try send notify(%d) to agent %s", len(txs), agent)
 
 	for _, tx := range txs {
-		if tx.Status == tcc.TxStatus_Confirmed {
-			notifier.send(tx.ID, true)
+		switch tx.Status {
+		case tcc.TxStatus_Confirmed:
+			notifier.send(tx.ID, true, true)
+		case tcc.TxStatus_Canceled, tcc.TxStatus_Timeout:
+			notifier.send(tx.ID, false, true)
+		default:
+			if time.Now().Sub(tx.CreatedTime) > notifier.sessionTimeout && notifier.timeout(tx, agent) {
+				notifier.send(tx.ID, false, true)
+			}
 		}
+	}
+}
 
-		if tx.Status == tcc.TxStatus_Canceled {
-			notifier.send(tx.ID, false)
-		}
+// timeout move the unfinished tx out of the session window to Timeout, the tx is counted once by the reload
+// winning the update, return false if the tx is changed by others and left to the next reload
+func (notifier *notifierImpl) timeout(tx *engine.Transaction, agent string) bool {
+	history := &engine.History{
+		ID:        "H_" + notifier.SNode.Generate().String(),
+		Event:     engine.HistoryTransit,
+		Node:      notifier.node,
+		ActorType: engine.ActorNotifier,
+		Actor:     agent,
+	}
 
-		if time.Now().Sub(tx.CreatedTime) > notifier.sessionTimeout {
-			notifier.send(tx.ID, false)
-		}
+	err := notifier.Storage.UpdateTxStatus(tx, tcc.TxStatus_Timeout, history)
+
+	if xerrors.Is(err, engine.ErrConflict) {
+		notifier.DebugF("timeout tx %s -- skipped, changed by others", tx.ID)
+		return false
+	}
+
+	if err != nil {
+		notifier.ErrorF("timeout tx %s error: %s", tx.ID, err)
+		return false
+	}
+
+	metrics.Transactions.WithLabelValues(metrics.EventTimeout).Inc()
+
+	return true
+}
+
+// redelivered record the command resent by reload in the resource history, the failure is only logged
+func (notifier *notifierImpl) redelivered(resource *engine.Resource, commit bool) {
+	history := &engine.History{
+		ID:         "H_" + notifier.SNode.Generate().String(),
+		Tx:         resource.Tx,
+		Resource:   resource.ID,
+		Event:      engine.HistoryRedeliver,
+		FromStatus: resource.Status,
+		ToStatus:   tcc.TxStatus_Canceled,
+		Node:       notifier.node,
+		ActorType:  engine.ActorNotifier,
+		Actor:      resource.Agent,
+	}
+
+	if commit {
+		history.ToStatus = tcc.TxStatus_Confirmed
+	}
+
+	if err := notifier.Storage.AppendHistory(history); err != nil {
+		notifier.ErrorF("append redeliver history of tx %s resource %s error: %s", resource.Tx, resource.ID, err)
 	}
 }
 
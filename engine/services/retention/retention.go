@@ -0,0 +1,168 @@
+package retention
+
+import (
+	"sync"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// policy keep finished transactions of status for duration, zero duration means keep forever
+type policy struct {
+	status tcc.TxStatus
+	keep   time.Duration
+}
+
+type retentionImpl struct {
+	slf4go.Logger                // mixin logger
+	Storage       engine.Storage `inject:"tcc.Storage"` // inject storage service
+	interval      time.Duration  // retention loop interval
+	batch         int            // transactions handled per batch
+	throttle      time.Duration  // sleep duration between batches
+	archive       bool           // archive or delete finished transactions
+	policies      []*policy      // retention policies per terminal status
+	closed        chan struct{}  // closed by Close to stop loop
+	closeOnce     sync.Once      // close once
+	wg            sync.WaitGroup // wait loop exit
+}
+
+// New create retention service which archive or delete finished transactions
+func New(config config.Config) (engine.Retention, error) {
+
+	mode := config.Get("mode").String("archive")
+
+	if mode != "archive" && mode != "delete" {
+		return nil, xerrors.New("retention mode must be archive or delete")
+	}
+
+	return &retentionImpl{
+		Logger:   slf4go.Get("tcc-retention"),
+		interval: config.Get("interval").Duration(time.Minute * 10),
+		batch:    config.Get("batch").Int(100),
+		throttle: config.Get("throttle").Duration(time.Millisecond * 100),
+		archive:  mode == "archive",
+		policies: []*policy{
+			{status: tcc.TxStatus_Confirmed, keep: config.Get("confirmed").Duration(0)},
+			{status: tcc.TxStatus_Canceled, keep: config.Get("canceled").Duration(0)},
+			{status: tcc.TxStatus_Timeout, keep: config.Get("timeout").Duration(0)},
+		},
+		closed: make(chan struct{}),
+	}, nil
+}
+
+func (retention *retentionImpl) Start() error {
+	retention.wg.Add(1)
+	go retention.loop()
+	return nil
+}
+
+// Close stop the retention loop and wait the running batch done
+func (retention *retentionImpl) Close() error {
+	retention.closeOnce.Do(func() {
+		close(retention.closed)
+	})
+
+	retention.wg.Wait()
+
+	return nil
+}
+
+func (retention *retentionImpl) loop() {
+	defer retention.wg.Done()
+
+	ticker := time.NewTicker(retention.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := retention.RunOnce(); err != nil {
+				retention.ErrorF("%s", err)
+			}
+		case <-retention.closed:
+			return
+		}
+	}
+}
+
+func (retention *retentionImpl) RunOnce() (int, error) {
+	total := 0
+
+	for _, policy := range retention.policies {
+		if policy.keep <= 0 {
+			continue
+		}
+
+		count, err := retention.runPolicy(policy)
+
+		total += count
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func (retention *retentionImpl) runPolicy(policy *policy) (int, error) {
+	before := time.Now().Add(-policy.keep)
+
+	total := 0
+
+	for {
+		txs, err := retention.Storage.QueryFinishedTx(policy.status, before, retention.batch)
+
+		if err != nil {
+			return total, err
+		}
+
+		if len(txs) == 0 {
+			break
+		}
+
+		ids := make([]string, 0, len(txs))
+
+		for _, tx := range txs {
+			ids = append(ids, tx.ID)
+		}
+
+		var count int
+
+		if retention.archive {
+			count, err = retention.Storage.ArchiveTx(ids)
+		} else {
+			count, err = retention.Storage.DeleteTx(ids)
+		}
+
+		if err != nil {
+			return total, xerrors.Wrapf(err, "retention %s txs error", policy.status)
+		}
+
+		total += count
+
+		retention.DebugF("retention(archive:%v) %d/%d %s txs before %s", retention.archive, count, len(ids), policy.status, before)
+
+		// stop when the whole batch changed after the query, retry it on next round
+		if count == 0 || len(txs) < retention.batch {
+			break
+		}
+
+		// the rest batches are left to the next start after Close
+		select {
+		case <-time.After(retention.throttle):
+		case <-retention.closed:
+			return total, nil
+		}
+	}
+
+	if total > 0 {
+		retention.InfoF("retention(archive:%v) %d %s txs before %s -- success", retention.archive, total, policy.status, before)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,161 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+)
+
+func newTestRetention(archive bool, policies ...*policy) *retentionImpl {
+	return &retentionImpl{
+		Logger:   slf4go.Get("tcc-retention"),
+		Storage:  storage.NewMemory(),
+		batch:    2,
+		archive:  archive,
+		policies: policies,
+	}
+}
+
+func prepareTx(t *testing.T, storage engine.Storage, id string, status tcc.TxStatus, resourceStatus tcc.TxStatus) {
+	if err := storage.NewTx(&engine.Transaction{ID: id, Status: status}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err := storage.NewResource(&engine.Resource{
+		ID:       "R_" + id,
+		Tx:       id,
+		Require:  "rid" + id,
+		Agent:    "agent",
+		Resource: "/test/Lock",
+		Status:   resourceStatus,
+	}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	retention := newTestRetention(true,
+		&policy{status: tcc.TxStatus_Confirmed, keep: time.Nanosecond},
+		&policy{status: tcc.TxStatus_Canceled, keep: time.Hour},
+	)
+
+	for _, id := range []string{"1", "2", "3"} {
+		prepareTx(t, retention.Storage, id, tcc.TxStatus_Confirmed, tcc.TxStatus_Confirmed)
+	}
+
+	prepareTx(t, retention.Storage, "4", tcc.TxStatus_Confirmed, tcc.TxStatus_Locked)
+	prepareTx(t, retention.Storage, "5", tcc.TxStatus_Canceled, tcc.TxStatus_Canceled)
+	prepareTx(t, retention.Storage, "6", tcc.TxStatus_Confirmed, tcc.TxStatus_Failed)
+
+	time.Sleep(time.Millisecond)
+
+	count, err := retention.RunOnce()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 4 {
+		t.Fatalf("expect 4 txs archived, got %d", count)
+	}
+
+	for _, id := range []string{"1", "2", "3", "6"} {
+		tx, resources, err := retention.Storage.GetArchivedTx(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tx == nil || len(resources) != 1 {
+			t.Fatalf("expect tx %s archived", id)
+		}
+	}
+
+	for _, id := range []string{"4", "5"} {
+		tx, _, err := retention.Storage.GetArchivedTx(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tx != nil {
+			t.Fatalf("expect tx %s kept", id)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	retention := newTestRetention(false, &policy{status: tcc.TxStatus_Canceled, keep: time.Nanosecond})
+
+	prepareTx(t, retention.Storage, "1", tcc.TxStatus_Canceled, tcc.TxStatus_Canceled)
+
+	time.Sleep(time.Millisecond)
+
+	count, err := retention.RunOnce()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Fatalf("expect 1 tx deleted, got %d", count)
+	}
+
+	tx, _, err := retention.Storage.GetArchivedTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx != nil {
+		t.Fatalf("expect deleted tx not archived")
+	}
+
+	resources, err := retention.Storage.GetResourceByTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 0 {
+		t.Fatalf("expect deleted tx resources removed")
+	}
+}
+
+func TestKeepAliveChild(t *testing.T) {
+	retention := newTestRetention(true, &policy{status: tcc.TxStatus_Confirmed, keep: time.Nanosecond})
+
+	prepareTx(t, retention.Storage, "1", tcc.TxStatus_Confirmed, tcc.TxStatus_Confirmed)
+
+	if err := retention.Storage.NewTx(&engine.Transaction{ID: "2", PID: "1", Status: tcc.TxStatus_Created}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	count, err := retention.RunOnce()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Fatalf("expect parent tx with alive child kept, got %d archived", count)
+	}
+
+	tx, err := retention.Storage.GetTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx == nil {
+		t.Fatalf("expect parent tx kept")
+	}
+}
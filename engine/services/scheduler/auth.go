@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc/auth"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the roles of principals
+const (
+	RoleInitiator   = "initiator"   // NewTx, Commit and Cancel
+	RoleParticipant = "participant" // AttachAgent, Begin/End/FailLockResource, ResourceStatusChanged and ResourceCommandFailed
+	RoleAdmin       = "admin"       // GetArchivedTx and GetTxHistory
+)
+
+// principalConfig one principal of the auth.principals config
+type principalConfig struct {
+	Name        string   `json:"name"`         // principal name, also the client certificate common name
+	Token       string   `json:"token"`        // bearer token
+	TokenSHA256 string   `json:"token_sha256"` // hex sha256 of the bearer token, instead of the plain token
+	Roles       []string `json:"roles"`        // granted roles
+	Agents      []string `json:"agents"`       // agent ids the participant may act as, defaults to the name
+}
+
+type principal struct {
+	name   string
+	roles  map[string]bool
+	agents map[string]bool
+}
+
+// authorizer authenticate the principal of the rpc by bearer token or client certificate
+type authorizer struct {
+	tokens map[[sha256.Size]byte]*principal // principals indexed by token sha256
+	names  map[string]*principal            // principals indexed by name
+}
+
+// newAuthorizer load the auth.principals config, return nil if not set
+func newAuthorizer(config config.Config) (*authorizer, error) {
+	var configs []*principalConfig
+
+	if err := config.Get("auth", "principals").Scan(&configs); err != nil {
+		return nil, xerrors.Wrapf(err, "load auth.principals error")
+	}
+
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	authorizer := &authorizer{
+		tokens: make(map[[sha256.Size]byte]*principal),
+		names:  make(map[string]*principal),
+	}
+
+	for _, c := range configs {
+		if c.Name == "" || authorizer.names[c.Name] != nil {
+			return nil, xerrors.New(fmt.Sprintf("auth principal name %q empty or duplicate", c.Name))
+		}
+
+		p := &principal{
+			name:   c.Name,
+			roles:  make(map[string]bool),
+			agents: make(map[string]bool),
+		}
+
+		for _, role := range c.Roles {
+			if role != RoleInitiator && role != RoleParticipant && role != RoleAdmin {
+				return nil, xerrors.New(fmt.Sprintf("auth principal %s unknown role %s", c.Name, role))
+			}
+
+			p.roles[role] = true
+		}
+
+		if len(c.Agents) == 0 {
+			c.Agents = []string{c.Name}
+		}
+
+		for _, agent := range c.Agents {
+			p.agents[agent] = true
+		}
+
+		authorizer.names[c.Name] = p
+
+		var hash [sha256.Size]byte
+
+		switch {
+		case c.Token != "":
+			hash = sha256.Sum256([]byte(c.Token))
+		case c.TokenSHA256 != "":
+			buff, err := hex.DecodeString(c.TokenSHA256)
+
+			if err != nil || len(buff) != sha256.Size {
+				return nil, xerrors.New(fmt.Sprintf("auth principal %s invalid token_sha256", c.Name))
+			}
+
+			copy(hash[:], buff)
+		default:
+			continue
+		}
+
+		authorizer.tokens[hash] = p
+	}
+
+	return authorizer, nil
+}
+
+// authenticate return the principal of the bearer token, or of the verified client certificate without token
+func (authorizer *authorizer) authenticate(ctx context.Context) (*principal, bool) {
+	if token, ok := auth.Token(ctx); ok {
+		hash := sha256.Sum256([]byte(token))
+
+		for key, p := range authorizer.tokens {
+			if subtle.ConstantTimeCompare(key[:], hash[:]) == 1 {
+				return p, true
+			}
+		}
+
+		return nil, false
+	}
+
+	if identity, ok := tlsconfig.Identity(ctx); ok {
+		p, ok := authorizer.names[identity]
+		return p, ok
+	}
+
+	return nil, false
+}
+
+// authorize check the caller has the role, and may act as the agent if not empty, the denied calls are logged
+// and return PermissionDenied
+func (scheduler *schedulerImpl) authorize(ctx context.Context, method, role, agent string) error {
+	if err := scheduler.authAgent(ctx, agent); err != nil {
+		scheduler.WarnF("deny %s from %s: %s", method, peerAddr(ctx), err)
+		return err
+	}
+
+	if scheduler.auth == nil {
+		return nil
+	}
+
+	p, ok := scheduler.auth.authenticate(ctx)
+
+	if !ok {
+		scheduler.WarnF("deny %s from %s: unauthenticated", method, peerAddr(ctx))
+		return status.Errorf(codes.PermissionDenied, "%s unauthenticated", method)
+	}
+
+	if !p.roles[role] {
+		scheduler.WarnF("deny %s from %s: principal %s without role %s", method, peerAddr(ctx), p.name, role)
+		return status.Errorf(codes.PermissionDenied, "%s requires role %s", method, role)
+	}
+
+	if agent != "" && !p.agents[agent] {
+		scheduler.WarnF("deny %s from %s: principal %s can't act as agent %s", method, peerAddr(ctx), p.name, agent)
+		return status.Errorf(codes.PermissionDenied, "principal %s can't act as agent %s", p.name, agent)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestConfig(t *testing.T, data string) config.Config {
+	conf := config.NewConfig()
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func serveTest(t *testing.T, scheduler *schedulerImpl) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+
+	tcc.RegisterEngineServer(server, scheduler)
+
+	go server.Serve(listener)
+
+	return listener.Addr().String(), server.Stop
+}
+
+func dialToken(t *testing.T, addr string, token string) tcc.EngineClient {
+	options := []grpc.DialOption{grpc.WithInsecure()}
+
+	if token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(auth.NewTokenCredentials(token, false)))
+	}
+
+	conn, err := grpc.Dial(addr, options...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tcc.NewEngineClient(conn)
+}
+
+func expectDenied(t *testing.T, name string, err error) {
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expect %s PermissionDenied, got %v", name, err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	adminHash := sha256.Sum256([]byte("admin-token"))
+
+	conf := newTestConfig(t, fmt.Sprintf(`{"auth":{"principals":[
+		{"name":"order","token":"order-token","roles":["initiator"]},
+		{"name":"stock","token":"stock-token","roles":["participant"],"agents":["stock-a"]},
+		{"name":"ops","token_sha256":%q,"roles":["admin"]}
+	]}}`, hex.EncodeToString(adminHash[:])))
+
+	auth, err := newAuthorizer(conf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler, _ := newTestScheduler(t)
+	scheduler.auth = auth
+
+	addr, stop := serveTest(t, scheduler)
+	defer stop()
+
+	ctx := context.Background()
+
+	_, err = dialToken(t, addr, "").NewTx(ctx, &tcc.NewTxRequest{})
+	expectDenied(t, "anonymous NewTx", err)
+
+	_, err = dialToken(t, addr, "unknown").NewTx(ctx, &tcc.NewTxRequest{})
+	expectDenied(t, "unknown token NewTx", err)
+
+	order := dialToken(t, addr, "order-token")
+
+	resp, err := order.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = order.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{Txid: resp.Txid, Rid: "R_1", Agent: "order"})
+	expectDenied(t, "initiator BeginLockResource", err)
+
+	stock := dialToken(t, addr, "stock-token")
+
+	_, err = stock.Commit(ctx, &tcc.CommitTxRequest{Txid: resp.Txid})
+	expectDenied(t, "participant Commit", err)
+
+	request := &tcc.BeginLockResourceRequest{Txid: resp.Txid, Rid: "R_1", Agent: "stock-a", Resource: "/test/Lock"}
+
+	if _, err := stock.BeginLockResource(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+
+	request = &tcc.BeginLockResourceRequest{Txid: resp.Txid, Rid: "R_2", Agent: "stock-b", Resource: "/test/Lock"}
+
+	_, err = stock.BeginLockResource(ctx, request)
+	expectDenied(t, "BeginLockResource as another agent", err)
+
+	attach, err := stock.AttachAgent(ctx, &tcc.AttachAgentRequest{Agent: "stock-b"})
+
+	if err == nil {
+		_, err = attach.Recv()
+	}
+
+	expectDenied(t, "AttachAgent as another agent", err)
+
+	_, err = order.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: resp.Txid})
+	expectDenied(t, "initiator GetTxHistory", err)
+
+	history, err := dialToken(t, addr, "admin-token").GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: resp.Txid})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history.Histories) != 2 {
+		t.Fatalf("expect create tx and resource histories, got %v", history.Histories)
+	}
+
+	if h := history.Histories[0]; h.ActorType != "initiator" || h.Actor != "order" {
+		t.Fatalf("expect tx created by principal order, got %v", h)
+	}
+}
+
+func TestAuthorizerConfig(t *testing.T) {
+	if auth, err := newAuthorizer(newTestConfig(t, `{}`)); err != nil || auth != nil {
+		t.Fatalf("expect auth disabled without principals, got %v %v", auth, err)
+	}
+
+	conf := newTestConfig(t, `{"auth":{"principals":[{"name":"order","token":"t","roles":["root"]}]}}`)
+
+	if _, err := newAuthorizer(conf); err == nil {
+		t.Fatalf("expect unknown role rejected")
+	}
+
+	conf = newTestConfig(t, `{"auth":{"principals":[{"name":"order"},{"name":"order"}]}}`)
+
+	if _, err := newAuthorizer(conf); err == nil {
+		t.Fatalf("expect duplicate principal rejected")
+	}
+}
@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/gomeshnetwork/tcc/engine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type pendingWrite struct {
+	ctx   context.Context
+	write *engine.ResourceWrite
+	done  chan error
+}
+
+// batcher group the concurrent resource writes into one storage transaction, the caller returns after
+// its write committed
+type batcher struct {
+	slf4go.Logger
+	size    int           // max writes per batch
+	latency time.Duration // max wait for more writes after the first one, 0 only takes the queued writes
+	queue   chan *pendingWrite
+	flush   func(writes []*engine.ResourceWrite) []error
+	closed  chan struct{} // closed by close to stop run
+	stopped chan struct{} // closed when run exits
+	once    sync.Once     // close once
+}
+
+func newBatcher(size int, latency time.Duration, flush func(writes []*engine.ResourceWrite) []error) *batcher {
+	return &batcher{
+		Logger:  slf4go.Get("tcc-scheduler-batcher"),
+		size:    size,
+		latency: latency,
+		queue:   make(chan *pendingWrite, size*4),
+		flush:   flush,
+		closed:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// write queue the write and wait it committed, give up when the rpc ctx done or the batcher closed, the
+// write still queued is dropped but the write already flushing may be committed
+func (batcher *batcher) write(ctx context.Context, write *engine.ResourceWrite) error {
+	pending := &pendingWrite{
+		ctx:   ctx,
+		write: write,
+		done:  make(chan error, 1),
+	}
+
+	select {
+	case batcher.queue <- pending:
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-batcher.closed:
+		return errClosed
+	}
+
+	select {
+	case err := <-pending.done:
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-batcher.closed:
+		return errClosed
+	}
+}
+
+// errClosed the error of the writes given up by the closed batcher
+var errClosed = status.Error(codes.Unavailable, "tcc scheduler closed")
+
+// close stop run after the flushing batch and wait it exit, the queued writes are given up
+func (batcher *batcher) close() {
+	batcher.once.Do(func() {
+		close(batcher.closed)
+	})
+
+	<-batcher.stopped
+}
+
+func (batcher *batcher) run() {
+	defer close(batcher.stopped)
+
+	for {
+		var first *pendingWrite
+		var ok bool
+
+		select {
+		case first, ok = <-batcher.queue:
+			if !ok {
+				return
+			}
+		case <-batcher.closed:
+			return
+		}
+
+		batch := batcher.live(batcher.collect(first))
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		writes := make([]*engine.ResourceWrite, 0, len(batch))
+
+		for _, pending := range batch {
+			writes = append(writes, pending.write)
+		}
+
+		errs := batcher.flush(writes)
+
+		batcher.DebugF("flush %d resource writes", len(writes))
+
+		for i, pending := range batch {
+			pending.done <- errs[i]
+		}
+	}
+}
+
+// live drop the writes whose caller gave up
+func (batcher *batcher) live(batch []*pendingWrite) []*pendingWrite {
+	live := batch[:0]
+
+	for _, pending := range batch {
+		if err := pending.ctx.Err(); err != nil {
+			pending.done <- err
+			continue
+		}
+
+		live = append(live, pending)
+	}
+
+	return live
+}
+
+// collect the writes after first until the batch is full or the latency expired
+func (batcher *batcher) collect(first *pendingWrite) []*pendingWrite {
+	batch := []*pendingWrite{first}
+
+	if batcher.latency <= 0 {
+		for len(batch) < batcher.size {
+			select {
+			case pending, ok := <-batcher.queue:
+				if !ok {
+					return batch
+				}
+
+				batch = append(batch, pending)
+			default:
+				return batch
+			}
+		}
+
+		return batch
+	}
+
+	timer := time.NewTimer(batcher.latency)
+	defer timer.Stop()
+
+	for len(batch) < batcher.size {
+		select {
+		case pending, ok := <-batcher.queue:
+			if !ok {
+				return batch
+			}
+
+			batch = append(batch, pending)
+		case <-timer.C:
+			return batch
+		}
+	}
+
+	return batch
+}
@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newSQLiteStorage(t testing.TB) engine.Storage {
+	dir, err := ioutil.TempDir("", "tcc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", filepath.Join(dir, "tcc.db"))
+
+	db, err := xorm.NewEngine("sqlite3", source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migration.New(db).Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	conf := config.NewConfig()
+
+	data := fmt.Sprintf(`{"driver":"sqlite3","source":%q}`, source)
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := storage.New(conf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage
+}
+
+func TestBatcherCollect(t *testing.T) {
+	var flushes []int
+
+	batcher := newBatcher(3, 50*time.Millisecond, func(writes []*engine.ResourceWrite) []error {
+		flushes = append(flushes, len(writes))
+		return make([]error, len(writes))
+	})
+
+	for i := 0; i < 4; i++ {
+		batcher.queue <- &pendingWrite{ctx: context.Background(), write: &engine.ResourceWrite{}, done: make(chan error, 1)}
+	}
+
+	close(batcher.queue)
+
+	batcher.run()
+
+	if fmt.Sprint(flushes) != "[3 1]" {
+		t.Fatalf("expect batches [3 1], got %v", flushes)
+	}
+}
+
+func TestBatcherGiveUp(t *testing.T) {
+	var flushes []int
+
+	batcher := newBatcher(1, 0, func(writes []*engine.ResourceWrite) []error {
+		flushes = append(flushes, len(writes))
+		return make([]error, len(writes))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the batcher not running, the write waits in queue until the ctx done
+	if err := batcher.write(ctx, &engine.ResourceWrite{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+
+	if err := batcher.write(ctx, &engine.ResourceWrite{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded after the ctx done, got %v", err)
+	}
+
+	close(batcher.queue)
+
+	batcher.run()
+
+	if len(flushes) != 0 {
+		t.Fatalf("expect abandoned writes dropped, got flushes %v", flushes)
+	}
+}
+
+func lockResources(t testing.TB, scheduler *schedulerImpl, txid string, n int, prefix string) {
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var failed int32
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(rid string) {
+			defer wg.Done()
+
+			request := &tcc.BeginLockResourceRequest{Txid: txid, Rid: rid, Agent: "agent", Resource: "/test/Lock"}
+
+			if _, err := scheduler.BeginLockResource(ctx, request); err != nil {
+				atomic.AddInt32(&failed, 1)
+				return
+			}
+
+			_, err := scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+				Txid: txid, Rid: rid, Agent: "agent", Resource: "/test/Lock",
+			})
+
+			if err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(fmt.Sprintf("%s%d", prefix, i))
+	}
+
+	wg.Wait()
+
+	if failed != 0 {
+		t.Fatalf("%d lock calls failed", failed)
+	}
+}
+
+func TestBatchLockResource(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	scheduler.Storage = newSQLiteStorage(t)
+	scheduler.batch = 16
+	scheduler.latency = time.Millisecond
+
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	txid, err := scheduler.newTx(context.Background(), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockResources(t, scheduler, txid, 50, "R_")
+
+	resources, err := scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 50 {
+		t.Fatalf("expect 50 resources, got %d", len(resources))
+	}
+
+	for _, resource := range resources {
+		if resource.Status != tcc.TxStatus_Locked || resource.Version != 2 {
+			t.Fatalf("expect resource locked, got %v", resource)
+		}
+	}
+
+	_, err = scheduler.BeginLockResource(context.Background(), &tcc.BeginLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err == nil {
+		t.Fatalf("expect duplicate resource rejected in batch mode")
+	}
+}
+
+func benchmarkLockResource(b *testing.B, batch int, latency time.Duration) {
+	scheduler, _ := newTestScheduler(b)
+
+	scheduler.Storage = newSQLiteStorage(b)
+	scheduler.batch = batch
+	scheduler.latency = latency
+
+	if err := scheduler.Start(); err != nil {
+		b.Fatal(err)
+	}
+
+	txid, err := scheduler.newTx(context.Background(), "")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	lockResources(b, scheduler, txid, b.N, "R_")
+}
+
+// BenchmarkLockResource concurrent BeginLockResource/EndLockResource pairs on sqlite, run with -cpu to
+// compare the direct writes and the group commit
+func BenchmarkLockResource(b *testing.B) {
+	b.Run("direct", func(b *testing.B) { benchmarkLockResource(b, 1, 0) })
+	b.Run("batch", func(b *testing.B) { benchmarkLockResource(b, 64, 0) })
+	b.Run("batch-1ms", func(b *testing.B) { benchmarkLockResource(b, 64, time.Millisecond) })
+}
+
+func TestBatcherClose(t *testing.T) {
+	batcher := newBatcher(1, 0, func(writes []*engine.ResourceWrite) []error {
+		return make([]error, len(writes))
+	})
+
+	go batcher.run()
+
+	if err := batcher.write(context.Background(), &engine.ResourceWrite{}); err != nil {
+		t.Fatal(err)
+	}
+
+	batcher.close()
+	batcher.close()
+
+	if err := batcher.write(context.Background(), &engine.ResourceWrite{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expect Unavailable after close, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// initiator the initiator actor of grpc call, the authenticated principal name, the agent id of the verified
+// client certificate, or the peer address of anonymous call
+func (scheduler *schedulerImpl) initiator(ctx context.Context) string {
+	if scheduler.auth != nil {
+		if p, ok := scheduler.auth.authenticate(ctx); ok {
+			return p.name
+		}
+	}
+
+	if identity, ok := tlsconfig.Identity(ctx); ok {
+		return identity
+	}
+
+	return peerAddr(ctx)
+}
+
+// peerAddr the peer address of grpc call
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+// newHistory create history of the event, the storage fill the transaction and status
+func (scheduler *schedulerImpl) newHistory(event, actorType, actor string) *engine.History {
+	return &engine.History{
+		ID:        "H_" + scheduler.SNode.Generate().String(),
+		Event:     event,
+		Node:      scheduler.node,
+		ActorType: actorType,
+		Actor:     actor,
+	}
+}
+
+// reject record the rejected status change, the failure is only logged
+func (scheduler *schedulerImpl) reject(txid, resource string, from, to tcc.TxStatus, actorType, actor string, cause error) {
+	history := scheduler.newHistory(engine.HistoryReject, actorType, actor)
+
+	history.Tx = txid
+	history.Resource = resource
+	history.FromStatus = from
+	history.ToStatus = to
+	history.Error = cause.Error()
+
+	if err := scheduler.Storage.AppendHistory(history); err != nil {
+		scheduler.ErrorF("append reject history of tx %s error: %s", txid, err)
+	}
+}
+
+func (scheduler *schedulerImpl) GetTxHistory(ctx context.Context, request *tcc.GetTxHistoryRequest) (*tcc.GetTxHistoryResponse, error) {
+	if err := scheduler.authorize(ctx, "GetTxHistory", RoleAdmin, ""); err != nil {
+		return nil, err
+	}
+
+	histories, err := scheduler.Storage.GetTxHistory(request.Txid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(histories) == 0 {
+		return nil, status.Errorf(codes.NotFound, "tx %s history not found", request.Txid)
+	}
+
+	resp := &tcc.GetTxHistoryResponse{}
+
+	for _, history := range histories {
+		resp.Histories = append(resp.Histories, &tcc.TxHistory{
+			Id:          history.ID,
+			Txid:        history.Tx,
+			Resource:    history.Resource,
+			Event:       history.Event,
+			FromStatus:  history.FromStatus,
+			ToStatus:    history.ToStatus,
+			Node:        history.Node,
+			ActorType:   history.ActorType,
+			Actor:       history.Actor,
+			Error:       history.Error,
+			CreatedTime: history.CreatedTime.Unix(),
+		})
+	}
+
+	return resp, nil
+}
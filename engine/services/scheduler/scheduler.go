@@ -2,38 +2,113 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/bwmarrin/snowflake"
+	"github.com/dynamicgo/xerrors"
 	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
 
 	"github.com/dynamicgo/slf4go"
 
 	config "github.com/dynamicgo/go-config"
 	"github.com/gomeshnetwork/tcc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type schedulerImpl struct {
 	slf4go.Logger
-	SNode    *snowflake.Node `inject:"tcc.Snowflake"` // inject snowflake node
-	Storage  engine.Storage  `inject:"tcc.Storage"`   // inject storage service
-	Notifier engine.Notifier `inject:"tcc.Notifier"`  // inject resource manager notifier
+	node     string            // engine node name recorded in histories
+	batch    int               // max resource writes per group commit, <= 1 disables batching
+	latency  time.Duration     // max group commit wait after the first write
+	batcher  *batcher          // resource writes group commit, nil if disabled
+	tls      *tlsconfig.Config // engine rpc tls config
+	laddr    string            // tls listen address
+	server   *grpc.Server      // tls grpc server, nil if tls disabled
+	auth     *authorizer       // rpc authorizer, nil if auth disabled
+	SNode    *snowflake.Node   `inject:"tcc.Snowflake"` // inject snowflake node
+	Storage  engine.Storage    `inject:"tcc.Storage"`   // inject storage service
+	Notifier engine.Notifier   `inject:"tcc.Notifier"`  // inject resource manager notifier
 }
 
 // New .
 func New(config config.Config) (tcc.EngineServer, error) {
+	hostname, _ := os.Hostname()
+
+	auth, err := newAuthorizer(config)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return &schedulerImpl{
-		Logger: slf4go.Get("tcc-scheduler"),
+		Logger:  slf4go.Get("tcc-scheduler"),
+		node:    config.Get("node").String(hostname),
+		batch:   config.Get("batch", "size").Int(64),
+		latency: config.Get("batch", "latency").Duration(0),
+		tls:     tlsconfig.Load(config, "tls"),
+		laddr:   config.Get("tls", "laddr").String(":2100"),
+		auth:    auth,
 	}, nil
 }
 
+func (scheduler *schedulerImpl) Start() error {
+	if scheduler.tls.Enabled() {
+		if err := scheduler.serveTLS(); err != nil {
+			return err
+		}
+	}
+
+	if scheduler.batch > 1 {
+		scheduler.batcher = newBatcher(scheduler.batch, scheduler.latency, scheduler.Storage.WriteResources)
+		go scheduler.batcher.run()
+	}
+
+	return nil
+}
+
+// Close stop the tls grpc server and the resource write batcher
+func (scheduler *schedulerImpl) Close() error {
+	if scheduler.server != nil {
+		scheduler.server.Stop()
+	}
+
+	if scheduler.batcher != nil {
+		scheduler.batcher.close()
+	}
+
+	return nil
+}
+
+// writeResource write resource through the batcher if enabled, the batcher gives up when the rpc ctx done
+func (scheduler *schedulerImpl) writeResource(ctx context.Context, write *engine.ResourceWrite) error {
+	if scheduler.batcher == nil {
+		return scheduler.Storage.WriteResources([]*engine.ResourceWrite{write})[0]
+	}
+
+	return scheduler.batcher.write(ctx, write)
+}
+
 func (scheduler *schedulerImpl) GrpcHandle(server *grpc.Server) error {
+	if scheduler.tls.Enabled() {
+		scheduler.InfoF("skip plain grpc server for tcc.Scheduler, tls enabled")
+		return nil
+	}
+
 	tcc.RegisterEngineServer(server, scheduler)
 	scheduler.InfoF("register grpc server for tcc.Scheduler ")
 	return nil
 }
 
 func (scheduler *schedulerImpl) NewTx(ctx context.Context, request *tcc.NewTxRequest) (*tcc.NewTxResponse, error) {
+	if err := scheduler.authorize(ctx, "NewTx", RoleInitiator, ""); err != nil {
+		return nil, err
+	}
 
 	txid, err := scheduler.newTx(ctx, request.Txid)
 
@@ -49,18 +124,25 @@ func (scheduler *schedulerImpl) newTx(ctx context.Context, pid string) (string,
 		Status: tcc.TxStatus_Created,
 	}
 
-	if err := scheduler.Storage.NewTx(tx); err != nil {
+	history := scheduler.newHistory(engine.HistoryCreate, engine.ActorInitiator, scheduler.initiator(ctx))
+
+	if err := scheduler.Storage.NewTx(tx, history); err != nil {
 		return "", err
 	}
 
 	scheduler.DebugF("new tx %s", tx.ID)
 
+	metrics.Transactions.WithLabelValues(metrics.EventCreated).Inc()
+
 	return tx.ID, nil
 }
 
 func (scheduler *schedulerImpl) Commit(ctx context.Context, request *tcc.CommitTxRequest) (*tcc.CommitTxResponse, error) {
+	if err := scheduler.authorize(ctx, "Commit", RoleInitiator, ""); err != nil {
+		return nil, err
+	}
 
-	ok, err := scheduler.Storage.UpdateTxStatus(request.Txid, tcc.TxStatus_Confirmed)
+	ok, err := scheduler.updateTxStatus(ctx, request.Txid, tcc.TxStatus_Confirmed)
 
 	if err != nil {
 		return nil, err
@@ -74,7 +156,11 @@ func (scheduler *schedulerImpl) Commit(ctx context.Context, request *tcc.CommitT
 }
 
 func (scheduler *schedulerImpl) Cancel(ctx context.Context, request *tcc.CancelTxRequest) (*tcc.CancelTxResponse, error) {
-	ok, err := scheduler.Storage.UpdateTxStatus(request.Txid, tcc.TxStatus_Canceled)
+	if err := scheduler.authorize(ctx, "Cancel", RoleInitiator, ""); err != nil {
+		return nil, err
+	}
+
+	ok, err := scheduler.updateTxStatus(ctx, request.Txid, tcc.TxStatus_Canceled)
 
 	if err != nil {
 		return nil, err
@@ -87,7 +173,143 @@ func (scheduler *schedulerImpl) Cancel(ctx context.Context, request *tcc.CancelT
 	return &tcc.CancelTxResponse{}, nil
 }
 
+// casRetries max retry times of one status update on version conflict
+const casRetries = 5
+
+// finalStatus the confirmed, canceled and timeout status can't be changed any more
+func finalStatus(status tcc.TxStatus) bool {
+	return status == tcc.TxStatus_Confirmed || status == tcc.TxStatus_Canceled || status == tcc.TxStatus_Timeout
+}
+
+// cas call f until it not return engine.ErrConflict or retry times exhausted
+func (scheduler *schedulerImpl) cas(name string, f func() error) error {
+	for i := 0; i < casRetries; i++ {
+		err := f()
+
+		if !xerrors.Is(err, engine.ErrConflict) {
+			return err
+		}
+
+		scheduler.DebugF("%s version conflict, retry %d", name, i+1)
+	}
+
+	scheduler.WarnF("%s version conflict, retry times exhausted", name)
+
+	return status.Errorf(codes.Aborted, "%s version conflict", name)
+}
+
+// updateTxStatus update tx status, return false if the tx not found
+func (scheduler *schedulerImpl) updateTxStatus(ctx context.Context, txid string, target tcc.TxStatus) (bool, error) {
+	var current *engine.Transaction
+	var transited bool
+
+	actor := scheduler.initiator(ctx)
+
+	err := scheduler.cas(fmt.Sprintf("update tx %s status to %s", txid, target), func() error {
+		tx, err := scheduler.Storage.GetTx(txid)
+
+		if err != nil {
+			return err
+		}
+
+		current = tx
+
+		if tx == nil {
+			return nil
+		}
+
+		// the timeout tx is canceled by the reload, cancel it again is a redelivery
+		if tx.Status == target || tx.Status == tcc.TxStatus_Timeout && target == tcc.TxStatus_Canceled {
+			history := scheduler.newHistory(engine.HistoryRedeliver, engine.ActorInitiator, actor)
+			history.Tx, history.FromStatus, history.ToStatus = txid, tx.Status, target
+
+			return scheduler.Storage.AppendHistory(history)
+		}
+
+		if finalStatus(tx.Status) {
+			return status.Errorf(codes.FailedPrecondition, "tx %s already %s", txid, tx.Status)
+		}
+
+		err = scheduler.Storage.UpdateTxStatus(tx, target, scheduler.newHistory(engine.HistoryTransit, engine.ActorInitiator, actor))
+
+		transited = err == nil
+
+		return err
+	})
+
+	if err != nil && current != nil {
+		scheduler.reject(current.ID, "", current.Status, target, engine.ActorInitiator, actor, err)
+	}
+
+	if transited {
+		if target == tcc.TxStatus_Confirmed {
+			metrics.Transactions.WithLabelValues(metrics.EventConfirmed).Inc()
+		} else {
+			metrics.Transactions.WithLabelValues(metrics.EventCanceled).Inc()
+		}
+	}
+
+	return current != nil, err
+}
+
+// updateResourceStatus update resource status, skip if the resource not found
+func (scheduler *schedulerImpl) updateResourceStatus(ctx context.Context, txid, rid, agent, resource string, target tcc.TxStatus) error {
+	return scheduler.transitResource(ctx, txid, rid, agent, resource, target, "")
+}
+
+// transitResource update resource status, the failure of the resource require is recorded in the history if
+// not empty
+func (scheduler *schedulerImpl) transitResource(ctx context.Context, txid, rid, agent, resource string, target tcc.TxStatus, failure string) error {
+	var current *engine.Resource
+
+	name := fmt.Sprintf("update resource(%s,%s,%s,%s) status to %s", txid, rid, agent, resource, target)
+
+	err := scheduler.cas(name, func() error {
+		var err error
+
+		current, err = scheduler.Storage.GetResource(txid, rid, agent, resource)
+
+		if err != nil || current == nil {
+			return err
+		}
+
+		if current.Status == target {
+			history := scheduler.newHistory(engine.HistoryRedeliver, engine.ActorParticipant, agent)
+			history.Tx, history.Resource, history.FromStatus, history.ToStatus = txid, current.ID, current.Status, target
+
+			return scheduler.Storage.AppendHistory(history)
+		}
+
+		if finalStatus(current.Status) || target == tcc.TxStatus_Created {
+			return status.Errorf(codes.FailedPrecondition,
+				"resource(%s,%s,%s,%s) already %s", txid, rid, agent, resource, current.Status)
+		}
+
+		history := scheduler.newHistory(engine.HistoryTransit, engine.ActorParticipant, agent)
+
+		if failure != "" {
+			history.Event, history.Error = engine.HistoryFail, failure
+		}
+
+		return scheduler.writeResource(ctx, &engine.ResourceWrite{
+			Resource: current,
+			Update:   true,
+			Status:   target,
+			History:  history,
+		})
+	})
+
+	if err != nil && current != nil {
+		scheduler.reject(txid, current.ID, current.Status, target, engine.ActorParticipant, agent, err)
+	}
+
+	return err
+}
+
 func (scheduler *schedulerImpl) BeginLockResource(ctx context.Context, request *tcc.BeginLockResourceRequest) (*tcc.BeginLockResourceRespose, error) {
+	if err := scheduler.authorize(ctx, "BeginLockResource", RoleParticipant, request.Agent); err != nil {
+		return nil, err
+	}
 
 	resource := &engine.Resource{
 		ID:       "R_" + scheduler.SNode.Generate().String(),
@@ -98,7 +320,9 @@ func (scheduler *schedulerImpl) BeginLockResource(ctx context.Context, request *
 		Status:   tcc.TxStatus_Created,
 	}
 
-	if err := scheduler.Storage.NewResource(resource); err != nil {
+	history := scheduler.newHistory(engine.HistoryCreate, engine.ActorParticipant, request.Agent)
+
+	if err := scheduler.writeResource(ctx, &engine.ResourceWrite{Resource: resource, History: history}); err != nil {
 		return nil, err
 	}
 
@@ -106,24 +330,197 @@ func (scheduler *schedulerImpl) BeginLockResource(ctx context.Context, request *
 }
 
 func (scheduler *schedulerImpl) EndLockResource(ctx context.Context, request *tcc.EndLockResourceRequest) (*tcc.EndLockResourceRespose, error) {
+	if err := scheduler.authorize(ctx, "EndLockResource", RoleParticipant, request.Agent); err != nil {
+		return nil, err
+	}
 
-	if err := scheduler.Storage.
-		UpdateResourceStatus(request.Txid, request.Rid, request.Agent, request.Resource, tcc.TxStatus_Locked); err != nil {
+	if err := scheduler.
+		updateResourceStatus(ctx, request.Txid, request.Rid, request.Agent, request.Resource, tcc.TxStatus_Locked); err != nil {
 		return nil, err
 	}
 
 	return &tcc.EndLockResourceRespose{}, nil
 }
 
+// FailLockResource cancel the resource whose require failed, the agent cancels it without calling the
+// participant
+func (scheduler *schedulerImpl) FailLockResource(ctx context.Context, request *tcc.FailLockResourceRequest) (*tcc.FailLockResourceRespose, error) {
+	if err := scheduler.authorize(ctx, "FailLockResource", RoleParticipant, request.Agent); err != nil {
+		return nil, err
+	}
+
+	reason := request.Reason
+
+	if reason == "" {
+		reason = "require failed"
+	}
+
+	err := scheduler.transitResource(ctx, request.Txid, request.Rid, request.Agent, request.Resource, tcc.TxStatus_Canceled, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcc.FailLockResourceRespose{}, nil
+}
+
 func (scheduler *schedulerImpl) AttachAgent(request *tcc.AttachAgentRequest, agentServer tcc.Engine_AttachAgentServer) error {
+	if err := scheduler.authorize(agentServer.Context(), "AttachAgent", RoleParticipant, request.Agent); err != nil {
+		return err
+	}
+
 	scheduler.Notifier.RunAgent(request.Agent, agentServer)
 	return nil
 }
 
 func (scheduler *schedulerImpl) ResourceStatusChanged(ctx context.Context, request *tcc.ResourceStatusChangedRequest) (*tcc.ResourceStatusChangedRespose, error) {
-	if err := scheduler.Storage.UpdateResourcesStatus(request.Txid, request.Agent, request.Resource, request.Status); err != nil {
+	if err := scheduler.authorize(ctx, "ResourceStatusChanged", RoleParticipant, request.Agent); err != nil {
 		return nil, err
 	}
 
+	resources, err := scheduler.Storage.GetResourceByTx(request.Txid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transited := false
+
+	for _, resource := range resources {
+		if resource.Agent != request.Agent || resource.Resource != request.Resource {
+			continue
+		}
+
+		// the resource failed or finished by other status, the report can't change it
+		if finalStatus(resource.Status) && resource.Status != request.Status {
+			scheduler.reject(request.Txid, resource.ID, resource.Status, request.Status, engine.ActorParticipant, request.Agent,
+				status.Errorf(codes.FailedPrecondition, "resource %s already %s", resource.ID, resource.Status))
+			continue
+		}
+
+		err := scheduler.updateResourceStatus(ctx, request.Txid, resource.Require, request.Agent, request.Resource, request.Status)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transited = transited || resource.Status != request.Status
+		resource.Status = request.Status
+	}
+
+	if transited && request.Status == tcc.TxStatus_Confirmed {
+		scheduler.observeConfirmed(request.Txid, resources)
+	}
+
 	return &tcc.ResourceStatusChangedRespose{}, nil
 }
+
+// ResourceCommandFailed record the confirm or cancel handler failure of the agent resources in the history, the
+// resource status is kept and the command delivered again, or the resource is moved to Failed and not delivered
+// again if the failure is permanent
+func (scheduler *schedulerImpl) ResourceCommandFailed(ctx context.Context, request *tcc.ResourceCommandFailedRequest) (*tcc.ResourceCommandFailedResponse, error) {
+	if err := scheduler.authorize(ctx, "ResourceCommandFailed", RoleParticipant, request.Agent); err != nil {
+		return nil, err
+	}
+
+	resources, err := scheduler.Storage.GetResourceByTx(request.Txid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	target := tcc.TxStatus_Canceled
+
+	if request.Command == tcc.AgentCommand_COMMMIT {
+		target = tcc.TxStatus_Confirmed
+	}
+
+	for _, resource := range resources {
+		if resource.Agent != request.Agent || resource.Resource != request.Resource || finalStatus(resource.Status) {
+			continue
+		}
+
+		if request.Permanent {
+			err := scheduler.transitResource(ctx, request.Txid, resource.Require, request.Agent, request.Resource,
+				tcc.TxStatus_Failed, fmt.Sprintf("%s failed: %s", request.Command, request.Error))
+
+			if err != nil {
+				return nil, err
+			}
+
+			metrics.DeadLetters.WithLabelValues(request.Agent, metrics.ReasonFailed).Inc()
+
+			continue
+		}
+
+		history := scheduler.newHistory(engine.HistoryFail, engine.ActorParticipant, request.Agent)
+		history.Tx, history.Resource, history.FromStatus, history.ToStatus = request.Txid, resource.ID, resource.Status, target
+		history.Error = request.Error
+
+		if err := scheduler.Storage.AppendHistory(history); err != nil {
+			return nil, err
+		}
+	}
+
+	scheduler.WarnF("agent %s %s tx %s resource %s failed(permanent:%v): %s",
+		request.Agent, request.Command, request.Txid, request.Resource, request.Permanent, request.Error)
+
+	return &tcc.ResourceCommandFailedResponse{}, nil
+}
+
+// observeConfirmed observe the confirm latency of the committed tx if all its resources confirmed
+func (scheduler *schedulerImpl) observeConfirmed(txid string, resources []*engine.Resource) {
+	for _, resource := range resources {
+		if resource.Status != tcc.TxStatus_Confirmed {
+			return
+		}
+	}
+
+	tx, err := scheduler.Storage.GetTx(txid)
+
+	if err != nil || tx == nil || tx.Status != tcc.TxStatus_Confirmed {
+		return
+	}
+
+	// the commit is the last update of the tx row
+	metrics.ConfirmSeconds.Observe(time.Since(tx.UpdatedTime).Seconds())
+}
+
+func (scheduler *schedulerImpl) GetArchivedTx(ctx context.Context, request *tcc.GetArchivedTxRequest) (*tcc.GetArchivedTxResponse, error) {
+	if err := scheduler.authorize(ctx, "GetArchivedTx", RoleAdmin, ""); err != nil {
+		return nil, err
+	}
+
+	tx, resources, err := scheduler.Storage.GetArchivedTx(request.Txid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tx == nil {
+		return nil, status.Errorf(codes.NotFound, "archived tx %s not found", request.Txid)
+	}
+
+	resp := &tcc.GetArchivedTxResponse{
+		Txid:         tx.ID,
+		Pid:          tx.PID,
+		Status:       tx.Status,
+		CreatedTime:  tx.CreatedTime.Unix(),
+		UpdatedTime:  tx.UpdatedTime.Unix(),
+		ArchivedTime: tx.ArchivedTime.Unix(),
+	}
+
+	for _, resource := range resources {
+		resp.Resources = append(resp.Resources, &tcc.TxResource{
+			Id:          resource.ID,
+			Rid:         resource.Require,
+			Agent:       resource.Agent,
+			Resource:    resource.Resource.Resource,
+			Status:      resource.Status,
+			CreatedTime: resource.CreatedTime.Unix(),
+			UpdatedTime: resource.UpdatedTime.Unix(),
+		})
+	}
+
+	return resp, nil
+}
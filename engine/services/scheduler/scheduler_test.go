@@ -0,0 +1,620 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/dynamicgo/slf4go"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
+	"github.com/gomeshnetwork/tcc/engine/services/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type mockNotifier struct {
+	sync.Mutex
+	commits []string
+	cancels []string
+}
+
+func (notifier *mockNotifier) CommitTx(id string) {
+	notifier.Lock()
+	defer notifier.Unlock()
+	notifier.commits = append(notifier.commits, id)
+}
+
+func (notifier *mockNotifier) CancelTx(id string) {
+	notifier.Lock()
+	defer notifier.Unlock()
+	notifier.cancels = append(notifier.cancels, id)
+}
+
+func (notifier *mockNotifier) RunAgent(agent string, server tcc.Engine_AttachAgentServer) {
+}
+
+func newTestScheduler(t testing.TB) (*schedulerImpl, *mockNotifier) {
+	snode, err := snowflake.NewNode(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &mockNotifier{}
+
+	return &schedulerImpl{
+		Logger:   slf4go.Get("tcc-scheduler"),
+		SNode:    snode,
+		Storage:  storage.NewMemory(),
+		Notifier: notifier,
+	}, notifier
+}
+
+func TestCommit(t *testing.T) {
+	scheduler, notifier := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	_, err = scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 || resources[0].Status != tcc.TxStatus_Locked {
+		t.Fatalf("unexpect resources %v", resources)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.commits) != 1 || notifier.commits[0] != txid {
+		t.Fatalf("unexpect commit notify %v", notifier.commits)
+	}
+
+	_, err = scheduler.ResourceStatusChanged(ctx, &tcc.ResourceStatusChangedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Status: tcc.TxStatus_Confirmed,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err = scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resources[0].Status != tcc.TxStatus_Confirmed {
+		t.Fatalf("unexpect resource status %s", resources[0].Status)
+	}
+}
+
+func TestCancelUnknownTx(t *testing.T) {
+	scheduler, notifier := newTestScheduler(t)
+
+	if _, err := scheduler.Cancel(context.Background(), &tcc.CancelTxRequest{Txid: "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.cancels) != 0 {
+		t.Fatalf("unexpect cancel notify %v", notifier.cancels)
+	}
+}
+
+func TestCommitAfterTimeout(t *testing.T) {
+	scheduler, notifier := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := scheduler.Storage.GetTx(resp.Txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := scheduler.newHistory(engine.HistoryTransit, engine.ActorNotifier, "agent")
+
+	if err := scheduler.Storage.UpdateTxStatus(tx, tcc.TxStatus_Timeout, history); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: resp.Txid}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expect FailedPrecondition for the timeout tx, got %v", err)
+	}
+
+	if _, err := scheduler.Cancel(ctx, &tcc.CancelTxRequest{Txid: resp.Txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.commits) != 0 || len(notifier.cancels) != 1 {
+		t.Fatalf("expect the timeout tx canceled only, got %v %v", notifier.commits, notifier.cancels)
+	}
+
+	if tx, _ := scheduler.Storage.GetTx(resp.Txid); tx.Status != tcc.TxStatus_Timeout {
+		t.Fatalf("expect tx kept timeout, got %s", tx.Status)
+	}
+}
+
+func TestConcurrentCommitCancel(t *testing.T) {
+	const workers = 16
+
+	scheduler, notifier := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+
+			if i%2 == 0 {
+				_, err = scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid})
+			} else {
+				_, err = scheduler.Cancel(ctx, &tcc.CancelTxRequest{Txid: txid})
+			}
+
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expect FailedPrecondition for the losers, got %v", err)
+		}
+	}
+
+	tx, err := scheduler.Storage.GetTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the winner status must not be overwritten and only the winner notified
+	switch tx.Status {
+	case tcc.TxStatus_Confirmed:
+		if len(notifier.cancels) != 0 || len(notifier.commits) == 0 {
+			t.Fatalf("unexpect notify commits %v cancels %v", notifier.commits, notifier.cancels)
+		}
+	case tcc.TxStatus_Canceled:
+		if len(notifier.commits) != 0 || len(notifier.cancels) == 0 {
+			t.Fatalf("unexpect notify commits %v cancels %v", notifier.commits, notifier.cancels)
+		}
+	default:
+		t.Fatalf("unexpect tx status %s", tx.Status)
+	}
+
+	if tx.Version != 2 {
+		t.Fatalf("expect tx updated exactly once, got version %d", tx.Version)
+	}
+}
+
+func TestLockAfterCancel(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	_, err = scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.ResourceStatusChanged(ctx, &tcc.ResourceStatusChangedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Status: tcc.TxStatus_Canceled,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expect FailedPrecondition for late lock, got %v", err)
+	}
+
+	resources, err := scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resources[0].Status != tcc.TxStatus_Canceled {
+		t.Fatalf("expect canceled status kept, got %s", resources[0].Status)
+	}
+}
+
+func TestTxHistory(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	_, err = scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Cancel(ctx, &tcc.CancelTxRequest{Txid: txid}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expect FailedPrecondition, got %v", err)
+	}
+
+	_, err = scheduler.ResourceStatusChanged(ctx, &tcc.ResourceStatusChangedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Status: tcc.TxStatus_Confirmed,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := scheduler.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: txid})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+
+	for _, h := range history.Histories {
+		events = append(events, fmt.Sprintf("%s:%s:%s", h.Event, h.ActorType, h.ToStatus))
+	}
+
+	expect := "[create:initiator:Created create:participant:Created transit:initiator:Confirmed " +
+		"redeliver:initiator:Confirmed reject:initiator:Canceled transit:participant:Confirmed]"
+
+	if fmt.Sprint(events) != expect {
+		t.Fatalf("unexpect histories %v", events)
+	}
+
+	if reject := history.Histories[4]; reject.Error == "" || reject.FromStatus != tcc.TxStatus_Confirmed {
+		t.Fatalf("unexpect reject history %v", reject)
+	}
+
+	if _, err := scheduler.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expect NotFound, got %v", err)
+	}
+}
+
+func TestFailLockResource(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	for _, rid := range []string{"R_1", "R_2"} {
+		_, err = scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+			Txid: txid, Rid: rid, Agent: "agent", Resource: "/test/Lock",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = scheduler.FailLockResource(ctx, &tcc.FailLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock", Reason: "out of stock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+		Txid: txid, Rid: "R_2", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.ResourceStatusChanged(ctx, &tcc.ResourceStatusChangedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Status: tcc.TxStatus_Confirmed,
+	})
+
+	if err != nil {
+		t.Fatalf("expect the failed resource skipped, got %v", err)
+	}
+
+	resources, err := scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resource := range resources {
+		expect := tcc.TxStatus_Confirmed
+
+		if resource.Require == "R_1" {
+			expect = tcc.TxStatus_Canceled
+		}
+
+		if resource.Status != expect {
+			t.Fatalf("expect resource %s %s, got %s", resource.Require, expect, resource.Status)
+		}
+	}
+
+	history, err := scheduler.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: txid})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := false
+
+	for _, h := range history.Histories {
+		if h.Event == "fail" && h.Error == "out of stock" && h.ToStatus == tcc.TxStatus_Canceled {
+			failed = true
+		}
+	}
+
+	if !failed {
+		t.Fatalf("expect fail history, got %v", history.Histories)
+	}
+}
+
+func TestResourceCommandFailed(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	_, err = scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+		Txid: txid, Rid: "R_1", Agent: "agent", Resource: "/test/Lock",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = scheduler.ResourceCommandFailed(ctx, &tcc.ResourceCommandFailedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Command: tcc.AgentCommand_COMMMIT, Error: "handler timeout",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 || resources[0].Status != tcc.TxStatus_Locked {
+		t.Fatalf("expect resource kept locked for redelivery, got %v", resources)
+	}
+
+	history, err := scheduler.GetTxHistory(ctx, &tcc.GetTxHistoryRequest{Txid: txid})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := history.Histories[len(history.Histories)-1]
+
+	if last.Event != "fail" || last.Error != "handler timeout" || last.FromStatus != tcc.TxStatus_Locked ||
+		last.ToStatus != tcc.TxStatus_Confirmed || last.Actor != "agent" {
+		t.Fatalf("expect handler fail history, got %v", last)
+	}
+
+	_, err = scheduler.ResourceCommandFailed(ctx, &tcc.ResourceCommandFailedRequest{
+		Txid: txid, Agent: "agent", Resource: "/test/Lock", Command: tcc.AgentCommand_COMMMIT, Error: "account closed", Permanent: true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err = scheduler.Storage.GetResourceByTx(txid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 || resources[0].Status != tcc.TxStatus_Failed {
+		t.Fatalf("expect resource failed permanently, got %v", resources)
+	}
+
+	txs, err := scheduler.Storage.QueryNotifyTx("agent")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 0 {
+		t.Fatalf("expect failed resource not delivered again, got %v", txs)
+	}
+}
+
+// confirmCount the observations of the confirm latency
+func confirmCount(t *testing.T) uint64 {
+	metric := &dto.Metric{}
+
+	if err := metrics.ConfirmSeconds.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMetrics(t *testing.T) {
+	scheduler, _ := newTestScheduler(t)
+
+	ctx := context.Background()
+
+	created := testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventCreated))
+	confirmed := testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventConfirmed))
+	observed := confirmCount(t)
+
+	resp, err := scheduler.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid := resp.Txid
+
+	for _, rid := range []string{"R_1", "R_2"} {
+		if _, err := scheduler.BeginLockResource(ctx, &tcc.BeginLockResourceRequest{
+			Txid: txid, Rid: rid, Agent: "agent", Resource: "/test/" + rid,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := scheduler.EndLockResource(ctx, &tcc.EndLockResourceRequest{
+			Txid: txid, Rid: rid, Agent: "agent", Resource: "/test/" + rid,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the redelivered commit counts once
+	for i := 0; i < 2; i++ {
+		if _, err := scheduler.Commit(ctx, &tcc.CommitTxRequest{Txid: txid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// observed once all resources confirmed, not again by the redelivered report
+	for _, rid := range []string{"R_1", "R_2", "R_2"} {
+		if _, err := scheduler.ResourceStatusChanged(ctx, &tcc.ResourceStatusChangedRequest{
+			Txid: txid, Agent: "agent", Resource: "/test/" + rid, Status: tcc.TxStatus_Confirmed,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if rid == "R_1" && confirmCount(t) != observed {
+			t.Fatal("confirm latency observed before all resources confirmed")
+		}
+	}
+
+	if testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventCreated)) != created+1 {
+		t.Fatal("expect created counted once")
+	}
+
+	if testutil.ToFloat64(metrics.Transactions.WithLabelValues(metrics.EventConfirmed)) != confirmed+1 {
+		t.Fatal("expect confirmed counted once")
+	}
+
+	if confirmCount(t) != observed+1 {
+		t.Fatal("expect confirm latency observed once")
+	}
+}
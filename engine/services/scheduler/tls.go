@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"context"
+	"net"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// serveTLS serve the engine rpc on its own tls listener, the gomesh grpc server has no transport security
+func (scheduler *schedulerImpl) serveTLS() error {
+	conf, err := scheduler.tls.Server()
+
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", scheduler.laddr)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "create tls listener %s error", scheduler.laddr)
+	}
+
+	scheduler.server = grpc.NewServer(grpc.Creds(credentials.NewTLS(conf)))
+
+	tcc.RegisterEngineServer(scheduler.server, scheduler)
+
+	scheduler.InfoF("serve tls grpc server for tcc.Scheduler on %s, client auth %v", listener.Addr(), scheduler.tls.ClientAuth)
+
+	go func() {
+		if err := scheduler.server.Serve(listener); err != nil {
+			scheduler.ErrorF("tls grpc serve error: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// authAgent check the agent of the request is the common name of the client certificate if client auth enabled
+func (scheduler *schedulerImpl) authAgent(ctx context.Context, agent string) error {
+	if agent == "" || !scheduler.tls.Enabled() || !scheduler.tls.ClientAuth {
+		return nil
+	}
+
+	identity, ok := tlsconfig.Identity(ctx)
+
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "client certificate required")
+	}
+
+	if identity != agent {
+		return status.Errorf(codes.PermissionDenied, "certificate of %s can't act as agent %s", identity, agent)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/tlsconfig"
+	"github.com/gomeshnetwork/tcc/tlsconfig/tlstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func dialTLS(t *testing.T, addr string, conf *tlsconfig.Config) tcc.EngineClient {
+	tlsConf, err := conf.Client()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tcc.NewEngineClient(conn)
+}
+
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestMutualTLS(t *testing.T) {
+	certs := tlstest.New(t)
+
+	cert, key := certs.Server("engine")
+
+	scheduler, _ := newTestScheduler(t)
+
+	scheduler.tls = &tlsconfig.Config{Cert: cert, Key: key, CA: certs.CA, ClientAuth: true}
+	scheduler.laddr = freeAddr(t)
+
+	if err := scheduler.serveTLS(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer scheduler.server.Stop()
+
+	_, port, _ := net.SplitHostPort(scheduler.laddr)
+
+	addr := "localhost:" + port
+
+	clientCert, clientKey := certs.Client("agent-a")
+
+	client := dialTLS(t, addr, &tlsconfig.Config{Cert: clientCert, Key: clientKey, CA: certs.CA})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.NewTx(ctx, &tcc.NewTxRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &tcc.BeginLockResourceRequest{Txid: resp.Txid, Rid: "R_1", Agent: "agent-a", Resource: "/test/Lock"}
+
+	if _, err := client.BeginLockResource(ctx, request); err != nil {
+		t.Fatal(err)
+	}
+
+	request = &tcc.BeginLockResourceRequest{Txid: resp.Txid, Rid: "R_2", Agent: "agent-b", Resource: "/test/Lock"}
+
+	if _, err := client.BeginLockResource(ctx, request); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expect PermissionDenied acting as another agent, got %v", err)
+	}
+
+	anonymous := dialTLS(t, addr, &tlsconfig.Config{CA: certs.CA})
+
+	if _, err := anonymous.NewTx(ctx, &tcc.NewTxRequest{}, grpc.FailFast(true)); err == nil {
+		t.Fatalf("expect client without certificate rejected")
+	}
+}
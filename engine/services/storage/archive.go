@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// archiveInsertBatch keep multi rows insert under the sqlite bind parameters limit
+const archiveInsertBatch = 50
+
+func (storage *storageImpl) QueryFinishedTx(status tcc.TxStatus, before time.Time, limit int) ([]*engine.Transaction, error) {
+	trans := make([]*engine.Transaction, 0)
+
+	args := []interface{}{status, storage.formatTime(before)}
+	args = append(args, finishedArgs()...)
+	args = append(args, limit)
+
+	err := storage.engine.SQL(storage.dialect.queryFinishedTx(), args...).Find(&trans)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "query finished tx(%s,%s) error", status, before)
+	}
+
+	return trans, nil
+}
+
+// formatTime format time as xorm stored datetime column
+func (storage *storageImpl) formatTime(t time.Time) string {
+	return t.In(storage.engine.DatabaseTZ).Format("2006-01-02 15:04:05")
+}
+
+func (storage *storageImpl) ArchiveTx(ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	session := storage.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, xerrors.Wrapf(err, "archive tx begin session error")
+	}
+
+	ids, err := storage.lockFinishedTx(session, ids)
+
+	if err == nil && len(ids) > 0 {
+		err = storage.archiveTx(session, ids)
+	}
+
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, xerrors.Wrapf(err, "archive tx commit session error")
+	}
+
+	return len(ids), nil
+}
+
+// lockFinishedTx re-check the transactions are still finished in the session, so the resources
+// or child transactions created after QueryFinishedTx are not archived or deleted
+func (storage *storageImpl) lockFinishedTx(session *xorm.Session, ids []string) ([]string, error) {
+	args := make([]interface{}, 0, len(ids)+10)
+
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	args = append(args, tcc.TxStatus_Confirmed, tcc.TxStatus_Canceled, tcc.TxStatus_Timeout)
+	args = append(args, finishedArgs()...)
+
+	trans := make([]*engine.Transaction, 0, len(ids))
+
+	if err := session.SQL(storage.dialect.lockFinishedTx(len(ids)), args...).Find(&trans); err != nil {
+		return nil, xerrors.Wrapf(err, "lock finished txs error")
+	}
+
+	finished := make([]string, 0, len(trans))
+
+	for _, tx := range trans {
+		finished = append(finished, tx.ID)
+	}
+
+	return finished, nil
+}
+
+func (storage *storageImpl) archiveTx(session *xorm.Session, ids []string) error {
+	trans := make([]*engine.Transaction, 0)
+
+	if err := session.In("i_d", ids).Find(&trans); err != nil {
+		return xerrors.Wrapf(err, "archive tx load txs error")
+	}
+
+	resources := make([]*engine.Resource, 0)
+
+	if err := session.In("tx", ids).Find(&resources); err != nil {
+		return xerrors.Wrapf(err, "archive tx load resources error")
+	}
+
+	histories := make([]*engine.History, 0)
+
+	if err := session.In("tx", ids).Find(&histories); err != nil {
+		return xerrors.Wrapf(err, "archive tx load histories error")
+	}
+
+	now := time.Now()
+
+	archivedTxs := make([]*engine.ArchivedTransaction, 0, len(trans))
+
+	for _, tx := range trans {
+		archivedTxs = append(archivedTxs, &engine.ArchivedTransaction{Transaction: *tx, ArchivedTime: now})
+	}
+
+	archivedResources := make([]*engine.ArchivedResource, 0, len(resources))
+
+	for _, resource := range resources {
+		archivedResources = append(archivedResources, &engine.ArchivedResource{Resource: *resource, ArchivedTime: now})
+	}
+
+	archivedHistories := make([]*engine.ArchivedHistory, 0, len(histories))
+
+	for _, history := range histories {
+		archivedHistories = append(archivedHistories, &engine.ArchivedHistory{History: *history, ArchivedTime: now})
+	}
+
+	for len(archivedTxs) > 0 {
+		batch := archivedTxs
+
+		if len(batch) > archiveInsertBatch {
+			batch = batch[:archiveInsertBatch]
+		}
+
+		if _, err := session.NoAutoTime().Insert(&batch); err != nil {
+			return xerrors.Wrapf(err, "archive tx insert txs error")
+		}
+
+		archivedTxs = archivedTxs[len(batch):]
+	}
+
+	for len(archivedResources) > 0 {
+		batch := archivedResources
+
+		if len(batch) > archiveInsertBatch {
+			batch = batch[:archiveInsertBatch]
+		}
+
+		if _, err := session.NoAutoTime().Insert(&batch); err != nil {
+			return xerrors.Wrapf(err, "archive tx insert resources error")
+		}
+
+		archivedResources = archivedResources[len(batch):]
+	}
+
+	for len(archivedHistories) > 0 {
+		batch := archivedHistories
+
+		if len(batch) > archiveInsertBatch {
+			batch = batch[:archiveInsertBatch]
+		}
+
+		if _, err := session.NoAutoTime().Insert(&batch); err != nil {
+			return xerrors.Wrapf(err, "archive tx insert histories error")
+		}
+
+		archivedHistories = archivedHistories[len(batch):]
+	}
+
+	return storage.deleteTx(session, ids)
+}
+
+func (storage *storageImpl) DeleteTx(ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	session := storage.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, xerrors.Wrapf(err, "delete tx begin session error")
+	}
+
+	ids, err := storage.lockFinishedTx(session, ids)
+
+	if err == nil && len(ids) > 0 {
+		err = storage.deleteTx(session, ids)
+	}
+
+	if err != nil {
+		session.Rollback()
+		return 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, xerrors.Wrapf(err, "delete tx commit session error")
+	}
+
+	return len(ids), nil
+}
+
+func (storage *storageImpl) deleteTx(session *xorm.Session, ids []string) error {
+	if _, err := session.In("tx", ids).Delete(new(engine.History)); err != nil {
+		return xerrors.Wrapf(err, "delete tx histories error")
+	}
+
+	if _, err := session.In("tx", ids).Delete(new(engine.Resource)); err != nil {
+		return xerrors.Wrapf(err, "delete tx resources error")
+	}
+
+	if _, err := session.In("i_d", ids).Delete(new(engine.Transaction)); err != nil {
+		return xerrors.Wrapf(err, "delete txs error")
+	}
+
+	return nil
+}
+
+func (storage *storageImpl) GetArchivedTx(id string) (*engine.ArchivedTransaction, []*engine.ArchivedResource, error) {
+	tx := &engine.ArchivedTransaction{}
+
+	ok, err := storage.engine.Where(storage.dialect.where("i_d"), id).Get(tx)
+
+	if err != nil {
+		return nil, nil, xerrors.Wrapf(err, "get archived tx %s error", id)
+	}
+
+	if !ok {
+		return nil, nil, nil
+	}
+
+	resources := make([]*engine.ArchivedResource, 0)
+
+	if err := storage.engine.Where(storage.dialect.where("tx"), id).Find(&resources); err != nil {
+		return nil, nil, xerrors.Wrapf(err, "get archived resources by tx %s error", id)
+	}
+
+	return tx, resources, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+func (storage *storageImpl) WriteResources(writes []*engine.ResourceWrite) []error {
+	errs := make([]error, len(writes))
+
+	err := storage.transact(func(session *xorm.Session) error {
+		for _, write := range writes {
+			if err := storage.writeResource(session, write); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		for _, write := range writes {
+			committed(write)
+		}
+
+		return errs
+	}
+
+	if len(writes) == 1 {
+		errs[0] = err
+		return errs
+	}
+
+	// one failed statement aborts the whole transaction on some databases, retry the writes one by one
+	// to find out the failed ones
+	storage.DebugF("batch write %d resources error, retry one by one: %s", len(writes), err)
+
+	for i, write := range writes {
+		write := write
+
+		errs[i] = storage.transact(func(session *xorm.Session) error {
+			return storage.writeResource(session, write)
+		})
+
+		if errs[i] == nil {
+			committed(write)
+		}
+	}
+
+	return errs
+}
+
+func (storage *storageImpl) writeResource(session *xorm.Session, write *engine.ResourceWrite) error {
+	if write.Update {
+		return storage.updateResourceStatus(session, write.Resource, write.Status, write.History)
+	}
+
+	return storage.newResource(session, write.Resource, write.History)
+}
+
+// committed update the resource of the committed status update
+func committed(write *engine.ResourceWrite) {
+	if write.Update {
+		write.Resource.Status = write.Status
+		write.Resource.Version++
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dynamicgo/xxorm"
+	"github.com/go-xorm/core"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// sqlDialect build raw sql with the identifier quoting of the target database
+type sqlDialect struct {
+	core.Dialect
+	db core.DbType // target database type
+}
+
+func newSQLDialect(db core.DbType) *sqlDialect {
+	return &sqlDialect{
+		Dialect: core.QueryDialect(db),
+		db:      db,
+	}
+}
+
+// where build `col1 = ? AND col2 = ?` condition
+func (dialect *sqlDialect) where(cols ...string) string {
+	conds := make([]string, 0, len(cols))
+
+	for _, col := range cols {
+		conds = append(conds, fmt.Sprintf("%s = ?", dialect.Quote(col)))
+	}
+
+	return strings.Join(conds, " AND ")
+}
+
+// queryNotifyTx build sql selecting the transactions of the latest locked resources of one agent,
+// the limit subquery is wrapped as derived table which is supported by postgres, sqlite and mysql
+func (dialect *sqlDialect) queryNotifyTx() string {
+	return fmt.Sprintf(
+		"SELECT * FROM %s WHERE %s IN (SELECT DISTINCT(%s) FROM (SELECT %s FROM %s WHERE %s ORDER BY %s DESC LIMIT ?) s)",
+		dialect.Quote(new(engine.Transaction).TableName()),
+		dialect.Quote("i_d"),
+		dialect.Quote("tx"),
+		dialect.Quote("tx"),
+		dialect.Quote(new(engine.Resource).TableName()),
+		dialect.where("agent", "status"),
+		dialect.Quote("i_d"),
+	)
+}
+
+// finished build the condition of transaction t which has no resource waiting for confirm or cancel
+// and no child transaction still alive, the permanently failed resources are never delivered again so
+// they are finished too, bind the finishedArgs
+func (dialect *sqlDialect) finished() string {
+	return fmt.Sprintf(
+		"NOT EXISTS (SELECT 1 FROM %s r WHERE r.%s = t.%s AND r.%s NOT IN (?, ?, ?)) AND "+
+			"NOT EXISTS (SELECT 1 FROM %s c WHERE c.%s = t.%s AND (c.%s NOT IN (?, ?, ?) OR "+
+			"EXISTS (SELECT 1 FROM %s cr WHERE cr.%s = c.%s AND cr.%s NOT IN (?, ?, ?))))",
+		dialect.Quote(new(engine.Resource).TableName()),
+		dialect.Quote("tx"),
+		dialect.Quote("i_d"),
+		dialect.Quote("status"),
+		dialect.Quote(new(engine.Transaction).TableName()),
+		dialect.Quote("p_i_d"),
+		dialect.Quote("i_d"),
+		dialect.Quote("status"),
+		dialect.Quote(new(engine.Resource).TableName()),
+		dialect.Quote("tx"),
+		dialect.Quote("i_d"),
+		dialect.Quote("status"),
+	)
+}
+
+// finishedArgs the bind parameters of the finished condition
+func finishedArgs() []interface{} {
+	return []interface{}{
+		tcc.TxStatus_Confirmed, tcc.TxStatus_Canceled, tcc.TxStatus_Failed,
+		tcc.TxStatus_Confirmed, tcc.TxStatus_Canceled, tcc.TxStatus_Timeout,
+		tcc.TxStatus_Confirmed, tcc.TxStatus_Canceled, tcc.TxStatus_Failed,
+	}
+}
+
+// queryFinishedTx build sql selecting transactions with the status updated before the time
+// which are finished
+func (dialect *sqlDialect) queryFinishedTx() string {
+	return fmt.Sprintf(
+		"SELECT * FROM %s t WHERE t.%s = ? AND t.%s < ? AND %s ORDER BY t.%s LIMIT ?",
+		dialect.Quote(new(engine.Transaction).TableName()),
+		dialect.Quote("status"),
+		dialect.Quote("updated_time"),
+		dialect.finished(),
+		dialect.Quote("updated_time"),
+	)
+}
+
+// lockFinishedTx build sql selecting and locking the transactions of n ids which are still finished
+// in terminal status, sqlite locks the whole database on write so the row lock is skipped
+func (dialect *sqlDialect) lockFinishedTx(n int) string {
+	sql := fmt.Sprintf(
+		"SELECT t.%s FROM %s t WHERE t.%s IN (%s) AND t.%s IN (?, ?, ?) AND %s",
+		dialect.Quote("i_d"),
+		dialect.Quote(new(engine.Transaction).TableName()),
+		dialect.Quote("i_d"),
+		strings.TrimSuffix(strings.Repeat("?, ", n), ", "),
+		dialect.Quote("status"),
+		dialect.finished(),
+	)
+
+	if dialect.db != core.SQLITE {
+		sql += " FOR UPDATE"
+	}
+
+	return sql
+}
+
+type mysqlDialect struct {
+}
+
+// DuplicateKey check mysql ER_DUP_ENTRY error, the error number is read by reflection
+// so the storage package does not depend on the mysql driver directly
+func (dialect *mysqlDialect) DuplicateKey(err error) bool {
+	val := reflect.ValueOf(err)
+
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return false
+	}
+
+	number := val.FieldByName("Number")
+
+	if !number.IsValid() || number.Kind() != reflect.Uint16 {
+		return false
+	}
+
+	return number.Uint() == 1062
+}
+
+func init() {
+	xxorm.RegisterDialect(core.MYSQL, &mysqlDialect{})
+}
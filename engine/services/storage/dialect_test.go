@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (err *mysqlError) Error() string {
+	return err.Message
+}
+
+func TestDialectSQL(t *testing.T) {
+	golden := []struct {
+		db            core.DbType
+		where         string
+		queryNotify   string
+		queryFinished string
+		lockFinished  string
+	}{
+		{
+			db:            core.SQLITE,
+			where:         "`tx` = ? AND `require` = ? AND `agent` = ? AND `resource` = ?",
+			queryNotify:   "SELECT * FROM `tcc_engine_transaction` WHERE `i_d` IN (SELECT DISTINCT(`tx`) FROM (SELECT `tx` FROM `tcc_engine_resource` WHERE `agent` = ? AND `status` = ? ORDER BY `i_d` DESC LIMIT ?) s)",
+			queryFinished: "SELECT * FROM `tcc_engine_transaction` t WHERE t.`status` = ? AND t.`updated_time` < ? AND NOT EXISTS (SELECT 1 FROM `tcc_engine_resource` r WHERE r.`tx` = t.`i_d` AND r.`status` NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_transaction` c WHERE c.`p_i_d` = t.`i_d` AND (c.`status` NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM `tcc_engine_resource` cr WHERE cr.`tx` = c.`i_d` AND cr.`status` NOT IN (?, ?, ?)))) ORDER BY t.`updated_time` LIMIT ?",
+			lockFinished:  "SELECT t.`i_d` FROM `tcc_engine_transaction` t WHERE t.`i_d` IN (?, ?) AND t.`status` IN (?, ?, ?) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_resource` r WHERE r.`tx` = t.`i_d` AND r.`status` NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_transaction` c WHERE c.`p_i_d` = t.`i_d` AND (c.`status` NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM `tcc_engine_resource` cr WHERE cr.`tx` = c.`i_d` AND cr.`status` NOT IN (?, ?, ?))))",
+		},
+		{
+			db:            core.POSTGRES,
+			where:         `"tx" = ? AND "require" = ? AND "agent" = ? AND "resource" = ?`,
+			queryNotify:   `SELECT * FROM "tcc_engine_transaction" WHERE "i_d" IN (SELECT DISTINCT("tx") FROM (SELECT "tx" FROM "tcc_engine_resource" WHERE "agent" = ? AND "status" = ? ORDER BY "i_d" DESC LIMIT ?) s)`,
+			queryFinished: `SELECT * FROM "tcc_engine_transaction" t WHERE t."status" = ? AND t."updated_time" < ? AND NOT EXISTS (SELECT 1 FROM "tcc_engine_resource" r WHERE r."tx" = t."i_d" AND r."status" NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM "tcc_engine_transaction" c WHERE c."p_i_d" = t."i_d" AND (c."status" NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM "tcc_engine_resource" cr WHERE cr."tx" = c."i_d" AND cr."status" NOT IN (?, ?, ?)))) ORDER BY t."updated_time" LIMIT ?`,
+			lockFinished:  `SELECT t."i_d" FROM "tcc_engine_transaction" t WHERE t."i_d" IN (?, ?) AND t."status" IN (?, ?, ?) AND NOT EXISTS (SELECT 1 FROM "tcc_engine_resource" r WHERE r."tx" = t."i_d" AND r."status" NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM "tcc_engine_transaction" c WHERE c."p_i_d" = t."i_d" AND (c."status" NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM "tcc_engine_resource" cr WHERE cr."tx" = c."i_d" AND cr."status" NOT IN (?, ?, ?)))) FOR UPDATE`,
+		},
+		{
+			db:            core.MYSQL,
+			where:         "`tx` = ? AND `require` = ? AND `agent` = ? AND `resource` = ?",
+			queryNotify:   "SELECT * FROM `tcc_engine_transaction` WHERE `i_d` IN (SELECT DISTINCT(`tx`) FROM (SELECT `tx` FROM `tcc_engine_resource` WHERE `agent` = ? AND `status` = ? ORDER BY `i_d` DESC LIMIT ?) s)",
+			queryFinished: "SELECT * FROM `tcc_engine_transaction` t WHERE t.`status` = ? AND t.`updated_time` < ? AND NOT EXISTS (SELECT 1 FROM `tcc_engine_resource` r WHERE r.`tx` = t.`i_d` AND r.`status` NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_transaction` c WHERE c.`p_i_d` = t.`i_d` AND (c.`status` NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM `tcc_engine_resource` cr WHERE cr.`tx` = c.`i_d` AND cr.`status` NOT IN (?, ?, ?)))) ORDER BY t.`updated_time` LIMIT ?",
+			lockFinished:  "SELECT t.`i_d` FROM `tcc_engine_transaction` t WHERE t.`i_d` IN (?, ?) AND t.`status` IN (?, ?, ?) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_resource` r WHERE r.`tx` = t.`i_d` AND r.`status` NOT IN (?, ?, ?)) AND NOT EXISTS (SELECT 1 FROM `tcc_engine_transaction` c WHERE c.`p_i_d` = t.`i_d` AND (c.`status` NOT IN (?, ?, ?) OR EXISTS (SELECT 1 FROM `tcc_engine_resource` cr WHERE cr.`tx` = c.`i_d` AND cr.`status` NOT IN (?, ?, ?)))) FOR UPDATE",
+		},
+	}
+
+	for _, g := range golden {
+		dialect := newSQLDialect(g.db)
+
+		if where := dialect.where("tx", "require", "agent", "resource"); where != g.where {
+			t.Fatalf("%s where sql\n\texpect: %s\n\tgot: %s", g.db, g.where, where)
+		}
+
+		if sql := dialect.queryNotifyTx(); sql != g.queryNotify {
+			t.Fatalf("%s query notify sql\n\texpect: %s\n\tgot: %s", g.db, g.queryNotify, sql)
+		}
+
+		if sql := dialect.queryFinishedTx(); sql != g.queryFinished {
+			t.Fatalf("%s query finished sql\n\texpect: %s\n\tgot: %s", g.db, g.queryFinished, sql)
+		}
+
+		if sql := dialect.lockFinishedTx(2); sql != g.lockFinished {
+			t.Fatalf("%s lock finished sql\n\texpect: %s\n\tgot: %s", g.db, g.lockFinished, sql)
+		}
+	}
+}
+
+func TestMysqlDuplicateKey(t *testing.T) {
+	dialect := &mysqlDialect{}
+
+	if !dialect.DuplicateKey(&mysqlError{Number: 1062, Message: "Duplicate entry"}) {
+		t.Fatalf("expect 1062 as duplicate key error")
+	}
+
+	if dialect.DuplicateKey(&mysqlError{Number: 1064, Message: "syntax error"}) {
+		t.Fatalf("expect 1064 not duplicate key error")
+	}
+
+	if dialect.DuplicateKey(core.ErrNoMapPointer) {
+		t.Fatalf("expect plain error not duplicate key error")
+	}
+}
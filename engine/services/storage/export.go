@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+func (storage *storageImpl) QueryTx(filter *engine.TxFilter) ([]*engine.Transaction, error) {
+	session := storage.engine.NewSession()
+	defer session.Close()
+
+	if len(filter.IDs) > 0 {
+		session.In("i_d", filter.IDs)
+	}
+
+	if len(filter.PIDs) > 0 {
+		session.In("p_i_d", filter.PIDs)
+	}
+
+	if len(filter.Status) > 0 {
+		session.In("status", filter.Status)
+	}
+
+	if !filter.After.IsZero() {
+		session.And(fmt.Sprintf("%s >= ?", storage.dialect.Quote("created_time")), storage.formatTime(filter.After))
+	}
+
+	if !filter.Before.IsZero() {
+		session.And(fmt.Sprintf("%s < ?", storage.dialect.Quote("created_time")), storage.formatTime(filter.Before))
+	}
+
+	if filter.AfterID != "" {
+		session.And(fmt.Sprintf("%s > ?", storage.dialect.Quote("i_d")), filter.AfterID)
+	}
+
+	if filter.Limit > 0 {
+		session.Limit(filter.Limit)
+	}
+
+	trans := make([]*engine.Transaction, 0)
+
+	if err := session.Asc("i_d").Find(&trans); err != nil {
+		return nil, xerrors.Wrapf(err, "query tx error")
+	}
+
+	return trans, nil
+}
+
+func (storage *storageImpl) ImportTx(record *engine.TxRecord) error {
+	return storage.transact(func(session *xorm.Session) error {
+		if _, err := session.NoAutoTime().InsertOne(record.Tx); err != nil {
+			if storage.duplicateKey(err) {
+				return xerrors.Wrapf(gomesh.ErrExists, "tx %s exists", record.Tx.ID)
+			}
+
+			return xerrors.Wrapf(err, "import tx %s error", record.Tx.ID)
+		}
+
+		// the statement options are reset after each insert, keep the row times with NoAutoTime row by row
+		for _, resource := range record.Resources {
+			if _, err := session.NoAutoTime().InsertOne(resource); err != nil {
+				if storage.duplicateKey(err) {
+					return xerrors.Wrapf(gomesh.ErrExists, "resource %s exists", resource.ID)
+				}
+
+				return xerrors.Wrapf(err, "import resource %s of tx %s error", resource.ID, record.Tx.ID)
+			}
+		}
+
+		for _, history := range record.Histories {
+			if _, err := session.NoAutoTime().InsertOne(history); err != nil {
+				if storage.duplicateKey(err) {
+					return xerrors.Wrapf(gomesh.ErrExists, "history %s exists", history.ID)
+				}
+
+				return xerrors.Wrapf(err, "import history %s of tx %s error", history.ID, record.Tx.ID)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// txHistory fill the transaction transition into history, return nil if history is nil
+func txHistory(history *engine.History, tx *engine.Transaction, from, to tcc.TxStatus) *engine.History {
+	if history == nil {
+		return nil
+	}
+
+	history.Tx = tx.ID
+	history.Resource = ""
+	history.FromStatus = from
+	history.ToStatus = to
+
+	return history
+}
+
+// resourceHistory fill the resource transition into history, return nil if history is nil
+func resourceHistory(history *engine.History, resource *engine.Resource, from, to tcc.TxStatus) *engine.History {
+	if history == nil {
+		return nil
+	}
+
+	history.Tx = resource.Tx
+	history.Resource = resource.ID
+	history.FromStatus = from
+	history.ToStatus = to
+
+	return history
+}
+
+func (storage *storageImpl) appendHistory(session *xorm.Session, history *engine.History) error {
+	if history == nil {
+		return nil
+	}
+
+	if _, err := session.InsertOne(history); err != nil {
+		return xerrors.Wrapf(err, "insert history %s of tx %s error", history.ID, history.Tx)
+	}
+
+	return nil
+}
+
+func (storage *storageImpl) AppendHistory(history *engine.History) error {
+	return storage.transact(func(session *xorm.Session) error {
+		return storage.appendHistory(session, history)
+	})
+}
+
+func (storage *storageImpl) GetTxHistory(id string) ([]*engine.History, error) {
+	histories := make([]*engine.History, 0)
+
+	if err := storage.engine.Where(storage.dialect.where("tx"), id).Asc("i_d").Find(&histories); err != nil {
+		return nil, xerrors.Wrapf(err, "get histories by tx %s error", id)
+	}
+
+	if len(histories) != 0 {
+		return histories, nil
+	}
+
+	archived := make([]*engine.ArchivedHistory, 0)
+
+	if err := storage.engine.Where(storage.dialect.where("tx"), id).Asc("i_d").Find(&archived); err != nil {
+		return nil, xerrors.Wrapf(err, "get archived histories by tx %s error", id)
+	}
+
+	for _, history := range archived {
+		copied := history.History
+		histories = append(histories, &copied)
+	}
+
+	return histories, nil
+}
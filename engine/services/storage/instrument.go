@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
+)
+
+// instrumented record the latency and errors of the storage operations
+type instrumented struct {
+	storage engine.Storage
+}
+
+// Instrument wrap storage recording the operation latencies and errors in the engine metrics
+func Instrument(storage engine.Storage) engine.Storage {
+	return &instrumented{storage: storage}
+}
+
+// observe record the operation started at start, the version conflicts are retried by the callers and not
+// counted as errors
+func observe(operation string, start time.Time, err error) {
+	metrics.StorageSeconds.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	if err != nil && !xerrors.Is(err, engine.ErrConflict) {
+		metrics.StorageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// Start start the wrapped storage if it runs
+func (storage *instrumented) Start() error {
+	if runnable, ok := storage.storage.(interface{ Start() error }); ok {
+		return runnable.Start()
+	}
+
+	return nil
+}
+
+// Close close the wrapped storage if it closes
+func (storage *instrumented) Close() error {
+	if closer, ok := storage.storage.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (storage *instrumented) NewTx(tx *engine.Transaction, history *engine.History) (err error) {
+	defer func(start time.Time) { observe("NewTx", start, err) }(time.Now())
+	return storage.storage.NewTx(tx, history)
+}
+
+func (storage *instrumented) GetTx(id string) (tx *engine.Transaction, err error) {
+	defer func(start time.Time) { observe("GetTx", start, err) }(time.Now())
+	return storage.storage.GetTx(id)
+}
+
+func (storage *instrumented) UpdateTxStatus(tx *engine.Transaction, status tcc.TxStatus, history *engine.History) (err error) {
+	defer func(start time.Time) { observe("UpdateTxStatus", start, err) }(time.Now())
+	return storage.storage.UpdateTxStatus(tx, status, history)
+}
+
+func (storage *instrumented) NewResource(resource *engine.Resource, history *engine.History) (err error) {
+	defer func(start time.Time) { observe("NewResource", start, err) }(time.Now())
+	return storage.storage.NewResource(resource, history)
+}
+
+func (storage *instrumented) GetResource(txid, rid, agent, resource string) (result *engine.Resource, err error) {
+	defer func(start time.Time) { observe("GetResource", start, err) }(time.Now())
+	return storage.storage.GetResource(txid, rid, agent, resource)
+}
+
+func (storage *instrumented) UpdateResourceStatus(resource *engine.Resource, status tcc.TxStatus, history *engine.History) (err error) {
+	defer func(start time.Time) { observe("UpdateResourceStatus", start, err) }(time.Now())
+	return storage.storage.UpdateResourceStatus(resource, status, history)
+}
+
+func (storage *instrumented) WriteResources(writes []*engine.ResourceWrite) []error {
+	start := time.Now()
+
+	errs := storage.storage.WriteResources(writes)
+
+	var err error
+
+	for _, e := range errs {
+		if e != nil {
+			err = e
+			break
+		}
+	}
+
+	observe("WriteResources", start, err)
+
+	return errs
+}
+
+func (storage *instrumented) AppendHistory(history *engine.History) (err error) {
+	defer func(start time.Time) { observe("AppendHistory", start, err) }(time.Now())
+	return storage.storage.AppendHistory(history)
+}
+
+func (storage *instrumented) GetTxHistory(id string) (histories []*engine.History, err error) {
+	defer func(start time.Time) { observe("GetTxHistory", start, err) }(time.Now())
+	return storage.storage.GetTxHistory(id)
+}
+
+func (storage *instrumented) QueryTx(filter *engine.TxFilter) (txs []*engine.Transaction, err error) {
+	defer func(start time.Time) { observe("QueryTx", start, err) }(time.Now())
+	return storage.storage.QueryTx(filter)
+}
+
+func (storage *instrumented) ImportTx(record *engine.TxRecord) (err error) {
+	defer func(start time.Time) { observe("ImportTx", start, err) }(time.Now())
+	return storage.storage.ImportTx(record)
+}
+
+func (storage *instrumented) GetResourceByTx(id string) (resources []*engine.Resource, err error) {
+	defer func(start time.Time) { observe("GetResourceByTx", start, err) }(time.Now())
+	return storage.storage.GetResourceByTx(id)
+}
+
+func (storage *instrumented) QueryNotifyTx(agent string) (txs []*engine.Transaction, err error) {
+	defer func(start time.Time) { observe("QueryNotifyTx", start, err) }(time.Now())
+	return storage.storage.QueryNotifyTx(agent)
+}
+
+func (storage *instrumented) QueryFinishedTx(status tcc.TxStatus, before time.Time, limit int) (txs []*engine.Transaction, err error) {
+	defer func(start time.Time) { observe("QueryFinishedTx", start, err) }(time.Now())
+	return storage.storage.QueryFinishedTx(status, before, limit)
+}
+
+func (storage *instrumented) ArchiveTx(ids []string) (count int, err error) {
+	defer func(start time.Time) { observe("ArchiveTx", start, err) }(time.Now())
+	return storage.storage.ArchiveTx(ids)
+}
+
+func (storage *instrumented) DeleteTx(ids []string) (count int, err error) {
+	defer func(start time.Time) { observe("DeleteTx", start, err) }(time.Now())
+	return storage.storage.DeleteTx(ids)
+}
+
+func (storage *instrumented) GetArchivedTx(id string) (tx *engine.ArchivedTransaction, resources []*engine.ArchivedResource, err error) {
+	defer func(start time.Time) { observe("GetArchivedTx", start, err) }(time.Now())
+	return storage.storage.GetArchivedTx(id)
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentErrors(t *testing.T) {
+	storage := Instrument(NewMemory())
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicates := testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("NewTx"))
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, nil); err == nil {
+		t.Fatal("expect duplicate tx error")
+	}
+
+	if testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("NewTx")) != duplicates+1 {
+		t.Fatal("expect the duplicate counted as error")
+	}
+
+	tx, err := storage.GetTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *tx
+
+	if err := storage.UpdateTxStatus(tx, tcc.TxStatus_Confirmed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts := testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("UpdateTxStatus"))
+
+	if err := storage.UpdateTxStatus(&stale, tcc.TxStatus_Canceled, nil); !xerrors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expect ErrConflict, got %v", err)
+	}
+
+	if testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("UpdateTxStatus")) != conflicts {
+		t.Fatal("expect the version conflict not counted as error")
+	}
+}
@@ -0,0 +1,710 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dynamicgo/slf4go"
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// DriverMemory config driver name select the in-memory storage
+const DriverMemory = "memory"
+
+type resourceKey struct {
+	Tx       string
+	Require  string
+	Agent    string
+	Resource string
+}
+
+type memorySnapshot struct {
+	Transactions         []*engine.Transaction         `json:"transactions"`
+	Resources            []*engine.Resource            `json:"resources"`
+	ArchivedTransactions []*engine.ArchivedTransaction `json:"archived_transactions"`
+	ArchivedResources    []*engine.ArchivedResource    `json:"archived_resources"`
+	Histories            []*engine.History             `json:"histories"`
+	ArchivedHistories    []*engine.ArchivedHistory     `json:"archived_histories"`
+}
+
+type memoryStorage struct {
+	sync.RWMutex                                         // mixin rw locker
+	slf4go.Logger                                        // mixin logger
+	txs           map[string]*engine.Transaction         // transactions indexed by id
+	resources     map[string]*engine.Resource            // resources indexed by id
+	unique        map[resourceKey]string                 // unique(tx_req_agent_res) index
+	byTx          map[string][]*engine.Resource          // resources indexed by tx
+	archivedTxs   map[string]*engine.ArchivedTransaction // archived transactions indexed by id
+	archivedByTx  map[string][]*engine.ArchivedResource  // archived resources indexed by tx
+	histories     map[string][]*engine.History           // histories indexed by tx in append order
+	archivedHist  map[string][]*engine.ArchivedHistory   // archived histories indexed by tx
+	snapshot      string                                 // snapshot file path, empty means disable
+	now           func() time.Time                       // clock
+}
+
+// NewMemory create new in-memory storage without snapshot
+func NewMemory() engine.Storage {
+	return newMemoryStorage("")
+}
+
+func newMemoryStorage(snapshot string) *memoryStorage {
+	return &memoryStorage{
+		Logger:       slf4go.Get("tcc.storage.memory"),
+		txs:          make(map[string]*engine.Transaction),
+		resources:    make(map[string]*engine.Resource),
+		unique:       make(map[resourceKey]string),
+		byTx:         make(map[string][]*engine.Resource),
+		archivedTxs:  make(map[string]*engine.ArchivedTransaction),
+		archivedByTx: make(map[string][]*engine.ArchivedResource),
+		histories:    make(map[string][]*engine.History),
+		archivedHist: make(map[string][]*engine.ArchivedHistory),
+		snapshot:     snapshot,
+		now:          time.Now,
+	}
+}
+
+// Close write snapshot file if enabled, called by the owner of the storage on shutdown
+func (storage *memoryStorage) Close() error {
+	if storage.snapshot == "" {
+		return nil
+	}
+
+	storage.RLock()
+	defer storage.RUnlock()
+
+	snapshot := &memorySnapshot{
+		Transactions: make([]*engine.Transaction, 0, len(storage.txs)),
+		Resources:    make([]*engine.Resource, 0, len(storage.resources)),
+	}
+
+	for _, tx := range storage.txs {
+		snapshot.Transactions = append(snapshot.Transactions, tx)
+	}
+
+	for _, resource := range storage.resources {
+		snapshot.Resources = append(snapshot.Resources, resource)
+	}
+
+	for _, tx := range storage.archivedTxs {
+		snapshot.ArchivedTransactions = append(snapshot.ArchivedTransactions, tx)
+	}
+
+	for _, resources := range storage.archivedByTx {
+		snapshot.ArchivedResources = append(snapshot.ArchivedResources, resources...)
+	}
+
+	for _, histories := range storage.histories {
+		snapshot.Histories = append(snapshot.Histories, histories...)
+	}
+
+	for _, histories := range storage.archivedHist {
+		snapshot.ArchivedHistories = append(snapshot.ArchivedHistories, histories...)
+	}
+
+	sort.Slice(snapshot.Histories, func(i, j int) bool {
+		return snapshot.Histories[i].ID < snapshot.Histories[j].ID
+	})
+
+	sort.Slice(snapshot.ArchivedHistories, func(i, j int) bool {
+		return snapshot.ArchivedHistories[i].ID < snapshot.ArchivedHistories[j].ID
+	})
+
+	sort.Slice(snapshot.ArchivedTransactions, func(i, j int) bool {
+		return snapshot.ArchivedTransactions[i].ID < snapshot.ArchivedTransactions[j].ID
+	})
+
+	sort.Slice(snapshot.ArchivedResources, func(i, j int) bool {
+		return snapshot.ArchivedResources[i].ID < snapshot.ArchivedResources[j].ID
+	})
+
+	sort.Slice(snapshot.Transactions, func(i, j int) bool {
+		return snapshot.Transactions[i].ID < snapshot.Transactions[j].ID
+	})
+
+	sort.Slice(snapshot.Resources, func(i, j int) bool {
+		return snapshot.Resources[i].ID < snapshot.Resources[j].ID
+	})
+
+	buff, err := json.Marshal(snapshot)
+
+	if err != nil {
+		return xerrors.Wrapf(err, "marshal memory storage snapshot error")
+	}
+
+	tmp := storage.snapshot + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, buff, 0644); err != nil {
+		return xerrors.Wrapf(err, "write memory storage snapshot %s error", tmp)
+	}
+
+	if err := os.Rename(tmp, storage.snapshot); err != nil {
+		return xerrors.Wrapf(err, "rename memory storage snapshot %s error", tmp)
+	}
+
+	storage.InfoF("write memory storage snapshot %s(%d,%d) -- success",
+		storage.snapshot, len(snapshot.Transactions), len(snapshot.Resources))
+
+	return nil
+}
+
+func (storage *memoryStorage) load() error {
+	buff, err := ioutil.ReadFile(storage.snapshot)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return xerrors.Wrapf(err, "read memory storage snapshot %s error", storage.snapshot)
+	}
+
+	var snapshot memorySnapshot
+
+	if err := json.Unmarshal(buff, &snapshot); err != nil {
+		return xerrors.Wrapf(err, "unmarshal memory storage snapshot %s error", storage.snapshot)
+	}
+
+	storage.Lock()
+	defer storage.Unlock()
+
+	for _, tx := range snapshot.Transactions {
+		storage.txs[tx.ID] = tx
+	}
+
+	for _, resource := range snapshot.Resources {
+		storage.insertResource(resource)
+	}
+
+	for _, tx := range snapshot.ArchivedTransactions {
+		storage.archivedTxs[tx.ID] = tx
+	}
+
+	for _, resource := range snapshot.ArchivedResources {
+		storage.archivedByTx[resource.Tx] = append(storage.archivedByTx[resource.Tx], resource)
+	}
+
+	for _, history := range snapshot.Histories {
+		storage.histories[history.Tx] = append(storage.histories[history.Tx], history)
+	}
+
+	for _, history := range snapshot.ArchivedHistories {
+		storage.archivedHist[history.Tx] = append(storage.archivedHist[history.Tx], history)
+	}
+
+	storage.InfoF("load memory storage snapshot %s(%d,%d) -- success",
+		storage.snapshot, len(snapshot.Transactions), len(snapshot.Resources))
+
+	return nil
+}
+
+func (storage *memoryStorage) insertResource(resource *engine.Resource) {
+	storage.resources[resource.ID] = resource
+	storage.unique[keyOfResource(resource)] = resource.ID
+	storage.byTx[resource.Tx] = append(storage.byTx[resource.Tx], resource)
+}
+
+func keyOfResource(resource *engine.Resource) resourceKey {
+	return resourceKey{
+		Tx:       resource.Tx,
+		Require:  resource.Require,
+		Agent:    resource.Agent,
+		Resource: resource.Resource,
+	}
+}
+
+func (storage *memoryStorage) NewTx(tx *engine.Transaction, history *engine.History) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.txs[tx.ID]; ok {
+		return xerrors.Wrapf(gomesh.ErrExists, "tx %s exists", tx.ID)
+	}
+
+	now := storage.now()
+
+	tx.Version = 1
+	tx.CreatedTime = now
+	tx.UpdatedTime = now
+
+	copied := *tx
+
+	storage.txs[tx.ID] = &copied
+
+	storage.appendHistory(txHistory(history, tx, tx.Status, tx.Status))
+
+	return nil
+}
+
+// appendHistory append history with the storage locked
+func (storage *memoryStorage) appendHistory(history *engine.History) {
+	if history == nil {
+		return
+	}
+
+	history.CreatedTime = storage.now()
+
+	copied := *history
+
+	storage.histories[history.Tx] = append(storage.histories[history.Tx], &copied)
+}
+
+func (storage *memoryStorage) AppendHistory(history *engine.History) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.appendHistory(history)
+
+	return nil
+}
+
+func (storage *memoryStorage) GetTxHistory(id string) ([]*engine.History, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	histories := make([]*engine.History, 0, len(storage.histories[id]))
+
+	for _, history := range storage.histories[id] {
+		copied := *history
+		histories = append(histories, &copied)
+	}
+
+	for _, history := range storage.archivedHist[id] {
+		copied := history.History
+		histories = append(histories, &copied)
+	}
+
+	return histories, nil
+}
+
+func (storage *memoryStorage) GetTx(id string) (*engine.Transaction, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	tx, ok := storage.txs[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *tx
+
+	return &copied, nil
+}
+
+func (storage *memoryStorage) UpdateTxStatus(tx *engine.Transaction, status tcc.TxStatus, history *engine.History) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	target, ok := storage.txs[tx.ID]
+
+	if !ok || target.Version != tx.Version {
+		return xerrors.Wrapf(engine.ErrConflict, "update tx %s status to %s with version %d conflict", tx.ID, status, tx.Version)
+	}
+
+	storage.appendHistory(txHistory(history, tx, target.Status, status))
+
+	target.Status = status
+	target.Version++
+	target.UpdatedTime = storage.now()
+
+	tx.Status = status
+	tx.Version = target.Version
+
+	return nil
+}
+
+func (storage *memoryStorage) NewResource(resource *engine.Resource, history *engine.History) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	_, idExists := storage.resources[resource.ID]
+	_, keyExists := storage.unique[keyOfResource(resource)]
+
+	if idExists || keyExists {
+		return xerrors.Wrapf(gomesh.ErrExists,
+			"resource(%s,%s,%s,%s) exists", resource.Tx, resource.Require, resource.Agent, resource.Resource)
+	}
+
+	now := storage.now()
+
+	resource.Version = 1
+	resource.CreatedTime = now
+	resource.UpdatedTime = now
+
+	copied := *resource
+
+	storage.insertResource(&copied)
+
+	storage.appendHistory(resourceHistory(history, resource, resource.Status, resource.Status))
+
+	return nil
+}
+
+func (storage *memoryStorage) GetResource(txid, require, agent, resource string) (*engine.Resource, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	id, ok := storage.unique[resourceKey{Tx: txid, Require: require, Agent: agent, Resource: resource}]
+
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *storage.resources[id]
+
+	return &copied, nil
+}
+
+func (storage *memoryStorage) UpdateResourceStatus(resource *engine.Resource, status tcc.TxStatus, history *engine.History) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	target, ok := storage.resources[resource.ID]
+
+	if !ok || target.Version != resource.Version {
+		return xerrors.Wrapf(engine.ErrConflict,
+			"update resource %s status to %s with version %d conflict", resource.ID, status, resource.Version)
+	}
+
+	storage.appendHistory(resourceHistory(history, resource, target.Status, status))
+
+	target.Status = status
+	target.Version++
+	target.UpdatedTime = storage.now()
+
+	resource.Status = status
+	resource.Version = target.Version
+
+	return nil
+}
+
+func (storage *memoryStorage) WriteResources(writes []*engine.ResourceWrite) []error {
+	errs := make([]error, len(writes))
+
+	for i, write := range writes {
+		if write.Update {
+			errs[i] = storage.UpdateResourceStatus(write.Resource, write.Status, write.History)
+		} else {
+			errs[i] = storage.NewResource(write.Resource, write.History)
+		}
+	}
+
+	return errs
+}
+
+func (storage *memoryStorage) GetResourceByTx(id string) ([]*engine.Resource, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	resources := make([]*engine.Resource, 0, len(storage.byTx[id]))
+
+	for _, resource := range storage.byTx[id] {
+		copied := *resource
+		resources = append(resources, &copied)
+	}
+
+	return resources, nil
+}
+
+func (storage *memoryStorage) QueryNotifyTx(agent string) ([]*engine.Transaction, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	locked := make([]*engine.Resource, 0)
+
+	for _, resource := range storage.resources {
+		if resource.Agent == agent && resource.Status == tcc.TxStatus_Locked {
+			locked = append(locked, resource)
+		}
+	}
+
+	// keep the same window as sqlDialect.queryNotifyTx: latest locked resources order by id desc
+	sort.Slice(locked, func(i, j int) bool {
+		return locked[i].ID > locked[j].ID
+	})
+
+	if len(locked) > queryNotifyLimit {
+		locked = locked[:queryNotifyLimit]
+	}
+
+	trans := make([]*engine.Transaction, 0)
+	filters := make(map[string]bool)
+
+	for _, resource := range locked {
+		if filters[resource.Tx] {
+			continue
+		}
+
+		filters[resource.Tx] = true
+
+		tx, ok := storage.txs[resource.Tx]
+
+		if !ok {
+			continue
+		}
+
+		copied := *tx
+		trans = append(trans, &copied)
+	}
+
+	return trans, nil
+}
+
+func (storage *memoryStorage) QueryFinishedTx(status tcc.TxStatus, before time.Time, limit int) ([]*engine.Transaction, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	trans := make([]*engine.Transaction, 0)
+
+	for _, tx := range storage.txs {
+		if tx.Status != status || !tx.UpdatedTime.Before(before) {
+			continue
+		}
+
+		if storage.finished(tx.ID) {
+			copied := *tx
+			trans = append(trans, &copied)
+		}
+	}
+
+	sort.Slice(trans, func(i, j int) bool {
+		return trans[i].UpdatedTime.Before(trans[j].UpdatedTime)
+	})
+
+	if len(trans) > limit {
+		trans = trans[:limit]
+	}
+
+	return trans, nil
+}
+
+// finished check the tx has no resource waiting for confirm or cancel and no child tx still alive
+func (storage *memoryStorage) finished(id string) bool {
+	if !resourcesFinished(storage.byTx[id]) {
+		return false
+	}
+
+	for _, child := range storage.txs {
+		if child.PID != id {
+			continue
+		}
+
+		if !terminal(child.Status) || !resourcesFinished(storage.byTx[child.ID]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resourcesFinished check the resources are confirmed, canceled or failed permanently
+func resourcesFinished(resources []*engine.Resource) bool {
+	for _, resource := range resources {
+		if resource.Status != tcc.TxStatus_Confirmed && resource.Status != tcc.TxStatus_Canceled &&
+			resource.Status != tcc.TxStatus_Failed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func terminal(status tcc.TxStatus) bool {
+	return status == tcc.TxStatus_Confirmed || status == tcc.TxStatus_Canceled || status == tcc.TxStatus_Timeout
+}
+
+func (storage *memoryStorage) QueryTx(filter *engine.TxFilter) ([]*engine.Transaction, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	trans := make([]*engine.Transaction, 0)
+
+	for _, tx := range storage.txs {
+		if matchTx(filter, tx) {
+			copied := *tx
+			trans = append(trans, &copied)
+		}
+	}
+
+	sort.Slice(trans, func(i, j int) bool {
+		return trans[i].ID < trans[j].ID
+	})
+
+	if filter.Limit > 0 && len(trans) > filter.Limit {
+		trans = trans[:filter.Limit]
+	}
+
+	return trans, nil
+}
+
+func matchTx(filter *engine.TxFilter, tx *engine.Transaction) bool {
+	if len(filter.IDs) > 0 && !containsString(filter.IDs, tx.ID) {
+		return false
+	}
+
+	if len(filter.PIDs) > 0 && !containsString(filter.PIDs, tx.PID) {
+		return false
+	}
+
+	if len(filter.Status) > 0 {
+		found := false
+
+		for _, status := range filter.Status {
+			found = found || status == tx.Status
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !filter.After.IsZero() && tx.CreatedTime.Before(filter.After) {
+		return false
+	}
+
+	if !filter.Before.IsZero() && !tx.CreatedTime.Before(filter.Before) {
+		return false
+	}
+
+	return filter.AfterID == "" || tx.ID > filter.AfterID
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (storage *memoryStorage) ImportTx(record *engine.TxRecord) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.txs[record.Tx.ID]; ok {
+		return xerrors.Wrapf(gomesh.ErrExists, "tx %s exists", record.Tx.ID)
+	}
+
+	for _, resource := range record.Resources {
+		_, idExists := storage.resources[resource.ID]
+		_, keyExists := storage.unique[keyOfResource(resource)]
+
+		if idExists || keyExists {
+			return xerrors.Wrapf(gomesh.ErrExists, "resource %s exists", resource.ID)
+		}
+	}
+
+	copiedTx := *record.Tx
+
+	storage.txs[copiedTx.ID] = &copiedTx
+
+	for _, resource := range record.Resources {
+		copied := *resource
+		storage.insertResource(&copied)
+	}
+
+	for _, history := range record.Histories {
+		copied := *history
+		storage.histories[history.Tx] = append(storage.histories[history.Tx], &copied)
+	}
+
+	return nil
+}
+
+func (storage *memoryStorage) ArchiveTx(ids []string) (int, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	now := storage.now()
+
+	count := 0
+
+	for _, id := range ids {
+		tx, ok := storage.txs[id]
+
+		if !ok || !terminal(tx.Status) || !storage.finished(id) {
+			continue
+		}
+
+		storage.archivedTxs[id] = &engine.ArchivedTransaction{Transaction: *tx, ArchivedTime: now}
+
+		for _, resource := range storage.byTx[id] {
+			storage.archivedByTx[id] = append(storage.archivedByTx[id],
+				&engine.ArchivedResource{Resource: *resource, ArchivedTime: now})
+		}
+
+		for _, history := range storage.histories[id] {
+			storage.archivedHist[id] = append(storage.archivedHist[id],
+				&engine.ArchivedHistory{History: *history, ArchivedTime: now})
+		}
+
+		storage.deleteTx(id)
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (storage *memoryStorage) DeleteTx(ids []string) (int, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	count := 0
+
+	for _, id := range ids {
+		tx, ok := storage.txs[id]
+
+		if !ok || !terminal(tx.Status) || !storage.finished(id) {
+			continue
+		}
+
+		storage.deleteTx(id)
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (storage *memoryStorage) deleteTx(id string) {
+	for _, resource := range storage.byTx[id] {
+		delete(storage.resources, resource.ID)
+		delete(storage.unique, keyOfResource(resource))
+	}
+
+	delete(storage.byTx, id)
+	delete(storage.txs, id)
+	delete(storage.histories, id)
+}
+
+func (storage *memoryStorage) GetArchivedTx(id string) (*engine.ArchivedTransaction, []*engine.ArchivedResource, error) {
+	storage.RLock()
+	defer storage.RUnlock()
+
+	tx, ok := storage.archivedTxs[id]
+
+	if !ok {
+		return nil, nil, nil
+	}
+
+	copiedTx := *tx
+
+	resources := make([]*engine.ArchivedResource, 0, len(storage.archivedByTx[id]))
+
+	for _, resource := range storage.archivedByTx[id] {
+		copied := *resource
+		resources = append(resources, &copied)
+	}
+
+	return &copiedTx, resources, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+func TestMemoryDuplicate(t *testing.T) {
+	storage := NewMemory()
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, nil); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect ErrExists, got %v", err)
+	}
+
+	resource := &engine.Resource{ID: "R_1", Tx: "1", Require: "r1", Agent: "a", Resource: "res"}
+
+	if err := storage.NewResource(resource, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	resource.ID = "R_2"
+
+	if err := storage.NewResource(resource, nil); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect ErrExists, got %v", err)
+	}
+}
+
+func TestMemoryQueryNotifyTx(t *testing.T) {
+	storage := NewMemory()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := storage.NewTx(&engine.Transaction{ID: id}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resources := []*engine.Resource{
+		{ID: "R_1", Tx: "1", Require: "r1", Agent: "a", Resource: "res", Status: tcc.TxStatus_Locked},
+		{ID: "R_2", Tx: "1", Require: "r2", Agent: "a", Resource: "res", Status: tcc.TxStatus_Locked},
+		{ID: "R_3", Tx: "2", Require: "r3", Agent: "a", Resource: "res", Status: tcc.TxStatus_Confirmed},
+		{ID: "R_4", Tx: "3", Require: "r4", Agent: "b", Resource: "res", Status: tcc.TxStatus_Locked},
+	}
+
+	for _, resource := range resources {
+		if err := storage.NewResource(resource, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txs, err := storage.QueryNotifyTx("a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 1 || txs[0].ID != "1" {
+		t.Fatalf("unexpect notify txs %v", txs)
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tcc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tcc.snapshot")
+
+	storage := newMemoryStorage(path)
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1", Status: tcc.TxStatus_Confirmed}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.NewResource(&engine.Resource{ID: "R_1", Tx: "1", Require: "r1", Agent: "a", Resource: "res"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newMemoryStorage(path)
+
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if tx := loaded.txs["1"]; tx == nil || tx.Status != tcc.TxStatus_Confirmed {
+		t.Fatalf("unexpect tx %v", tx)
+	}
+
+	resources, err := loaded.GetResourceByTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 1 || resources[0].ID != "R_1" {
+		t.Fatalf("unexpect resources %v", resources)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build mysql
+// +build mysql
+
+package storage
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+)
+
+func TestMysqlDriver(t *testing.T) {
+	registered := false
+
+	for _, driver := range sql.Drivers() {
+		if driver == "mysql" {
+			registered = true
+		}
+	}
+
+	if !registered {
+		t.Fatalf("expect mysql driver registered")
+	}
+
+	engine, err := xorm.NewEngine("mysql", "tcc:tcc@tcp(127.0.0.1:3306)/tcc?parseTime=true")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer engine.Close()
+
+	if engine.Dialect().DBType() != core.MYSQL {
+		t.Fatalf("expect mysql dialect, got %s", engine.Dialect().DBType())
+	}
+
+	dialect := &mysqlDialect{}
+
+	if !dialect.DuplicateKey(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}) {
+		t.Fatalf("expect driver 1062 error as duplicate key error")
+	}
+}
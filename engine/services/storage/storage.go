@@ -10,12 +10,15 @@ import (
 	"github.com/gomeshnetwork/gomesh"
 	"github.com/gomeshnetwork/tcc"
 	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 type storageImpl struct {
 	slf4go.Logger
-	engine *xorm.Engine    // xorm engine
-	Snode  *snowflake.Node `inject:"tcc.Snowflake"`
+	engine  *xorm.Engine    // xorm engine
+	dialect *sqlDialect     // raw sql builder
+	Snode   *snowflake.Node `inject:"tcc.Snowflake"`
 }
 
 // New .
@@ -26,103 +29,221 @@ func New(config config.Config) (engine.Storage, error) {
 	driver := config.Get("driver").String("sqlite3")
 	source := config.Get("source").String("./tcc.db")
 
+	if driver == DriverMemory {
+		storage := newMemoryStorage(config.Get("snapshot").String(""))
+
+		if err := storage.load(); err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}
+
 	engine, err := xorm.NewEngine(driver, source)
 
 	if err != nil {
 		return nil, xerrors.Wrapf(err, "create xorm engine err")
 	}
 
+	if err := migration.Check(engine); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
 	return &storageImpl{
-		Logger: logger,
-		engine: engine,
+		Logger:  logger,
+		engine:  engine,
+		dialect: newSQLDialect(engine.Dialect().DBType()),
 	}, nil
 }
 
-func (storage *storageImpl) NewTx(tx *engine.Transaction) error {
+func (storage *storageImpl) duplicateKey(err error) bool {
+	if xxorm.DuplicateKey(storage.engine, err) {
+		return true
+	}
 
-	_, err := storage.engine.InsertOne(tx)
+	// xxorm only check sqlite unique constraint, the primary key conflict has its own extended code
+	if v, ok := err.(sqlite3.Error); ok {
+		return v.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
 
-	if err != nil {
-		if xxorm.DuplicateKey(storage.engine, err) {
-			return xerrors.Wrapf(gomesh.ErrExists, "tx %s exists", tx.ID)
-		}
+	return false
+}
+
+// transact run f in one session transaction
+func (storage *storageImpl) transact(f func(session *xorm.Session) error) error {
+	session := storage.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return xerrors.Wrapf(err, "begin session error")
+	}
+
+	if err := f(session); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if err := session.Commit(); err != nil {
+		return xerrors.Wrapf(err, "commit session error")
 	}
 
 	return nil
 }
 
-func (storage *storageImpl) UpdateTxStatus(id string, status tcc.TxStatus) (bool, error) {
+func (storage *storageImpl) NewTx(tx *engine.Transaction, history *engine.History) error {
+
+	tx.Version = 1
 
-	c, err := storage.engine.Where(`"i_d" = ?`, id).Cols("status").Update(&engine.Transaction{Status: status})
+	return storage.transact(func(session *xorm.Session) error {
+		if _, err := session.InsertOne(tx); err != nil {
+			if storage.duplicateKey(err) {
+				return xerrors.Wrapf(gomesh.ErrExists, "tx %s exists", tx.ID)
+			}
+
+			return xerrors.Wrapf(err, "insert tx %s error", tx.ID)
+		}
+
+		return storage.appendHistory(session, txHistory(history, tx, tx.Status, tx.Status))
+	})
+}
+
+func (storage *storageImpl) GetTx(id string) (*engine.Transaction, error) {
+	tx := &engine.Transaction{}
+
+	ok, err := storage.engine.Where(storage.dialect.where("i_d"), id).Get(tx)
 
 	if err != nil {
-		return false, xerrors.Wrapf(err, "update tx %s status to %s error", id, status)
+		return nil, xerrors.Wrapf(err, "get tx %s error", id)
 	}
 
-	if c == 0 {
-		return false, nil
+	if !ok {
+		return nil, nil
 	}
 
-	return true, nil
+	return tx, nil
 }
 
-func (storage *storageImpl) NewResource(resource *engine.Resource) error {
-	_, err := storage.engine.InsertOne(resource)
+func (storage *storageImpl) UpdateTxStatus(tx *engine.Transaction, status tcc.TxStatus, history *engine.History) error {
+
+	err := storage.transact(func(session *xorm.Session) error {
+		c, err := session.
+			Where(storage.dialect.where("i_d", "version"), tx.ID, tx.Version).
+			Cols("status", "version").Update(&engine.Transaction{Status: status, Version: tx.Version + 1})
+
+		if err != nil {
+			return xerrors.Wrapf(err, "update tx %s status to %s error", tx.ID, status)
+		}
+
+		if c == 0 {
+			return xerrors.Wrapf(engine.ErrConflict, "update tx %s status to %s with version %d conflict", tx.ID, status, tx.Version)
+		}
+
+		return storage.appendHistory(session, txHistory(history, tx, tx.Status, status))
+	})
 
 	if err != nil {
-		if xxorm.DuplicateKey(storage.engine, err) {
+		return err
+	}
+
+	tx.Status = status
+	tx.Version++
+
+	return nil
+}
+
+func (storage *storageImpl) NewResource(resource *engine.Resource, history *engine.History) error {
+	return storage.transact(func(session *xorm.Session) error {
+		return storage.newResource(session, resource, history)
+	})
+}
+
+func (storage *storageImpl) newResource(session *xorm.Session, resource *engine.Resource, history *engine.History) error {
+	resource.Version = 1
+
+	if _, err := session.InsertOne(resource); err != nil {
+		if storage.duplicateKey(err) {
 			return xerrors.Wrapf(gomesh.ErrExists,
 				"resource(%s,%s,%s,%s) exists", resource.Tx, resource.Require, resource.Agent, resource.Resource)
 		}
+
+		return xerrors.Wrapf(err,
+			"insert resource(%s,%s,%s,%s) error", resource.Tx, resource.Require, resource.Agent, resource.Resource)
 	}
 
-	return nil
+	return storage.appendHistory(session, resourceHistory(history, resource, resource.Status, resource.Status))
 }
 
-func (storage *storageImpl) UpdateResourceStatus(txid, require, agent, resource string, status tcc.TxStatus) error {
-	_, err := storage.engine.
-		Where(`"tx" = ? and "require" = ? and "agent" = ? and "resource" = ?`, txid, require, agent, resource).
-		Cols("status").Update(&engine.Resource{Status: status})
+func (storage *storageImpl) GetResource(txid, require, agent, resource string) (*engine.Resource, error) {
+	target := &engine.Resource{}
+
+	ok, err := storage.engine.
+		Where(storage.dialect.where("tx", "require", "agent", "resource"), txid, require, agent, resource).
+		Get(target)
 
 	if err != nil {
-		return xerrors.Wrapf(err, "update resource(%s,%s,%s,%s) error", txid, require, agent, resource)
+		return nil, xerrors.Wrapf(err, "get resource(%s,%s,%s,%s) error", txid, require, agent, resource)
 	}
 
-	return nil
+	if !ok {
+		return nil, nil
+	}
+
+	return target, nil
 }
 
-func (storage *storageImpl) GetResourceByTx(id string) ([]*engine.Resource, error) {
-	resources := make([]*engine.Resource, 0)
+func (storage *storageImpl) UpdateResourceStatus(resource *engine.Resource, status tcc.TxStatus, history *engine.History) error {
+	err := storage.transact(func(session *xorm.Session) error {
+		return storage.updateResourceStatus(session, resource, status, history)
+	})
 
-	err := storage.engine.Where(`"tx" = ?`, id).Find(&resources)
+	if err != nil {
+		return err
+	}
+
+	resource.Status = status
+	resource.Version++
+
+	return nil
+}
+
+// updateResourceStatus compare and swap the resource row, the caller update resource after committed
+func (storage *storageImpl) updateResourceStatus(session *xorm.Session, resource *engine.Resource, status tcc.TxStatus, history *engine.History) error {
+	c, err := session.
+		Where(storage.dialect.where("i_d", "version"), resource.ID, resource.Version).
+		Cols("status", "version").Update(&engine.Resource{Status: status, Version: resource.Version + 1})
 
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "get resources by tx %s error", id)
+		return xerrors.Wrapf(err, "update resource %s status to %s error", resource.ID, status)
 	}
 
-	return resources, nil
+	if c == 0 {
+		return xerrors.Wrapf(engine.ErrConflict,
+			"update resource %s status to %s with version %d conflict", resource.ID, status, resource.Version)
+	}
+
+	return storage.appendHistory(session, resourceHistory(history, resource, resource.Status, status))
 }
 
-func (storage *storageImpl) UpdateResourcesStatus(txid, agent, resource string, status tcc.TxStatus) error {
-	_, err := storage.engine.
-		Where(`"tx" = ? and "agent" = ? and "resource" = ?`, txid, agent, resource).
-		Cols("status").Update(&engine.Resource{Status: status})
+func (storage *storageImpl) GetResourceByTx(id string) ([]*engine.Resource, error) {
+	resources := make([]*engine.Resource, 0)
+
+	err := storage.engine.Where(storage.dialect.where("tx"), id).Find(&resources)
 
 	if err != nil {
-		return xerrors.Wrapf(err, "update resource(%s,%s,%s) error", txid, agent, resource)
+		return nil, xerrors.Wrapf(err, "get resources by tx %s error", id)
 	}
 
-	return nil
+	return resources, nil
 }
 
-var queryNotifyTxSQL = `SELECT * FROM tcc_engine_transaction WHERE i_d in (SELECT DISTINCT("tx") from (SELECT "tx" FROM tcc_engine_resource WHERE agent = ? and status = 1 ORDER BY i_d DESC LIMIT ?) as s);
-`
+const queryNotifyLimit = 5
 
 func (storage *storageImpl) QueryNotifyTx(agent string) ([]*engine.Transaction, error) {
 
 	trans := make([]*engine.Transaction, 0)
 
-	err := storage.engine.SQL(queryNotifyTxSQL, agent, 5).Find(&trans)
+	err := storage.engine.SQL(storage.dialect.queryNotifyTx(), agent, tcc.TxStatus_Locked, queryNotifyLimit).Find(&trans)
 
 	if err != nil {
 		return nil, xerrors.Wrapf(err, "query notify for agent %s error", agent)
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/source/memory"
+	"github.com/dynamicgo/xerrors"
+	"github.com/go-xorm/xorm"
+	"github.com/gomeshnetwork/tcc/engine"
+	"github.com/gomeshnetwork/tcc/engine/migration"
+	"github.com/gomeshnetwork/tcc/engine/services/storage/storagetest"
+)
+
+func newTestConfig(t *testing.T, data string) config.Config {
+	conf := config.NewConfig()
+
+	if err := conf.Load(memory.NewSource(memory.WithData([]byte(data)))); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func newSQLiteStorage(t *testing.T) engine.Storage {
+	dir, err := ioutil.TempDir("", "tcc")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := fmt.Sprintf("file:%s?_busy_timeout=5000", filepath.Join(dir, "tcc.db"))
+
+	config := newTestConfig(t, fmt.Sprintf(`{"driver":"sqlite3","source":%q}`, source))
+
+	if _, err := New(config); !xerrors.Is(err, migration.ErrOutdated) {
+		t.Fatalf("expect migration.ErrOutdated for empty database, got %v", err)
+	}
+
+	db, err := xorm.NewEngine("sqlite3", source)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migration.New(db).Migrate(-1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	storage, err := New(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db = storage.(*storageImpl).engine
+
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	return storage
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	storagetest.Run(t, newSQLiteStorage)
+}
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) engine.Storage {
+		storage, err := New(newTestConfig(t, `{"driver":"memory"}`))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return storage
+	})
+}
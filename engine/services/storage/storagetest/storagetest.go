@@ -0,0 +1,886 @@
+// Package storagetest provides a conformance test suite for engine.Storage implementations
+package storagetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/gomesh"
+	"github.com/gomeshnetwork/tcc"
+	"github.com/gomeshnetwork/tcc/engine"
+)
+
+// Factory create a new empty engine.Storage for each test case
+type Factory func(t *testing.T) engine.Storage
+
+type testCase struct {
+	name string
+	f    func(t *testing.T, storage engine.Storage)
+}
+
+var testCases = []testCase{
+	{"NewTx", testNewTx},
+	{"NewTxDuplicate", testNewTxDuplicate},
+	{"UpdateTxStatus", testUpdateTxStatus},
+	{"NewResourceDuplicate", testNewResourceDuplicate},
+	{"UpdateResourceStatus", testUpdateResourceStatus},
+	{"VersionConflict", testVersionConflict},
+	{"WriteResources", testWriteResources},
+	{"QueryNotifyTx", testQueryNotifyTx},
+	{"ConcurrentUpdate", testConcurrentUpdate},
+	{"NoLostUpdate", testNoLostUpdate},
+	{"QueryFinishedTx", testQueryFinishedTx},
+	{"History", testHistory},
+	{"ArchiveTx", testArchiveTx},
+	{"DeleteTx", testDeleteTx},
+	{"ArchiveUnfinishedTx", testArchiveUnfinishedTx},
+	{"QueryTx", testQueryTx},
+	{"ImportTx", testImportTx},
+}
+
+// Run run the conformance test suite against storages created by factory
+func Run(t *testing.T, factory Factory) {
+	for _, c := range testCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.f(t, factory(t))
+		})
+	}
+}
+
+func newTx(t *testing.T, storage engine.Storage, id string, status tcc.TxStatus) {
+	if err := storage.NewTx(&engine.Transaction{ID: id, Status: status}, nil); err != nil {
+		t.Fatalf("create tx %s error: %s", id, err)
+	}
+}
+
+func newResource(t *testing.T, storage engine.Storage, id, tx, rid, agent string, status tcc.TxStatus) {
+	err := storage.NewResource(&engine.Resource{
+		ID:       id,
+		Tx:       tx,
+		Require:  rid,
+		Agent:    agent,
+		Resource: "/test/Lock",
+		Status:   status,
+	}, nil)
+
+	if err != nil {
+		t.Fatalf("create resource %s error: %s", id, err)
+	}
+}
+
+func getResources(t *testing.T, storage engine.Storage, tx string) map[string]*engine.Resource {
+	resources, err := storage.GetResourceByTx(tx)
+
+	if err != nil {
+		t.Fatalf("get resources by tx %s error: %s", tx, err)
+	}
+
+	indexer := make(map[string]*engine.Resource)
+
+	for _, resource := range resources {
+		indexer[resource.Require] = resource
+	}
+
+	return indexer
+}
+
+func testNewTx(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+
+	resources := getResources(t, storage, "1")
+
+	if len(resources) != 1 {
+		t.Fatalf("expect 1 resource, got %d", len(resources))
+	}
+
+	resource := resources["rid1"]
+
+	if resource == nil || resource.ID != "R_1" || resource.Tx != "1" || resource.Agent != "agent" ||
+		resource.Resource != "/test/Lock" || resource.Status != tcc.TxStatus_Created {
+		t.Fatalf("unexpect resource %v", resource)
+	}
+
+	if resource.CreatedTime.IsZero() {
+		t.Fatalf("expect resource created time set")
+	}
+
+	if resources := getResources(t, storage, "2"); len(resources) != 0 {
+		t.Fatalf("expect no resources for unknown tx, got %d", len(resources))
+	}
+}
+
+func testNewTxDuplicate(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	err := storage.NewTx(&engine.Transaction{ID: "1"}, nil)
+
+	if !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect gomesh.ErrExists, got %v", err)
+	}
+}
+
+func getTx(t *testing.T, storage engine.Storage, id string) *engine.Transaction {
+	tx, err := storage.GetTx(id)
+
+	if err != nil {
+		t.Fatalf("get tx %s error: %s", id, err)
+	}
+
+	return tx
+}
+
+func getResource(t *testing.T, storage engine.Storage, tx, rid, agent string) *engine.Resource {
+	resource, err := storage.GetResource(tx, rid, agent, "/test/Lock")
+
+	if err != nil {
+		t.Fatalf("get resource(%s,%s,%s) error: %s", tx, rid, agent, err)
+	}
+
+	return resource
+}
+
+func testUpdateTxStatus(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	tx := getTx(t, storage, "1")
+
+	if tx == nil || tx.Version != 1 {
+		t.Fatalf("expect tx 1 with version 1, got %v", tx)
+	}
+
+	if err := storage.UpdateTxStatus(tx, tcc.TxStatus_Confirmed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.Status != tcc.TxStatus_Confirmed || tx.Version != 2 {
+		t.Fatalf("expect tx updated in place, got %v", tx)
+	}
+
+	if tx := getTx(t, storage, "1"); tx.Status != tcc.TxStatus_Confirmed || tx.Version != 2 {
+		t.Fatalf("expect tx 1 confirmed with version 2, got %v", tx)
+	}
+
+	if tx := getTx(t, storage, "2"); tx != nil {
+		t.Fatalf("expect unknown tx return nil, got %v", tx)
+	}
+}
+
+func testNewResourceDuplicate(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+
+	err := storage.NewResource(&engine.Resource{
+		ID:       "R_2",
+		Tx:       "1",
+		Require:  "rid1",
+		Agent:    "agent",
+		Resource: "/test/Lock",
+	}, nil)
+
+	if !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect gomesh.ErrExists for duplicate (tx,rid,agent,resource), got %v", err)
+	}
+
+	err = storage.NewResource(&engine.Resource{
+		ID:       "R_1",
+		Tx:       "1",
+		Require:  "rid2",
+		Agent:    "agent",
+		Resource: "/test/Lock",
+	}, nil)
+
+	if !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect gomesh.ErrExists for duplicate id, got %v", err)
+	}
+}
+
+func testUpdateResourceStatus(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+	newResource(t, storage, "R_2", "1", "rid2", "agent", tcc.TxStatus_Created)
+
+	resource := getResource(t, storage, "1", "rid1", "agent")
+
+	if resource == nil || resource.ID != "R_1" || resource.Version != 1 {
+		t.Fatalf("unexpect resource %v", resource)
+	}
+
+	if err := storage.UpdateResourceStatus(resource, tcc.TxStatus_Locked, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if resource.Status != tcc.TxStatus_Locked || resource.Version != 2 {
+		t.Fatalf("expect resource updated in place, got %v", resource)
+	}
+
+	resources := getResources(t, storage, "1")
+
+	if resources["rid1"].Status != tcc.TxStatus_Locked || resources["rid1"].Version != 2 {
+		t.Fatalf("expect rid1 locked with version 2, got %v", resources["rid1"])
+	}
+
+	if resources["rid2"].Status != tcc.TxStatus_Created || resources["rid2"].Version != 1 {
+		t.Fatalf("expect rid2 untouched, got %v", resources["rid2"])
+	}
+
+	if resource := getResource(t, storage, "1", "rid3", "agent"); resource != nil {
+		t.Fatalf("expect unknown resource return nil, got %v", resource)
+	}
+}
+
+func testVersionConflict(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+
+	tx := getTx(t, storage, "1")
+	stale := *tx
+
+	if err := storage.UpdateTxStatus(tx, tcc.TxStatus_Confirmed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.UpdateTxStatus(&stale, tcc.TxStatus_Canceled, nil); !xerrors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expect engine.ErrConflict for stale tx, got %v", err)
+	}
+
+	if tx := getTx(t, storage, "1"); tx.Status != tcc.TxStatus_Confirmed {
+		t.Fatalf("expect stale update not applied, got %s", tx.Status)
+	}
+
+	resource := getResource(t, storage, "1", "rid1", "agent")
+	staleResource := *resource
+
+	if err := storage.UpdateResourceStatus(resource, tcc.TxStatus_Confirmed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.UpdateResourceStatus(&staleResource, tcc.TxStatus_Locked, nil); !xerrors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expect engine.ErrConflict for stale resource, got %v", err)
+	}
+
+	if resource := getResource(t, storage, "1", "rid1", "agent"); resource.Status != tcc.TxStatus_Confirmed {
+		t.Fatalf("expect stale update not applied, got %s", resource.Status)
+	}
+
+	err := storage.UpdateTxStatus(&engine.Transaction{ID: "2", Version: 1}, tcc.TxStatus_Confirmed, nil)
+
+	if !xerrors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expect engine.ErrConflict for unknown tx, got %v", err)
+	}
+}
+
+func testWriteResources(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+	newResource(t, storage, "R_2", "1", "rid2", "agent", tcc.TxStatus_Created)
+
+	resource := getResource(t, storage, "1", "rid1", "agent")
+
+	writes := []*engine.ResourceWrite{
+		{
+			Resource: &engine.Resource{ID: "R_3", Tx: "1", Require: "rid3", Agent: "agent", Resource: "/test/Lock"},
+			History:  &engine.History{ID: "H_1", Event: engine.HistoryCreate},
+		},
+		{Resource: resource, Update: true, Status: tcc.TxStatus_Locked, History: &engine.History{ID: "H_2"}},
+	}
+
+	for i, err := range storage.WriteResources(writes) {
+		if err != nil {
+			t.Fatalf("write %d error: %s", i, err)
+		}
+	}
+
+	if resource.Status != tcc.TxStatus_Locked || resource.Version != 2 {
+		t.Fatalf("expect resource updated in place, got %v", resource)
+	}
+
+	stale := *getResource(t, storage, "1", "rid2", "agent")
+	stale.Version = 5
+
+	writes = []*engine.ResourceWrite{
+		{Resource: &engine.Resource{ID: "R_4", Tx: "1", Require: "rid4", Agent: "agent", Resource: "/test/Lock"}},
+		{Resource: &engine.Resource{ID: "R_5", Tx: "1", Require: "rid1", Agent: "agent", Resource: "/test/Lock"}},
+		{Resource: &stale, Update: true, Status: tcc.TxStatus_Locked, History: &engine.History{ID: "H_3"}},
+		{Resource: resource, Update: true, Status: tcc.TxStatus_Confirmed, History: &engine.History{ID: "H_4"}},
+	}
+
+	errs := storage.WriteResources(writes)
+
+	if errs[0] != nil || errs[3] != nil {
+		t.Fatalf("expect valid writes applied, got %v", errs)
+	}
+
+	if !xerrors.Is(errs[1], gomesh.ErrExists) || !xerrors.Is(errs[2], engine.ErrConflict) {
+		t.Fatalf("expect ErrExists and ErrConflict for the failed writes, got %v", errs)
+	}
+
+	resources := getResources(t, storage, "1")
+
+	if len(resources) != 4 || resources["rid1"].Status != tcc.TxStatus_Confirmed || resources["rid2"].Version != 1 {
+		t.Fatalf("unexpect resources after batch write %v", resources)
+	}
+
+	var ids []string
+
+	for _, history := range getHistory(t, storage, "1") {
+		ids = append(ids, history.ID)
+	}
+
+	if fmt.Sprint(ids) != "[H_1 H_2 H_4]" {
+		t.Fatalf("expect histories of the applied writes, got %v", ids)
+	}
+}
+
+func testQueryNotifyTx(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Confirmed)
+	newTx(t, storage, "2", tcc.TxStatus_Confirmed)
+	newTx(t, storage, "3", tcc.TxStatus_Canceled)
+
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Locked)
+	newResource(t, storage, "R_2", "1", "rid2", "agent", tcc.TxStatus_Locked)
+	newResource(t, storage, "R_3", "2", "rid3", "agent", tcc.TxStatus_Confirmed)
+	newResource(t, storage, "R_4", "3", "rid4", "other", tcc.TxStatus_Locked)
+
+	txs, err := storage.QueryNotifyTx("agent")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 1 || txs[0].ID != "1" || txs[0].Status != tcc.TxStatus_Confirmed {
+		t.Fatalf("expect notify tx 1 for agent, got %v", txs)
+	}
+
+	txs, err = storage.QueryNotifyTx("other")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 1 || txs[0].ID != "3" || txs[0].Status != tcc.TxStatus_Canceled {
+		t.Fatalf("expect notify tx 3 for other, got %v", txs)
+	}
+
+	txs, err = storage.QueryNotifyTx("unknown")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 0 {
+		t.Fatalf("expect no notify tx for unknown agent, got %v", txs)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, storage engine.Storage) {
+	const workers = 8
+	const resources = 4
+
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+
+	for i := 0; i < workers*resources; i++ {
+		newResource(t, storage, fmt.Sprintf("R_%d", i), "1", fmt.Sprintf("rid%d", i), "agent", tcc.TxStatus_Created)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*resources)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w * resources; i < (w+1)*resources; i++ {
+				resource, err := storage.GetResource("1", fmt.Sprintf("rid%d", i), "agent", "/test/Lock")
+
+				if err == nil {
+					err = storage.UpdateResourceStatus(resource, tcc.TxStatus_Locked, nil)
+				}
+
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent update error: %s", err)
+	}
+
+	for rid, resource := range getResources(t, storage, "1") {
+		if resource.Status != tcc.TxStatus_Locked {
+			t.Fatalf("expect %s locked, got %s", rid, resource.Status)
+		}
+	}
+}
+
+// testNoLostUpdate run concurrent read-modify-write loops on the same rows, every successful compare and swap
+// must be reflected by the final row version
+func testNoLostUpdate(t *testing.T, storage engine.Storage) {
+	const workers = 8
+	const updates = 10
+
+	newTx(t, storage, "1", tcc.TxStatus_Created)
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Created)
+
+	var wg sync.WaitGroup
+	var conflicts int64
+	errs := make(chan error, workers*2)
+
+	statuses := []tcc.TxStatus{tcc.TxStatus_Created, tcc.TxStatus_Locked}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < updates; {
+				tx, err := storage.GetTx("1")
+
+				if err == nil {
+					err = storage.UpdateTxStatus(tx, statuses[(w+i)%2], nil)
+				}
+
+				if xerrors.Is(err, engine.ErrConflict) {
+					atomic.AddInt64(&conflicts, 1)
+					continue
+				}
+
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				i++
+			}
+
+			for i := 0; i < updates; {
+				resource, err := storage.GetResource("1", "rid1", "agent", "/test/Lock")
+
+				if err == nil {
+					err = storage.UpdateResourceStatus(resource, statuses[(w+i)%2], nil)
+				}
+
+				if xerrors.Is(err, engine.ErrConflict) {
+					atomic.AddInt64(&conflicts, 1)
+					continue
+				}
+
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				i++
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent compare and swap error: %s", err)
+	}
+
+	if tx := getTx(t, storage, "1"); tx.Version != 1+workers*updates {
+		t.Fatalf("expect tx version %d, got %d", 1+workers*updates, tx.Version)
+	}
+
+	if resource := getResource(t, storage, "1", "rid1", "agent"); resource.Version != 1+workers*updates {
+		t.Fatalf("expect resource version %d, got %d", 1+workers*updates, resource.Version)
+	}
+
+	t.Logf("%d version conflicts retried", conflicts)
+}
+
+func getHistory(t *testing.T, storage engine.Storage, tx string) []*engine.History {
+	histories, err := storage.GetTxHistory(tx)
+
+	if err != nil {
+		t.Fatalf("get histories by tx %s error: %s", tx, err)
+	}
+
+	return histories
+}
+
+func appendHistory(t *testing.T, storage engine.Storage, id, tx string) {
+	err := storage.AppendHistory(&engine.History{ID: id, Tx: tx, Event: engine.HistoryRedeliver})
+
+	if err != nil {
+		t.Fatalf("append history %s error: %s", id, err)
+	}
+}
+
+func testHistory(t *testing.T, storage engine.Storage) {
+	history := func(id string) *engine.History {
+		return &engine.History{ID: id, Event: engine.HistoryTransit, Node: "node", ActorType: engine.ActorInitiator, Actor: "agent"}
+	}
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, history("H_1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.NewTx(&engine.Transaction{ID: "1"}, history("H_0")); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect gomesh.ErrExists, got %v", err)
+	}
+
+	tx := getTx(t, storage, "1")
+	stale := *tx
+
+	if err := storage.UpdateTxStatus(tx, tcc.TxStatus_Confirmed, history("H_2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.UpdateTxStatus(&stale, tcc.TxStatus_Canceled, history("H_3")); !xerrors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expect engine.ErrConflict, got %v", err)
+	}
+
+	err := storage.NewResource(&engine.Resource{
+		ID: "R_1", Tx: "1", Require: "rid1", Agent: "agent", Resource: "/test/Lock",
+	}, history("H_4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := getResource(t, storage, "1", "rid1", "agent")
+
+	if err := storage.UpdateResourceStatus(resource, tcc.TxStatus_Locked, history("H_5")); err != nil {
+		t.Fatal(err)
+	}
+
+	appendHistory(t, storage, "H_6", "1")
+
+	histories := getHistory(t, storage, "1")
+
+	var ids []string
+
+	for _, history := range histories {
+		ids = append(ids, history.ID)
+	}
+
+	// the failed writes must not leave their histories
+	if fmt.Sprint(ids) != "[H_1 H_2 H_4 H_5 H_6]" {
+		t.Fatalf("unexpect histories %v", ids)
+	}
+
+	if h := histories[1]; h.Tx != "1" || h.Resource != "" || h.FromStatus != tcc.TxStatus_Created ||
+		h.ToStatus != tcc.TxStatus_Confirmed || h.Node != "node" || h.Actor != "agent" || h.CreatedTime.IsZero() {
+		t.Fatalf("unexpect tx history %v", h)
+	}
+
+	if h := histories[3]; h.Tx != "1" || h.Resource != "R_1" || h.FromStatus != tcc.TxStatus_Created ||
+		h.ToStatus != tcc.TxStatus_Locked {
+		t.Fatalf("unexpect resource history %v", h)
+	}
+
+	if histories := getHistory(t, storage, "2"); len(histories) != 0 {
+		t.Fatalf("expect no histories for unknown tx, got %v", histories)
+	}
+}
+
+func prepareFinishedTx(t *testing.T, storage engine.Storage) {
+	newTx(t, storage, "1", tcc.TxStatus_Confirmed)
+	newTx(t, storage, "2", tcc.TxStatus_Confirmed)
+	newTx(t, storage, "3", tcc.TxStatus_Canceled)
+	newTx(t, storage, "4", tcc.TxStatus_Confirmed)
+
+	newResource(t, storage, "R_1", "1", "rid1", "agent", tcc.TxStatus_Confirmed)
+	newResource(t, storage, "R_2", "1", "rid2", "other", tcc.TxStatus_Confirmed)
+	newResource(t, storage, "R_3", "2", "rid3", "agent", tcc.TxStatus_Confirmed)
+	newResource(t, storage, "R_4", "2", "rid4", "other", tcc.TxStatus_Locked)
+	newResource(t, storage, "R_5", "3", "rid5", "agent", tcc.TxStatus_Canceled)
+}
+
+func queryFinishedTx(t *testing.T, storage engine.Storage, status tcc.TxStatus, before time.Time, limit int) []string {
+	txs, err := storage.QueryFinishedTx(status, before, limit)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func testQueryFinishedTx(t *testing.T, storage engine.Storage) {
+	prepareFinishedTx(t, storage)
+
+	after := time.Now().Add(time.Hour)
+
+	if ids := queryFinishedTx(t, storage, tcc.TxStatus_Confirmed, after, 10); fmt.Sprint(ids) != "[1 4]" {
+		t.Fatalf("expect finished confirmed txs [1 4], got %v", ids)
+	}
+
+	if ids := queryFinishedTx(t, storage, tcc.TxStatus_Canceled, after, 10); fmt.Sprint(ids) != "[3]" {
+		t.Fatalf("expect finished canceled txs [3], got %v", ids)
+	}
+
+	if ids := queryFinishedTx(t, storage, tcc.TxStatus_Confirmed, after, 1); len(ids) != 1 {
+		t.Fatalf("expect limit 1 finished tx, got %v", ids)
+	}
+
+	if ids := queryFinishedTx(t, storage, tcc.TxStatus_Confirmed, time.Now().Add(-time.Hour), 10); len(ids) != 0 {
+		t.Fatalf("expect no finished tx before an hour ago, got %v", ids)
+	}
+}
+
+func testArchiveTx(t *testing.T, storage engine.Storage) {
+	prepareFinishedTx(t, storage)
+
+	appendHistory(t, storage, "H_1", "1")
+
+	if count, err := storage.ArchiveTx([]string{"1", "3"}); err != nil || count != 2 {
+		t.Fatalf("expect 2 txs archived, got %d %v", count, err)
+	}
+
+	if resources := getResources(t, storage, "1"); len(resources) != 0 {
+		t.Fatalf("expect archived tx resources removed, got %d", len(resources))
+	}
+
+	if tx := getTx(t, storage, "1"); tx != nil {
+		t.Fatalf("expect archived tx removed, got %v", tx)
+	}
+
+	tx, resources, err := storage.GetArchivedTx("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx == nil || tx.ID != "1" || tx.Status != tcc.TxStatus_Confirmed || tx.CreatedTime.IsZero() || tx.ArchivedTime.IsZero() {
+		t.Fatalf("unexpect archived tx %v", tx)
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf("expect 2 archived resources, got %d", len(resources))
+	}
+
+	for _, resource := range resources {
+		if resource.Tx != "1" || resource.Status != tcc.TxStatus_Confirmed || resource.CreatedTime.IsZero() {
+			t.Fatalf("unexpect archived resource %v", resource)
+		}
+	}
+
+	if histories := getHistory(t, storage, "1"); len(histories) != 1 || histories[0].ID != "H_1" {
+		t.Fatalf("expect archived tx histories, got %v", histories)
+	}
+
+	if resources := getResources(t, storage, "2"); len(resources) != 2 {
+		t.Fatalf("expect tx 2 untouched, got %d resources", len(resources))
+	}
+
+	tx, _, err = storage.GetArchivedTx("2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx != nil {
+		t.Fatalf("expect tx 2 not archived, got %v", tx)
+	}
+}
+
+func testDeleteTx(t *testing.T, storage engine.Storage) {
+	prepareFinishedTx(t, storage)
+
+	appendHistory(t, storage, "H_1", "3")
+
+	if count, err := storage.DeleteTx([]string{"3"}); err != nil || count != 1 {
+		t.Fatalf("expect 1 tx deleted, got %d %v", count, err)
+	}
+
+	if resources := getResources(t, storage, "3"); len(resources) != 0 {
+		t.Fatalf("expect deleted tx resources removed, got %d", len(resources))
+	}
+
+	tx, _, err := storage.GetArchivedTx("3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx != nil {
+		t.Fatalf("expect deleted tx not archived, got %v", tx)
+	}
+
+	if histories := getHistory(t, storage, "3"); len(histories) != 0 {
+		t.Fatalf("expect deleted tx histories removed, got %v", histories)
+	}
+
+	newTx(t, storage, "3", tcc.TxStatus_Created)
+}
+
+func testArchiveUnfinishedTx(t *testing.T, storage engine.Storage) {
+	prepareFinishedTx(t, storage)
+
+	if err := storage.NewTx(&engine.Transaction{ID: "5", PID: "1", Status: tcc.TxStatus_Created}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	newTx(t, storage, "6", tcc.TxStatus_Created)
+
+	if ids := queryFinishedTx(t, storage, tcc.TxStatus_Confirmed, time.Now().Add(time.Hour), 10); fmt.Sprint(ids) != "[4]" {
+		t.Fatalf("expect tx 1 with alive child not finished, got %v", ids)
+	}
+
+	// tx 2 has locked resource, tx 6 is alive and tx 1 has alive child
+	if count, err := storage.ArchiveTx([]string{"1", "2", "6"}); err != nil || count != 0 {
+		t.Fatalf("expect no tx archived, got %d %v", count, err)
+	}
+
+	if count, err := storage.DeleteTx([]string{"1", "2", "6"}); err != nil || count != 0 {
+		t.Fatalf("expect no tx deleted, got %d %v", count, err)
+	}
+
+	for _, id := range []string{"1", "2", "5", "6"} {
+		if tx := getTx(t, storage, id); tx == nil {
+			t.Fatalf("expect tx %s kept", id)
+		}
+	}
+
+	if err := storage.UpdateTxStatus(getTx(t, storage, "5"), tcc.TxStatus_Confirmed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := storage.ArchiveTx([]string{"1"}); err != nil || count != 1 {
+		t.Fatalf("expect tx 1 archived after child finished, got %d %v", count, err)
+	}
+}
+
+func queryTx(t *testing.T, storage engine.Storage, filter *engine.TxFilter) string {
+	txs, err := storage.QueryTx(filter)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+
+	return fmt.Sprint(ids)
+}
+
+func testQueryTx(t *testing.T, storage engine.Storage) {
+	prepareFinishedTx(t, storage)
+
+	if err := storage.NewTx(&engine.Transaction{ID: "5", PID: "1", Status: tcc.TxStatus_Created}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := queryTx(t, storage, &engine.TxFilter{}); ids != "[1 2 3 4 5]" {
+		t.Fatalf("expect all txs in id order, got %v", ids)
+	}
+
+	if ids := queryTx(t, storage, &engine.TxFilter{IDs: []string{"4", "2", "9"}}); ids != "[2 4]" {
+		t.Fatalf("expect txs [2 4] by ids, got %v", ids)
+	}
+
+	if ids := queryTx(t, storage, &engine.TxFilter{PIDs: []string{"1"}}); ids != "[5]" {
+		t.Fatalf("expect children [5] of tx 1, got %v", ids)
+	}
+
+	filter := &engine.TxFilter{Status: []tcc.TxStatus{tcc.TxStatus_Canceled, tcc.TxStatus_Created}}
+
+	if ids := queryTx(t, storage, filter); ids != "[3 5]" {
+		t.Fatalf("expect txs [3 5] by status, got %v", ids)
+	}
+
+	if ids := queryTx(t, storage, &engine.TxFilter{AfterID: "2", Limit: 2}); ids != "[3 4]" {
+		t.Fatalf("expect txs [3 4] after 2 limit 2, got %v", ids)
+	}
+
+	now := time.Now()
+
+	if ids := queryTx(t, storage, &engine.TxFilter{After: now.Add(-time.Hour), Before: now.Add(time.Hour)}); ids != "[1 2 3 4 5]" {
+		t.Fatalf("expect all txs created in the last hour, got %v", ids)
+	}
+
+	if ids := queryTx(t, storage, &engine.TxFilter{Before: now.Add(-time.Hour)}); ids != "[]" {
+		t.Fatalf("expect no txs created before an hour ago, got %v", ids)
+	}
+}
+
+func testImportTx(t *testing.T, storage engine.Storage) {
+	created := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	updated := created.Add(time.Minute)
+
+	record := &engine.TxRecord{
+		Tx: &engine.Transaction{
+			ID: "1", PID: "0", Status: tcc.TxStatus_Confirmed, Version: 3, CreatedTime: created, UpdatedTime: updated,
+		},
+		Resources: []*engine.Resource{
+			{
+				ID: "R_1", Tx: "1", Require: "rid", Agent: "agent", Resource: "/test/Lock",
+				Status: tcc.TxStatus_Confirmed, Version: 2, CreatedTime: created, UpdatedTime: updated,
+			},
+		},
+		Histories: []*engine.History{
+			{
+				ID: "H_1", Tx: "1", Event: engine.HistoryCreate, ActorType: engine.ActorInitiator, Actor: "127.0.0.1",
+				CreatedTime: created,
+			},
+		},
+	}
+
+	if err := storage.ImportTx(record); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := getTx(t, storage, "1")
+
+	if tx == nil || tx.PID != "0" || tx.Version != 3 || !tx.CreatedTime.Equal(created) || !tx.UpdatedTime.Equal(updated) {
+		t.Fatalf("unexpect imported tx %v", tx)
+	}
+
+	resource := getResource(t, storage, "1", "rid", "agent")
+
+	if resource == nil || resource.ID != "R_1" || resource.Version != 2 || !resource.CreatedTime.Equal(created) {
+		t.Fatalf("unexpect imported resource %v", resource)
+	}
+
+	if histories := getHistory(t, storage, "1"); len(histories) != 1 || !histories[0].CreatedTime.Equal(created) {
+		t.Fatalf("unexpect imported histories %v", histories)
+	}
+
+	if err := storage.ImportTx(record); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect ErrExists for imported tx, got %v", err)
+	}
+
+	record.Tx = &engine.Transaction{ID: "2", Status: tcc.TxStatus_Confirmed, Version: 1}
+
+	if err := storage.ImportTx(record); !xerrors.Is(err, gomesh.ErrExists) {
+		t.Fatalf("expect ErrExists for imported resource, got %v", err)
+	}
+
+	if tx := getTx(t, storage, "2"); tx != nil {
+		t.Fatalf("expect failed import rolled back, got %v", tx)
+	}
+}
@@ -1,3 +1,4 @@
 package tcc
 
 //go:generate protoc --go_out=plugins=grpc,paths=source_relative:. tcc.proto
+//go:generate protoc --go_out=paths=source_relative:. options.proto
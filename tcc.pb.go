@@ -20,7 +20,7 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 type TxStatus int32
 
@@ -30,6 +30,7 @@ const (
 	TxStatus_Confirmed TxStatus = 2
 	TxStatus_Canceled  TxStatus = 3
 	TxStatus_Timeout   TxStatus = 4
+	TxStatus_Failed    TxStatus = 5
 )
 
 var TxStatus_name = map[int32]string{
@@ -38,6 +39,7 @@ var TxStatus_name = map[int32]string{
 	2: "Confirmed",
 	3: "Canceled",
 	4: "Timeout",
+	5: "Failed",
 }
 
 var TxStatus_value = map[string]int32{
@@ -46,6 +48,7 @@ var TxStatus_value = map[string]int32{
 	"Confirmed": 2,
 	"Canceled":  3,
 	"Timeout":   4,
+	"Failed":    5,
 }
 
 func (x TxStatus) String() string {
@@ -487,6 +490,108 @@ func (m *EndLockResourceRespose) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_EndLockResourceRespose proto.InternalMessageInfo
 
+type FailLockResourceRequest struct {
+	Txid                 string   `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	Rid                  string   `protobuf:"bytes,2,opt,name=rid,proto3" json:"rid,omitempty"`
+	Agent                string   `protobuf:"bytes,3,opt,name=agent,proto3" json:"agent,omitempty"`
+	Resource             string   `protobuf:"bytes,4,opt,name=resource,proto3" json:"resource,omitempty"`
+	Reason               string   `protobuf:"bytes,5,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FailLockResourceRequest) Reset()         { *m = FailLockResourceRequest{} }
+func (m *FailLockResourceRequest) String() string { return proto.CompactTextString(m) }
+func (*FailLockResourceRequest) ProtoMessage()    {}
+func (*FailLockResourceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{10}
+}
+
+func (m *FailLockResourceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FailLockResourceRequest.Unmarshal(m, b)
+}
+func (m *FailLockResourceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FailLockResourceRequest.Marshal(b, m, deterministic)
+}
+func (m *FailLockResourceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FailLockResourceRequest.Merge(m, src)
+}
+func (m *FailLockResourceRequest) XXX_Size() int {
+	return xxx_messageInfo_FailLockResourceRequest.Size(m)
+}
+func (m *FailLockResourceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_FailLockResourceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FailLockResourceRequest proto.InternalMessageInfo
+
+func (m *FailLockResourceRequest) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+func (m *FailLockResourceRequest) GetRid() string {
+	if m != nil {
+		return m.Rid
+	}
+	return ""
+}
+
+func (m *FailLockResourceRequest) GetAgent() string {
+	if m != nil {
+		return m.Agent
+	}
+	return ""
+}
+
+func (m *FailLockResourceRequest) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *FailLockResourceRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type FailLockResourceRespose struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FailLockResourceRespose) Reset()         { *m = FailLockResourceRespose{} }
+func (m *FailLockResourceRespose) String() string { return proto.CompactTextString(m) }
+func (*FailLockResourceRespose) ProtoMessage()    {}
+func (*FailLockResourceRespose) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{11}
+}
+
+func (m *FailLockResourceRespose) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FailLockResourceRespose.Unmarshal(m, b)
+}
+func (m *FailLockResourceRespose) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FailLockResourceRespose.Marshal(b, m, deterministic)
+}
+func (m *FailLockResourceRespose) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FailLockResourceRespose.Merge(m, src)
+}
+func (m *FailLockResourceRespose) XXX_Size() int {
+	return xxx_messageInfo_FailLockResourceRespose.Size(m)
+}
+func (m *FailLockResourceRespose) XXX_DiscardUnknown() {
+	xxx_messageInfo_FailLockResourceRespose.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FailLockResourceRespose proto.InternalMessageInfo
+
 type AgentCommandRequest struct {
 	Txid                 string       `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
 	Resource             string       `protobuf:"bytes,2,opt,name=resource,proto3" json:"resource,omitempty"`
@@ -500,7 +605,7 @@ func (m *AgentCommandRequest) Reset()         { *m = AgentCommandRequest{} }
 func (m *AgentCommandRequest) String() string { return proto.CompactTextString(m) }
 func (*AgentCommandRequest) ProtoMessage()    {}
 func (*AgentCommandRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_35dc7e9ebe8c6643, []int{10}
+	return fileDescriptor_35dc7e9ebe8c6643, []int{12}
 }
 
 func (m *AgentCommandRequest) XXX_Unmarshal(b []byte) error {
@@ -553,7 +658,7 @@ func (m *AttachAgentRequest) Reset()         { *m = AttachAgentRequest{} }
 func (m *AttachAgentRequest) String() string { return proto.CompactTextString(m) }
 func (*AttachAgentRequest) ProtoMessage()    {}
 func (*AttachAgentRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_35dc7e9ebe8c6643, []int{11}
+	return fileDescriptor_35dc7e9ebe8c6643, []int{13}
 }
 
 func (m *AttachAgentRequest) XXX_Unmarshal(b []byte) error {
@@ -595,7 +700,7 @@ func (m *ResourceStatusChangedRequest) Reset()         { *m = ResourceStatusChan
 func (m *ResourceStatusChangedRequest) String() string { return proto.CompactTextString(m) }
 func (*ResourceStatusChangedRequest) ProtoMessage()    {}
 func (*ResourceStatusChangedRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_35dc7e9ebe8c6643, []int{12}
+	return fileDescriptor_35dc7e9ebe8c6643, []int{14}
 }
 
 func (m *ResourceStatusChangedRequest) XXX_Unmarshal(b []byte) error {
@@ -654,7 +759,7 @@ func (m *ResourceStatusChangedRespose) Reset()         { *m = ResourceStatusChan
 func (m *ResourceStatusChangedRespose) String() string { return proto.CompactTextString(m) }
 func (*ResourceStatusChangedRespose) ProtoMessage()    {}
 func (*ResourceStatusChangedRespose) Descriptor() ([]byte, []int) {
-	return fileDescriptor_35dc7e9ebe8c6643, []int{13}
+	return fileDescriptor_35dc7e9ebe8c6643, []int{15}
 }
 
 func (m *ResourceStatusChangedRespose) XXX_Unmarshal(b []byte) error {
@@ -675,6 +780,526 @@ func (m *ResourceStatusChangedRespose) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ResourceStatusChangedRespose proto.InternalMessageInfo
 
+type ResourceCommandFailedRequest struct {
+	Txid                 string       `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	Resource             string       `protobuf:"bytes,2,opt,name=resource,proto3" json:"resource,omitempty"`
+	Command              AgentCommand `protobuf:"varint,3,opt,name=command,proto3,enum=tcc.AgentCommand" json:"command,omitempty"`
+	Agent                string       `protobuf:"bytes,4,opt,name=agent,proto3" json:"agent,omitempty"`
+	Error                string       `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	Permanent            bool         `protobuf:"varint,6,opt,name=permanent,proto3" json:"permanent,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ResourceCommandFailedRequest) Reset()         { *m = ResourceCommandFailedRequest{} }
+func (m *ResourceCommandFailedRequest) String() string { return proto.CompactTextString(m) }
+func (*ResourceCommandFailedRequest) ProtoMessage()    {}
+func (*ResourceCommandFailedRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{16}
+}
+
+func (m *ResourceCommandFailedRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResourceCommandFailedRequest.Unmarshal(m, b)
+}
+func (m *ResourceCommandFailedRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResourceCommandFailedRequest.Marshal(b, m, deterministic)
+}
+func (m *ResourceCommandFailedRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResourceCommandFailedRequest.Merge(m, src)
+}
+func (m *ResourceCommandFailedRequest) XXX_Size() int {
+	return xxx_messageInfo_ResourceCommandFailedRequest.Size(m)
+}
+func (m *ResourceCommandFailedRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResourceCommandFailedRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResourceCommandFailedRequest proto.InternalMessageInfo
+
+func (m *ResourceCommandFailedRequest) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+func (m *ResourceCommandFailedRequest) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *ResourceCommandFailedRequest) GetCommand() AgentCommand {
+	if m != nil {
+		return m.Command
+	}
+	return AgentCommand_COMMMIT
+}
+
+func (m *ResourceCommandFailedRequest) GetAgent() string {
+	if m != nil {
+		return m.Agent
+	}
+	return ""
+}
+
+func (m *ResourceCommandFailedRequest) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *ResourceCommandFailedRequest) GetPermanent() bool {
+	if m != nil {
+		return m.Permanent
+	}
+	return false
+}
+
+type ResourceCommandFailedResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResourceCommandFailedResponse) Reset()         { *m = ResourceCommandFailedResponse{} }
+func (m *ResourceCommandFailedResponse) String() string { return proto.CompactTextString(m) }
+func (*ResourceCommandFailedResponse) ProtoMessage()    {}
+func (*ResourceCommandFailedResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{17}
+}
+
+func (m *ResourceCommandFailedResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResourceCommandFailedResponse.Unmarshal(m, b)
+}
+func (m *ResourceCommandFailedResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResourceCommandFailedResponse.Marshal(b, m, deterministic)
+}
+func (m *ResourceCommandFailedResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResourceCommandFailedResponse.Merge(m, src)
+}
+func (m *ResourceCommandFailedResponse) XXX_Size() int {
+	return xxx_messageInfo_ResourceCommandFailedResponse.Size(m)
+}
+func (m *ResourceCommandFailedResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResourceCommandFailedResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResourceCommandFailedResponse proto.InternalMessageInfo
+
+type TxResource struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Rid                  string   `protobuf:"bytes,2,opt,name=rid,proto3" json:"rid,omitempty"`
+	Agent                string   `protobuf:"bytes,3,opt,name=agent,proto3" json:"agent,omitempty"`
+	Resource             string   `protobuf:"bytes,4,opt,name=resource,proto3" json:"resource,omitempty"`
+	Status               TxStatus `protobuf:"varint,5,opt,name=status,proto3,enum=tcc.TxStatus" json:"status,omitempty"`
+	CreatedTime          int64    `protobuf:"varint,6,opt,name=created_time,json=createdTime,proto3" json:"created_time,omitempty"`
+	UpdatedTime          int64    `protobuf:"varint,7,opt,name=updated_time,json=updatedTime,proto3" json:"updated_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TxResource) Reset()         { *m = TxResource{} }
+func (m *TxResource) String() string { return proto.CompactTextString(m) }
+func (*TxResource) ProtoMessage()    {}
+func (*TxResource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{18}
+}
+
+func (m *TxResource) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TxResource.Unmarshal(m, b)
+}
+func (m *TxResource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TxResource.Marshal(b, m, deterministic)
+}
+func (m *TxResource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TxResource.Merge(m, src)
+}
+func (m *TxResource) XXX_Size() int {
+	return xxx_messageInfo_TxResource.Size(m)
+}
+func (m *TxResource) XXX_DiscardUnknown() {
+	xxx_messageInfo_TxResource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TxResource proto.InternalMessageInfo
+
+func (m *TxResource) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *TxResource) GetRid() string {
+	if m != nil {
+		return m.Rid
+	}
+	return ""
+}
+
+func (m *TxResource) GetAgent() string {
+	if m != nil {
+		return m.Agent
+	}
+	return ""
+}
+
+func (m *TxResource) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *TxResource) GetStatus() TxStatus {
+	if m != nil {
+		return m.Status
+	}
+	return TxStatus_Created
+}
+
+func (m *TxResource) GetCreatedTime() int64 {
+	if m != nil {
+		return m.CreatedTime
+	}
+	return 0
+}
+
+func (m *TxResource) GetUpdatedTime() int64 {
+	if m != nil {
+		return m.UpdatedTime
+	}
+	return 0
+}
+
+type GetArchivedTxRequest struct {
+	Txid                 string   `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetArchivedTxRequest) Reset()         { *m = GetArchivedTxRequest{} }
+func (m *GetArchivedTxRequest) String() string { return proto.CompactTextString(m) }
+func (*GetArchivedTxRequest) ProtoMessage()    {}
+func (*GetArchivedTxRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{19}
+}
+
+func (m *GetArchivedTxRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetArchivedTxRequest.Unmarshal(m, b)
+}
+func (m *GetArchivedTxRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetArchivedTxRequest.Marshal(b, m, deterministic)
+}
+func (m *GetArchivedTxRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetArchivedTxRequest.Merge(m, src)
+}
+func (m *GetArchivedTxRequest) XXX_Size() int {
+	return xxx_messageInfo_GetArchivedTxRequest.Size(m)
+}
+func (m *GetArchivedTxRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetArchivedTxRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetArchivedTxRequest proto.InternalMessageInfo
+
+func (m *GetArchivedTxRequest) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+type GetArchivedTxResponse struct {
+	Txid                 string        `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	Pid                  string        `protobuf:"bytes,2,opt,name=pid,proto3" json:"pid,omitempty"`
+	Status               TxStatus      `protobuf:"varint,3,opt,name=status,proto3,enum=tcc.TxStatus" json:"status,omitempty"`
+	CreatedTime          int64         `protobuf:"varint,4,opt,name=created_time,json=createdTime,proto3" json:"created_time,omitempty"`
+	UpdatedTime          int64         `protobuf:"varint,5,opt,name=updated_time,json=updatedTime,proto3" json:"updated_time,omitempty"`
+	ArchivedTime         int64         `protobuf:"varint,6,opt,name=archived_time,json=archivedTime,proto3" json:"archived_time,omitempty"`
+	Resources            []*TxResource `protobuf:"bytes,7,rep,name=resources,proto3" json:"resources,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *GetArchivedTxResponse) Reset()         { *m = GetArchivedTxResponse{} }
+func (m *GetArchivedTxResponse) String() string { return proto.CompactTextString(m) }
+func (*GetArchivedTxResponse) ProtoMessage()    {}
+func (*GetArchivedTxResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{20}
+}
+
+func (m *GetArchivedTxResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetArchivedTxResponse.Unmarshal(m, b)
+}
+func (m *GetArchivedTxResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetArchivedTxResponse.Marshal(b, m, deterministic)
+}
+func (m *GetArchivedTxResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetArchivedTxResponse.Merge(m, src)
+}
+func (m *GetArchivedTxResponse) XXX_Size() int {
+	return xxx_messageInfo_GetArchivedTxResponse.Size(m)
+}
+func (m *GetArchivedTxResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetArchivedTxResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetArchivedTxResponse proto.InternalMessageInfo
+
+func (m *GetArchivedTxResponse) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+func (m *GetArchivedTxResponse) GetPid() string {
+	if m != nil {
+		return m.Pid
+	}
+	return ""
+}
+
+func (m *GetArchivedTxResponse) GetStatus() TxStatus {
+	if m != nil {
+		return m.Status
+	}
+	return TxStatus_Created
+}
+
+func (m *GetArchivedTxResponse) GetCreatedTime() int64 {
+	if m != nil {
+		return m.CreatedTime
+	}
+	return 0
+}
+
+func (m *GetArchivedTxResponse) GetUpdatedTime() int64 {
+	if m != nil {
+		return m.UpdatedTime
+	}
+	return 0
+}
+
+func (m *GetArchivedTxResponse) GetArchivedTime() int64 {
+	if m != nil {
+		return m.ArchivedTime
+	}
+	return 0
+}
+
+func (m *GetArchivedTxResponse) GetResources() []*TxResource {
+	if m != nil {
+		return m.Resources
+	}
+	return nil
+}
+
+type TxHistory struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Txid                 string   `protobuf:"bytes,2,opt,name=txid,proto3" json:"txid,omitempty"`
+	Resource             string   `protobuf:"bytes,3,opt,name=resource,proto3" json:"resource,omitempty"`
+	Event                string   `protobuf:"bytes,4,opt,name=event,proto3" json:"event,omitempty"`
+	FromStatus           TxStatus `protobuf:"varint,5,opt,name=from_status,json=fromStatus,proto3,enum=tcc.TxStatus" json:"from_status,omitempty"`
+	ToStatus             TxStatus `protobuf:"varint,6,opt,name=to_status,json=toStatus,proto3,enum=tcc.TxStatus" json:"to_status,omitempty"`
+	Node                 string   `protobuf:"bytes,7,opt,name=node,proto3" json:"node,omitempty"`
+	ActorType            string   `protobuf:"bytes,8,opt,name=actor_type,json=actorType,proto3" json:"actor_type,omitempty"`
+	Actor                string   `protobuf:"bytes,9,opt,name=actor,proto3" json:"actor,omitempty"`
+	Error                string   `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedTime          int64    `protobuf:"varint,11,opt,name=created_time,json=createdTime,proto3" json:"created_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TxHistory) Reset()         { *m = TxHistory{} }
+func (m *TxHistory) String() string { return proto.CompactTextString(m) }
+func (*TxHistory) ProtoMessage()    {}
+func (*TxHistory) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{21}
+}
+
+func (m *TxHistory) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TxHistory.Unmarshal(m, b)
+}
+func (m *TxHistory) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TxHistory.Marshal(b, m, deterministic)
+}
+func (m *TxHistory) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TxHistory.Merge(m, src)
+}
+func (m *TxHistory) XXX_Size() int {
+	return xxx_messageInfo_TxHistory.Size(m)
+}
+func (m *TxHistory) XXX_DiscardUnknown() {
+	xxx_messageInfo_TxHistory.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TxHistory proto.InternalMessageInfo
+
+func (m *TxHistory) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *TxHistory) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+func (m *TxHistory) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *TxHistory) GetEvent() string {
+	if m != nil {
+		return m.Event
+	}
+	return ""
+}
+
+func (m *TxHistory) GetFromStatus() TxStatus {
+	if m != nil {
+		return m.FromStatus
+	}
+	return TxStatus_Created
+}
+
+func (m *TxHistory) GetToStatus() TxStatus {
+	if m != nil {
+		return m.ToStatus
+	}
+	return TxStatus_Created
+}
+
+func (m *TxHistory) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *TxHistory) GetActorType() string {
+	if m != nil {
+		return m.ActorType
+	}
+	return ""
+}
+
+func (m *TxHistory) GetActor() string {
+	if m != nil {
+		return m.Actor
+	}
+	return ""
+}
+
+func (m *TxHistory) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *TxHistory) GetCreatedTime() int64 {
+	if m != nil {
+		return m.CreatedTime
+	}
+	return 0
+}
+
+type GetTxHistoryRequest struct {
+	Txid                 string   `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTxHistoryRequest) Reset()         { *m = GetTxHistoryRequest{} }
+func (m *GetTxHistoryRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTxHistoryRequest) ProtoMessage()    {}
+func (*GetTxHistoryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{22}
+}
+
+func (m *GetTxHistoryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTxHistoryRequest.Unmarshal(m, b)
+}
+func (m *GetTxHistoryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTxHistoryRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTxHistoryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTxHistoryRequest.Merge(m, src)
+}
+func (m *GetTxHistoryRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTxHistoryRequest.Size(m)
+}
+func (m *GetTxHistoryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTxHistoryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTxHistoryRequest proto.InternalMessageInfo
+
+func (m *GetTxHistoryRequest) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+type GetTxHistoryResponse struct {
+	Histories            []*TxHistory `protobuf:"bytes,1,rep,name=histories,proto3" json:"histories,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *GetTxHistoryResponse) Reset()         { *m = GetTxHistoryResponse{} }
+func (m *GetTxHistoryResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTxHistoryResponse) ProtoMessage()    {}
+func (*GetTxHistoryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_35dc7e9ebe8c6643, []int{23}
+}
+
+func (m *GetTxHistoryResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTxHistoryResponse.Unmarshal(m, b)
+}
+func (m *GetTxHistoryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTxHistoryResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTxHistoryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTxHistoryResponse.Merge(m, src)
+}
+func (m *GetTxHistoryResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTxHistoryResponse.Size(m)
+}
+func (m *GetTxHistoryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTxHistoryResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTxHistoryResponse proto.InternalMessageInfo
+
+func (m *GetTxHistoryResponse) GetHistories() []*TxHistory {
+	if m != nil {
+		return m.Histories
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("tcc.TxStatus", TxStatus_name, TxStatus_value)
 	proto.RegisterEnum("tcc.AgentCommand", AgentCommand_name, AgentCommand_value)
@@ -688,50 +1313,86 @@ func init() {
 	proto.RegisterType((*BeginLockResourceRespose)(nil), "tcc.BeginLockResourceRespose")
 	proto.RegisterType((*EndLockResourceRequest)(nil), "tcc.EndLockResourceRequest")
 	proto.RegisterType((*EndLockResourceRespose)(nil), "tcc.EndLockResourceRespose")
+	proto.RegisterType((*FailLockResourceRequest)(nil), "tcc.FailLockResourceRequest")
+	proto.RegisterType((*FailLockResourceRespose)(nil), "tcc.FailLockResourceRespose")
 	proto.RegisterType((*AgentCommandRequest)(nil), "tcc.AgentCommandRequest")
 	proto.RegisterType((*AttachAgentRequest)(nil), "tcc.AttachAgentRequest")
 	proto.RegisterType((*ResourceStatusChangedRequest)(nil), "tcc.ResourceStatusChangedRequest")
 	proto.RegisterType((*ResourceStatusChangedRespose)(nil), "tcc.ResourceStatusChangedRespose")
+	proto.RegisterType((*ResourceCommandFailedRequest)(nil), "tcc.ResourceCommandFailedRequest")
+	proto.RegisterType((*ResourceCommandFailedResponse)(nil), "tcc.ResourceCommandFailedResponse")
+	proto.RegisterType((*TxResource)(nil), "tcc.TxResource")
+	proto.RegisterType((*GetArchivedTxRequest)(nil), "tcc.GetArchivedTxRequest")
+	proto.RegisterType((*GetArchivedTxResponse)(nil), "tcc.GetArchivedTxResponse")
+	proto.RegisterType((*TxHistory)(nil), "tcc.TxHistory")
+	proto.RegisterType((*GetTxHistoryRequest)(nil), "tcc.GetTxHistoryRequest")
+	proto.RegisterType((*GetTxHistoryResponse)(nil), "tcc.GetTxHistoryResponse")
 }
 
 func init() { proto.RegisterFile("tcc.proto", fileDescriptor_35dc7e9ebe8c6643) }
 
 var fileDescriptor_35dc7e9ebe8c6643 = []byte{
-	// 533 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x54, 0x4d, 0x6f, 0xd3, 0x40,
-	0x10, 0xc5, 0x75, 0xea, 0x26, 0xd3, 0x84, 0xba, 0x43, 0x0b, 0x96, 0x29, 0x15, 0x18, 0x55, 0xa0,
-	0x20, 0xa5, 0xa8, 0x88, 0x1f, 0xd0, 0x44, 0x3d, 0x20, 0x08, 0x88, 0x90, 0x13, 0x12, 0x07, 0x77,
-	0x3d, 0x38, 0x56, 0xf1, 0x6e, 0xb0, 0xd7, 0x6a, 0xfe, 0x03, 0xbf, 0x94, 0x7f, 0x81, 0xbc, 0x6b,
-	0xbb, 0xce, 0x97, 0x91, 0x38, 0x70, 0xb3, 0x77, 0xde, 0x7b, 0xf3, 0x3c, 0x3b, 0xcf, 0xd0, 0x91,
-	0x8c, 0x0d, 0xe6, 0x89, 0x90, 0x02, 0x4d, 0xc9, 0x98, 0xe7, 0x41, 0xf7, 0x23, 0xdd, 0x4e, 0x17,
-	0x13, 0xfa, 0x99, 0x51, 0x2a, 0x11, 0xa1, 0x25, 0x17, 0x51, 0xe0, 0x18, 0x4f, 0x8d, 0x97, 0x9d,
-	0x89, 0x7a, 0xf6, 0x9e, 0x43, 0xaf, 0xc0, 0xa4, 0x73, 0xc1, 0x53, 0xaa, 0x40, 0x3b, 0x35, 0xd0,
-	0x19, 0x1c, 0x8c, 0x44, 0x1c, 0x47, 0xb2, 0x59, 0x0b, 0xc1, 0xbe, 0x83, 0x69, 0x39, 0x45, 0xf5,
-	0x39, 0xa3, 0x1f, 0x7f, 0xa7, 0x56, 0xb0, 0x82, 0x9a, 0x80, 0x33, 0xa4, 0x30, 0xe2, 0x1f, 0x04,
-	0xbb, 0x99, 0x50, 0x2a, 0xb2, 0x84, 0x51, 0x83, 0x06, 0xda, 0x60, 0x26, 0x95, 0xf1, 0xfc, 0x11,
-	0x8f, 0x60, 0xd7, 0x0f, 0x89, 0x4b, 0xc7, 0x54, 0x67, 0xfa, 0x05, 0x5d, 0x68, 0x27, 0x85, 0x9c,
-	0xd3, 0x52, 0x85, 0xea, 0xdd, 0x73, 0x37, 0xf6, 0x4c, 0xe7, 0x22, 0x25, 0x6f, 0x0e, 0x0f, 0xaf,
-	0x78, 0xf0, 0x3f, 0xdd, 0x38, 0x1b, 0x3a, 0x6a, 0x2f, 0x09, 0x3c, 0xb8, 0xcc, 0xe9, 0xf9, 0xbc,
-	0x7d, 0x1e, 0x34, 0x19, 0xa9, 0x37, 0xd8, 0x59, 0x6e, 0x80, 0xaf, 0x60, 0x8f, 0x69, 0x05, 0x65,
-	0xea, 0xfe, 0xc5, 0xe1, 0x20, 0xdf, 0xa1, 0x25, 0xe9, 0x12, 0xe1, 0xf5, 0x01, 0x2f, 0xa5, 0xf4,
-	0xd9, 0x4c, 0x95, 0xcb, 0x96, 0xd5, 0x57, 0x19, 0xb5, 0xaf, 0xf2, 0x7e, 0x19, 0x70, 0x52, 0x7a,
-	0xfe, 0x22, 0x7d, 0x99, 0xa5, 0xa3, 0x99, 0xcf, 0x43, 0xfa, 0x67, 0xa7, 0x67, 0x60, 0xa5, 0x4a,
-	0xa7, 0x30, 0xda, 0x53, 0x46, 0xa7, 0x0b, 0x2d, 0x3e, 0x29, 0x8a, 0x77, 0x6e, 0x5a, 0x75, 0x37,
-	0xa7, 0x5b, 0xcd, 0xa8, 0x69, 0xf6, 0xc7, 0xd0, 0x2e, 0x95, 0x70, 0x1f, 0xf6, 0x46, 0x09, 0xf9,
-	0x92, 0x02, 0xfb, 0x1e, 0x02, 0x58, 0xf9, 0xf4, 0x29, 0xb0, 0x0d, 0xec, 0x41, 0x67, 0x24, 0xf8,
-	0xf7, 0x28, 0x89, 0x29, 0xb0, 0x77, 0xb0, 0x0b, 0x6d, 0xbd, 0xb1, 0x14, 0xd8, 0x66, 0xce, 0x9a,
-	0x46, 0x31, 0x89, 0x4c, 0xda, 0xad, 0xfe, 0x0b, 0xe8, 0xd6, 0x27, 0xa8, 0x24, 0x3f, 0x8d, 0xc7,
-	0xe3, 0x77, 0x53, 0x2d, 0xa9, 0x79, 0xb6, 0x71, 0xf1, 0xdb, 0x04, 0xeb, 0x8a, 0x87, 0x11, 0x27,
-	0x1c, 0xc0, 0xae, 0xca, 0x21, 0xea, 0x1b, 0xa8, 0xe7, 0xd6, 0xc5, 0xfa, 0x51, 0x11, 0xd3, 0xb7,
-	0x60, 0xe9, 0xac, 0xe1, 0x91, 0xaa, 0xae, 0xe4, 0xd3, 0x3d, 0x5e, 0x39, 0xad, 0xd1, 0x54, 0xf7,
-	0x92, 0xb6, 0x9c, 0xcd, 0x92, 0xb6, 0x12, 0x45, 0xfc, 0x0c, 0x87, 0x6b, 0xb1, 0xc0, 0x27, 0x0a,
-	0xbb, 0x2d, 0xa2, 0xee, 0xd6, 0xb2, 0x9a, 0x39, 0xbe, 0x87, 0x83, 0x95, 0xdd, 0xc6, 0xc7, 0x8a,
-	0xb1, 0x39, 0x63, 0xee, 0x96, 0xa2, 0x16, 0xfb, 0x06, 0xc7, 0x1b, 0x2f, 0x18, 0x9f, 0x29, 0x56,
-	0xd3, 0x26, 0xba, 0x8d, 0x10, 0x2d, 0x3f, 0x84, 0xfd, 0xda, 0xe6, 0xe3, 0x23, 0x1d, 0x92, 0xb5,
-	0x2c, 0xb8, 0xce, 0x7a, 0x7a, 0x74, 0xe5, 0xb5, 0x31, 0x3c, 0xfd, 0x7a, 0x12, 0x46, 0x72, 0x96,
-	0x5d, 0x0f, 0x98, 0x88, 0xcf, 0x43, 0x11, 0x53, 0x3a, 0xe3, 0x24, 0x6f, 0x45, 0x72, 0x73, 0x2e,
-	0x19, 0xbb, 0xb6, 0xd4, 0x8f, 0xfb, 0xcd, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x0b, 0x25, 0xf0,
-	0xb8, 0xc5, 0x05, 0x00, 0x00,
+	// 956 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x57, 0xef, 0x72, 0xdb, 0x44,
+	0x10, 0x47, 0xfe, 0xa3, 0x58, 0x6b, 0x3b, 0x51, 0xb7, 0x49, 0xab, 0x88, 0xa4, 0xa4, 0xea, 0x74,
+	0x08, 0x06, 0x5c, 0x26, 0x0c, 0x0f, 0x90, 0x98, 0xb6, 0x30, 0x90, 0x32, 0x18, 0x7f, 0x81, 0x19,
+	0xc8, 0xa8, 0xd2, 0xd5, 0xd6, 0xb4, 0xd2, 0x89, 0xd3, 0xb9, 0x75, 0x1e, 0x81, 0xe1, 0x3d, 0x78,
+	0x0d, 0x3e, 0xf1, 0x91, 0x57, 0x62, 0x18, 0xdd, 0x9d, 0xfe, 0x58, 0x96, 0x55, 0x86, 0xe9, 0xe4,
+	0x9b, 0x6e, 0xf7, 0xb7, 0x7b, 0xbf, 0xbd, 0xdd, 0xbb, 0x5d, 0x81, 0xc1, 0x3d, 0x6f, 0x1c, 0x33,
+	0xca, 0x29, 0xb6, 0xb9, 0xe7, 0x39, 0x0e, 0x0c, 0x9e, 0x91, 0x37, 0xb3, 0xd5, 0x94, 0xfc, 0xba,
+	0x24, 0x09, 0x47, 0x84, 0x0e, 0x5f, 0x05, 0xbe, 0xa5, 0x9d, 0x68, 0xa7, 0xc6, 0x54, 0x7c, 0x3b,
+	0x0f, 0x60, 0xa8, 0x30, 0x49, 0x4c, 0xa3, 0x84, 0xe4, 0xa0, 0x56, 0x09, 0xf4, 0x10, 0xf6, 0x26,
+	0x34, 0x0c, 0x03, 0xde, 0xec, 0x0b, 0xc1, 0x2c, 0x60, 0xd2, 0x9d, 0x30, 0x75, 0x23, 0x8f, 0xbc,
+	0x7a, 0xbb, 0x69, 0x0e, 0x53, 0xa6, 0x0c, 0xac, 0x0b, 0x32, 0x0f, 0xa2, 0x6f, 0xa9, 0xf7, 0x72,
+	0x4a, 0x12, 0xba, 0x64, 0x1e, 0x69, 0xf0, 0x81, 0x26, 0xb4, 0x59, 0x4e, 0x3c, 0xfd, 0xc4, 0x7d,
+	0xe8, 0xba, 0x73, 0x12, 0x71, 0xab, 0x2d, 0x64, 0x72, 0x81, 0x36, 0xf4, 0x98, 0x72, 0x67, 0x75,
+	0x84, 0x22, 0x5f, 0x3b, 0x76, 0xed, 0x9e, 0x49, 0x4c, 0x13, 0xe2, 0xc4, 0x70, 0xe7, 0x71, 0xe4,
+	0xdf, 0x24, 0x1b, 0xab, 0x66, 0x47, 0xc9, 0xe5, 0x37, 0x0d, 0xee, 0x3e, 0x71, 0x83, 0x57, 0x37,
+	0xc8, 0x06, 0xef, 0x80, 0xce, 0x88, 0x9b, 0xd0, 0xc8, 0xea, 0x0a, 0x8d, 0x5a, 0x39, 0x87, 0x75,
+	0x54, 0x24, 0x4d, 0x06, 0xb7, 0xcf, 0x53, 0xbf, 0x69, 0x59, 0xb8, 0x91, 0xdf, 0xc4, 0xb0, 0xbc,
+	0x73, 0xab, 0xb2, 0xf3, 0xc7, 0xb0, 0xe3, 0x49, 0x0f, 0x82, 0xed, 0xee, 0xd9, 0xad, 0x71, 0x5a,
+	0xea, 0x6b, 0xae, 0x33, 0x84, 0x33, 0x02, 0x3c, 0xe7, 0xdc, 0xf5, 0x16, 0x42, 0x9d, 0x6d, 0x99,
+	0x87, 0xab, 0x95, 0xc2, 0x75, 0x7e, 0xd7, 0xe0, 0x28, 0xe3, 0xfc, 0x03, 0x77, 0xf9, 0x32, 0x99,
+	0x2c, 0xdc, 0x68, 0x4e, 0xfe, 0x37, 0xd3, 0x87, 0xa0, 0x27, 0xc2, 0x8f, 0x22, 0x3a, 0x14, 0x44,
+	0x67, 0x2b, 0xe9, 0x7c, 0xaa, 0x94, 0x05, 0x9b, 0x4e, 0x99, 0xcd, 0xbd, 0xad, 0x64, 0xe4, 0x69,
+	0xfe, 0x55, 0x62, 0xab, 0xc2, 0x4e, 0x0f, 0x9e, 0xdc, 0xc8, 0xb9, 0xd6, 0x73, 0x4e, 0xa5, 0x84,
+	0x31, 0xca, 0x54, 0x4d, 0xc8, 0x05, 0x1e, 0x81, 0x11, 0x13, 0x16, 0xba, 0x51, 0x8a, 0xd7, 0x4f,
+	0xb4, 0xd3, 0xde, 0xb4, 0x10, 0x38, 0x1f, 0xc0, 0xf1, 0x96, 0x30, 0xd4, 0xcd, 0xff, 0x5b, 0x03,
+	0x98, 0xad, 0x32, 0x0c, 0xee, 0x42, 0x2b, 0x0f, 0xaa, 0xf5, 0x8e, 0x8a, 0xb9, 0x48, 0x54, 0xb7,
+	0x29, 0x51, 0xf7, 0x61, 0xe0, 0x31, 0xe2, 0x72, 0xe2, 0x5f, 0xf1, 0x20, 0x24, 0x22, 0x96, 0xf6,
+	0xb4, 0xaf, 0x64, 0xb3, 0x20, 0x24, 0x29, 0x64, 0x19, 0xfb, 0x05, 0x64, 0x47, 0x42, 0x94, 0x2c,
+	0x85, 0x38, 0x23, 0xd8, 0x7f, 0x4a, 0xf8, 0x39, 0xf3, 0x16, 0xc1, 0x6b, 0xe2, 0x37, 0xbf, 0x84,
+	0xff, 0x68, 0x70, 0x50, 0x01, 0x57, 0x5e, 0xe6, 0xca, 0xbd, 0x8e, 0x8b, 0xa3, 0x88, 0x03, 0xff,
+	0xbf, 0x56, 0x60, 0x35, 0xb0, 0xce, 0xdb, 0x03, 0xeb, 0x6e, 0x04, 0x86, 0x0f, 0x60, 0xe8, 0x2a,
+	0xa2, 0xe5, 0xf3, 0x19, 0x64, 0x42, 0x01, 0xfa, 0x14, 0x8c, 0xec, 0xd8, 0x13, 0x6b, 0xe7, 0xa4,
+	0x7d, 0xda, 0x3f, 0xdb, 0x53, 0xa4, 0xf2, 0xf7, 0xa2, 0x40, 0x38, 0x7f, 0xb6, 0xc0, 0x98, 0xad,
+	0xbe, 0x0a, 0x12, 0x4e, 0xd9, 0xf5, 0x46, 0xee, 0x6b, 0xda, 0xd3, 0x5a, 0x9e, 0xdb, 0x95, 0x3c,
+	0xa7, 0xf5, 0xf9, 0xba, 0x54, 0xb5, 0x62, 0x81, 0x63, 0xe8, 0xbf, 0x60, 0x34, 0xbc, 0x6a, 0x2a,
+	0x01, 0x48, 0x11, 0xf2, 0x1b, 0x47, 0x60, 0x70, 0x9a, 0xa1, 0xf5, 0x3a, 0x74, 0x8f, 0x53, 0x85,
+	0x45, 0xe8, 0x44, 0xd4, 0x97, 0x75, 0x60, 0x4c, 0xc5, 0x37, 0x1e, 0x03, 0xb8, 0x1e, 0xa7, 0xec,
+	0x8a, 0x5f, 0xc7, 0xc4, 0xea, 0x09, 0x8d, 0x21, 0x24, 0xb3, 0xeb, 0x58, 0x90, 0x14, 0x0b, 0xcb,
+	0x50, 0xe5, 0x9b, 0x2e, 0x8a, 0xab, 0x05, 0xe5, 0xab, 0x55, 0x4d, 0x5c, 0x7f, 0x23, 0x71, 0xce,
+	0x47, 0x70, 0xfb, 0x29, 0xe1, 0xf9, 0x19, 0x36, 0x55, 0xdb, 0x97, 0xb0, 0xbf, 0x0e, 0x55, 0xb5,
+	0xf6, 0x09, 0x18, 0x0b, 0x21, 0x0a, 0x48, 0x62, 0x69, 0x22, 0x67, 0xbb, 0x2a, 0xe0, 0x0c, 0x5a,
+	0x00, 0x46, 0x3f, 0x42, 0x2f, 0x3b, 0x08, 0xec, 0xc3, 0xce, 0x44, 0x72, 0x31, 0xdf, 0x43, 0x00,
+	0x3d, 0x6d, 0x0b, 0xc4, 0x37, 0x35, 0x1c, 0x82, 0x31, 0xa1, 0xd1, 0x8b, 0x80, 0x85, 0xc4, 0x37,
+	0x5b, 0x38, 0x80, 0x9e, 0xec, 0xf8, 0xc4, 0x37, 0xdb, 0xa9, 0x55, 0x4a, 0x9d, 0x2e, 0xb9, 0xd9,
+	0x49, 0xad, 0xe4, 0x83, 0x60, 0x76, 0x47, 0x1f, 0xc2, 0xa0, 0xfc, 0x1c, 0x09, 0xf7, 0xdf, 0x5d,
+	0x5e, 0x5e, 0x7e, 0x3d, 0x93, 0xee, 0xa5, 0x0f, 0x53, 0x3b, 0xfb, 0x43, 0x07, 0xfd, 0x71, 0x34,
+	0x0f, 0x22, 0x82, 0x63, 0xe8, 0x8a, 0x99, 0x06, 0xe5, 0x73, 0x56, 0x9e, 0x81, 0x6c, 0x2c, 0x8b,
+	0x54, 0xb0, 0x5f, 0x80, 0x2e, 0xe7, 0x16, 0xdc, 0x17, 0xda, 0xca, 0xac, 0x63, 0x1f, 0x54, 0xa4,
+	0x25, 0x33, 0xb1, 0x7b, 0x66, 0xb6, 0x3e, 0xe7, 0xd8, 0x07, 0x15, 0xa9, 0x32, 0xfb, 0x1e, 0x6e,
+	0x6d, 0x8c, 0x18, 0x78, 0x2c, 0xb0, 0xdb, 0xc6, 0x1d, 0x7b, 0xab, 0x5a, 0x34, 0x06, 0xfc, 0x06,
+	0xf6, 0x2a, 0x73, 0x02, 0xbe, 0x2f, 0x2c, 0xea, 0xe7, 0x15, 0x7b, 0x8b, 0x52, 0x3a, 0x7b, 0x06,
+	0x66, 0xb5, 0x9d, 0xe3, 0x91, 0x30, 0xd8, 0x32, 0x70, 0xd8, 0xdb, 0xb4, 0xd2, 0xdf, 0xcf, 0x70,
+	0x50, 0xdb, 0xd5, 0xf0, 0xbe, 0x30, 0x6b, 0x6a, 0xbf, 0x76, 0x23, 0x44, 0xba, 0xff, 0xa5, 0x70,
+	0xbf, 0xd6, 0x4c, 0x2a, 0xee, 0xeb, 0xfa, 0xa5, 0xed, 0x34, 0x41, 0x54, 0xba, 0x2e, 0xa0, 0x5f,
+	0x1a, 0x27, 0xf0, 0xae, 0xec, 0x90, 0x1b, 0x03, 0x86, 0x6d, 0x6d, 0xb6, 0x4e, 0xa9, 0xf9, 0x4c,
+	0xc3, 0x27, 0x30, 0x5c, 0x7b, 0xd2, 0xf1, 0x50, 0x80, 0xeb, 0x7a, 0x82, 0x6d, 0xd7, 0xa9, 0x14,
+	0x97, 0x09, 0x0c, 0xca, 0xb7, 0x15, 0xad, 0x0c, 0x5b, 0xbd, 0xeb, 0xf6, 0x61, 0x8d, 0x46, 0x3a,
+	0xb9, 0xb8, 0xf7, 0xd3, 0xd1, 0x3c, 0xe0, 0x8b, 0xe5, 0xf3, 0xb1, 0x47, 0xc3, 0x47, 0x73, 0x1a,
+	0x92, 0x64, 0x11, 0x11, 0xfe, 0x86, 0xb2, 0x97, 0x8f, 0xb8, 0xe7, 0x3d, 0xd7, 0xc5, 0x1f, 0xc4,
+	0xe7, 0xff, 0x0e, 0x00, 0xd1, 0x8c, 0x1b, 0x77, 0x4e, 0x0c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -751,8 +1412,12 @@ type EngineClient interface {
 	Cancel(ctx context.Context, in *CancelTxRequest, opts ...grpc.CallOption) (*CancelTxResponse, error)
 	BeginLockResource(ctx context.Context, in *BeginLockResourceRequest, opts ...grpc.CallOption) (*BeginLockResourceRespose, error)
 	EndLockResource(ctx context.Context, in *EndLockResourceRequest, opts ...grpc.CallOption) (*EndLockResourceRespose, error)
+	FailLockResource(ctx context.Context, in *FailLockResourceRequest, opts ...grpc.CallOption) (*FailLockResourceRespose, error)
 	ResourceStatusChanged(ctx context.Context, in *ResourceStatusChangedRequest, opts ...grpc.CallOption) (*ResourceStatusChangedRespose, error)
+	ResourceCommandFailed(ctx context.Context, in *ResourceCommandFailedRequest, opts ...grpc.CallOption) (*ResourceCommandFailedResponse, error)
 	AttachAgent(ctx context.Context, in *AttachAgentRequest, opts ...grpc.CallOption) (Engine_AttachAgentClient, error)
+	GetArchivedTx(ctx context.Context, in *GetArchivedTxRequest, opts ...grpc.CallOption) (*GetArchivedTxResponse, error)
+	GetTxHistory(ctx context.Context, in *GetTxHistoryRequest, opts ...grpc.CallOption) (*GetTxHistoryResponse, error)
 }
 
 type engineClient struct {
@@ -808,6 +1473,15 @@ func (c *engineClient) EndLockResource(ctx context.Context, in *EndLockResourceR
 	return out, nil
 }
 
+func (c *engineClient) FailLockResource(ctx context.Context, in *FailLockResourceRequest, opts ...grpc.CallOption) (*FailLockResourceRespose, error) {
+	out := new(FailLockResourceRespose)
+	err := c.cc.Invoke(ctx, "/tcc.Engine/FailLockResource", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *engineClient) ResourceStatusChanged(ctx context.Context, in *ResourceStatusChangedRequest, opts ...grpc.CallOption) (*ResourceStatusChangedRespose, error) {
 	out := new(ResourceStatusChangedRespose)
 	err := c.cc.Invoke(ctx, "/tcc.Engine/ResourceStatusChanged", in, out, opts...)
@@ -817,6 +1491,15 @@ func (c *engineClient) ResourceStatusChanged(ctx context.Context, in *ResourceSt
 	return out, nil
 }
 
+func (c *engineClient) ResourceCommandFailed(ctx context.Context, in *ResourceCommandFailedRequest, opts ...grpc.CallOption) (*ResourceCommandFailedResponse, error) {
+	out := new(ResourceCommandFailedResponse)
+	err := c.cc.Invoke(ctx, "/tcc.Engine/ResourceCommandFailed", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *engineClient) AttachAgent(ctx context.Context, in *AttachAgentRequest, opts ...grpc.CallOption) (Engine_AttachAgentClient, error) {
 	stream, err := c.cc.NewStream(ctx, &_Engine_serviceDesc.Streams[0], "/tcc.Engine/AttachAgent", opts...)
 	if err != nil {
@@ -849,6 +1532,24 @@ func (x *engineAttachAgentClient) Recv() (*AgentCommandRequest, error) {
 	return m, nil
 }
 
+func (c *engineClient) GetArchivedTx(ctx context.Context, in *GetArchivedTxRequest, opts ...grpc.CallOption) (*GetArchivedTxResponse, error) {
+	out := new(GetArchivedTxResponse)
+	err := c.cc.Invoke(ctx, "/tcc.Engine/GetArchivedTx", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) GetTxHistory(ctx context.Context, in *GetTxHistoryRequest, opts ...grpc.CallOption) (*GetTxHistoryResponse, error) {
+	out := new(GetTxHistoryResponse)
+	err := c.cc.Invoke(ctx, "/tcc.Engine/GetTxHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EngineServer is the server API for Engine service.
 type EngineServer interface {
 	NewTx(context.Context, *NewTxRequest) (*NewTxResponse, error)
@@ -856,8 +1557,12 @@ type EngineServer interface {
 	Cancel(context.Context, *CancelTxRequest) (*CancelTxResponse, error)
 	BeginLockResource(context.Context, *BeginLockResourceRequest) (*BeginLockResourceRespose, error)
 	EndLockResource(context.Context, *EndLockResourceRequest) (*EndLockResourceRespose, error)
+	FailLockResource(context.Context, *FailLockResourceRequest) (*FailLockResourceRespose, error)
 	ResourceStatusChanged(context.Context, *ResourceStatusChangedRequest) (*ResourceStatusChangedRespose, error)
+	ResourceCommandFailed(context.Context, *ResourceCommandFailedRequest) (*ResourceCommandFailedResponse, error)
 	AttachAgent(*AttachAgentRequest, Engine_AttachAgentServer) error
+	GetArchivedTx(context.Context, *GetArchivedTxRequest) (*GetArchivedTxResponse, error)
+	GetTxHistory(context.Context, *GetTxHistoryRequest) (*GetTxHistoryResponse, error)
 }
 
 func RegisterEngineServer(s *grpc.Server, srv EngineServer) {
@@ -954,6 +1659,24 @@ func _Engine_EndLockResource_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Engine_FailLockResource_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailLockResourceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).FailLockResource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tcc.Engine/FailLockResource",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).FailLockResource(ctx, req.(*FailLockResourceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Engine_ResourceStatusChanged_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ResourceStatusChangedRequest)
 	if err := dec(in); err != nil {
@@ -972,6 +1695,24 @@ func _Engine_ResourceStatusChanged_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Engine_ResourceCommandFailed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResourceCommandFailedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).ResourceCommandFailed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tcc.Engine/ResourceCommandFailed",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).ResourceCommandFailed(ctx, req.(*ResourceCommandFailedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Engine_AttachAgent_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(AttachAgentRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -993,6 +1734,42 @@ func (x *engineAttachAgentServer) Send(m *AgentCommandRequest) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Engine_GetArchivedTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetArchivedTxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).GetArchivedTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tcc.Engine/GetArchivedTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).GetArchivedTx(ctx, req.(*GetArchivedTxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_GetTxHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTxHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).GetTxHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tcc.Engine/GetTxHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).GetTxHistory(ctx, req.(*GetTxHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Engine_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "tcc.Engine",
 	HandlerType: (*EngineServer)(nil),
@@ -1017,10 +1794,26 @@ var _Engine_serviceDesc = grpc.ServiceDesc{
 			MethodName: "EndLockResource",
 			Handler:    _Engine_EndLockResource_Handler,
 		},
+		{
+			MethodName: "FailLockResource",
+			Handler:    _Engine_FailLockResource_Handler,
+		},
 		{
 			MethodName: "ResourceStatusChanged",
 			Handler:    _Engine_ResourceStatusChanged_Handler,
 		},
+		{
+			MethodName: "ResourceCommandFailed",
+			Handler:    _Engine_ResourceCommandFailed_Handler,
+		},
+		{
+			MethodName: "GetArchivedTx",
+			Handler:    _Engine_GetArchivedTx_Handler,
+		},
+		{
+			MethodName: "GetTxHistory",
+			Handler:    _Engine_GetTxHistory_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,179 @@
+// Package tlsconfig tls configs of the connections between the agents and the engine
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	config "github.com/dynamicgo/go-config"
+	"github.com/dynamicgo/go-config/reader"
+	"github.com/dynamicgo/xerrors"
+	"github.com/dynamicgo/xerrors/apierr"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const apierrScope = "tcc.tlsconfig"
+
+// errors
+var (
+	ErrCert = apierr.WithScope(-1, "invalid certificate", apierrScope)
+	ErrCA   = apierr.WithScope(-2, "invalid ca certificates", apierrScope)
+)
+
+// Config the tls files of one side, tls is disabled if both Cert and CA are empty
+type Config struct {
+	Cert       string // pem certificate file
+	Key        string // pem private key file of Cert
+	CA         string // pem CA file to verify the peer certificate, the system roots if empty
+	ClientAuth bool   // server side, require and verify the client certificate against CA
+	ServerName string // client side, the server name to verify instead of the dial address host
+}
+
+// Load load config from the cert, key, ca, client_auth and server_name keys under path
+func Load(conf config.Config, path ...string) *Config {
+	get := func(key string) reader.Value {
+		return conf.Get(append(append([]string{}, path...), key)...)
+	}
+
+	return &Config{
+		Cert:       get("cert").String(""),
+		Key:        get("key").String(""),
+		CA:         get("ca").String(""),
+		ClientAuth: get("client_auth").Bool(false),
+		ServerName: get("server_name").String(""),
+	}
+}
+
+// Enabled return true if tls configured, nil config is disabled
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Cert != "" || c.CA != "")
+}
+
+func (c *Config) certificates() ([]tls.Certificate, error) {
+	if c.Cert == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "load certificate %s error", c.Cert)
+	}
+
+	return []tls.Certificate{cert}, nil
+}
+
+func (c *Config) pool() (*x509.CertPool, error) {
+	if c.CA == "" {
+		return nil, nil
+	}
+
+	buff, err := ioutil.ReadFile(c.CA)
+
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "read ca %s error", c.CA)
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(buff) {
+		return nil, xerrors.Wrapf(ErrCA, "ca %s", c.CA)
+	}
+
+	return pool, nil
+}
+
+// Server create the server side tls config
+func (c *Config) Server() (*tls.Config, error) {
+	certs, err := c.certificates()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(certs) == 0 {
+		return nil, xerrors.Wrapf(ErrCert, "server certificate not set")
+	}
+
+	pool, err := c.pool()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		Certificates: certs,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientAuth {
+		if pool == nil {
+			return nil, xerrors.Wrapf(ErrCA, "client_auth requires ca")
+		}
+
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return conf, nil
+}
+
+// Client create the client side tls config
+func (c *Config) Client() (*tls.Config, error) {
+	certs, err := c.certificates()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := c.pool()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: certs,
+		RootCAs:      pool,
+		ServerName:   c.ServerName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// CommonName return the subject common name of the Cert
+func (c *Config) CommonName() (string, error) {
+	certs, err := c.certificates()
+
+	if err != nil || len(certs) == 0 {
+		return "", err
+	}
+
+	cert, err := x509.ParseCertificate(certs[0].Certificate[0])
+
+	if err != nil {
+		return "", xerrors.Wrapf(err, "parse certificate %s error", c.Cert)
+	}
+
+	return cert.Subject.CommonName, nil
+}
+
+// Identity return the subject common name of the verified client certificate of the grpc call, false if the
+// client not authenticated by certificate
+func Identity(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+
+	if !ok {
+		return "", false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
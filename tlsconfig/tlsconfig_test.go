@@ -0,0 +1,53 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/dynamicgo/xerrors"
+	"github.com/gomeshnetwork/tcc/tlsconfig/tlstest"
+)
+
+func TestServerConfig(t *testing.T) {
+	certs := tlstest.New(t)
+
+	cert, key := certs.Server("engine")
+
+	if _, err := (&Config{CA: certs.CA}).Server(); !xerrors.Is(err, ErrCert) {
+		t.Fatalf("expect ErrCert without server certificate, got %v", err)
+	}
+
+	if _, err := (&Config{Cert: cert, Key: key, ClientAuth: true}).Server(); !xerrors.Is(err, ErrCA) {
+		t.Fatalf("expect ErrCA for client auth without ca, got %v", err)
+	}
+
+	conf, err := (&Config{Cert: cert, Key: key, CA: certs.CA, ClientAuth: true}).Server()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.ClientAuth != tls.RequireAndVerifyClientCert || conf.ClientCAs == nil {
+		t.Fatalf("expect client certificate verified")
+	}
+}
+
+func TestCommonName(t *testing.T) {
+	certs := tlstest.New(t)
+
+	cert, key := certs.Client("agent-a")
+
+	name, err := (&Config{Cert: cert, Key: key}).CommonName()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "agent-a" {
+		t.Fatalf("expect common name agent-a, got %s", name)
+	}
+
+	if (&Config{}).Enabled() || (*Config)(nil).Enabled() || !(&Config{CA: certs.CA}).Enabled() {
+		t.Fatalf("expect tls enabled by cert or ca only")
+	}
+}
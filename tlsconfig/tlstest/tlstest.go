@@ -0,0 +1,135 @@
+// Package tlstest generate self-signed certificates for the tls tests
+package tlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Certs generated certificate files
+type Certs struct {
+	Dir string
+	CA  string // ca certificate file
+	t   testing.TB
+	ca  *x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+// New generate a self-signed ca in a temp dir
+func New(t testing.TB) *Certs {
+	dir, err := ioutil.TempDir("", "tcc-tls")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs := &Certs{Dir: dir, t: t}
+
+	template := certs.template("tcc test ca")
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+
+	certs.key = certs.newKey()
+	certs.CA, _ = certs.write("ca", template, template, certs.key, certs.key)
+
+	if certs.ca, err = x509.ParseCertificate(certs.der(certs.CA)); err != nil {
+		t.Fatal(err)
+	}
+
+	return certs
+}
+
+func (certs *Certs) newKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		certs.t.Fatal(err)
+	}
+
+	return key
+}
+
+func (certs *Certs) template(name string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+
+	if err != nil {
+		certs.t.Fatal(err)
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+}
+
+func (certs *Certs) der(file string) []byte {
+	buff, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		certs.t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(buff)
+
+	return block.Bytes
+}
+
+func (certs *Certs) write(name string, template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (string, string) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+
+	if err != nil {
+		certs.t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		certs.t.Fatal(err)
+	}
+
+	certFile := filepath.Join(certs.Dir, name+".pem")
+	keyFile := filepath.Join(certs.Dir, name+"-key.pem")
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		certs.t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		certs.t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// Server issue the server certificate for localhost and 127.0.0.1, return the cert and key files
+func (certs *Certs) Server(name string) (string, string) {
+	template := certs.template(name)
+	template.DNSNames = []string{"localhost"}
+	template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	return certs.write(name, template, certs.ca, certs.newKey(), certs.key)
+}
+
+// Client issue the client certificate of common name, return the cert and key files
+func (certs *Certs) Client(name string) (string, string) {
+	template := certs.template(name)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	return certs.write(name, template, certs.ca, certs.newKey(), certs.key)
+}